@@ -4,33 +4,40 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	rice "github.com/GeertJohan/go.rice"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/dustin/go-humanize"
 	"github.com/fsnotify/fsnotify"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/prologic/tube/importers"
+	"github.com/prologic/tube/media"
 	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/search"
+	"github.com/prologic/tube/storage"
 	"github.com/prologic/tube/utils"
 	"github.com/renstrom/shortuuid"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -39,11 +46,23 @@ import (
 // App represents main application.
 type App struct {
 	Config    *Config
+	Library   *media.Library
 	Watcher   *fsnotify.Watcher
 	Templates *templateStore
 	Listener  net.Listener
 	Router    *mux.Router
 	DataBase  *gorm.DB
+	Jobs      *jobQueue
+	Keys      *keyRing
+	Search    search.Index
+	Importers *importers.Registry
+	Storage   storage.Storage
+	Views     Store
+
+	// owner of videos imported from the library
+	libraryUserID uint
+	// resumable uploads being appended to
+	uploadLocks uploadLocks
 }
 
 // NewApp returns a new instance of App from Config.
@@ -54,6 +73,8 @@ func NewApp(cfg *Config) (*App, error) {
 	app := &App{
 		Config: cfg,
 	}
+	// Setup Library
+	app.Library = media.NewLibrary()
 	// Setup Watcher
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -67,6 +88,33 @@ func NewApp(cfg *Config) (*App, error) {
 	}
 	app.Listener = ln
 
+	// Setup token signing keys
+	keys, err := newKeyRing(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	app.Keys = keys
+
+	// Setup URL importers
+	registry, err := newImporters(cfg.Import)
+	if err != nil {
+		return nil, err
+	}
+	app.Importers = registry
+
+	// Setup media storage
+	store, err := newStorage(cfg.Storage, cfg.Server.UploadPath)
+	if err != nil {
+		return nil, err
+	}
+	app.Storage = store
+
+	// Setup background jobs
+	app.Jobs = newJobQueue(cfg.Jobs)
+	app.Jobs.Register(jobProcessVideo, app.processVideoJob)
+	app.Jobs.Register(jobImportVideo, app.importVideoJob)
+	app.Jobs.Register(jobReconcileReactions, app.reconcileReactionsJob)
+
 	// Templates
 	box := rice.MustFindBox("../templates")
 
@@ -90,34 +138,64 @@ func NewApp(cfg *Config) (*App, error) {
 	router := mux.NewRouter().StrictSlash(true)
 	router.HandleFunc("/v/list", app.listVideosHandler).Methods("GET", "OPTIONS")
 	router.HandleFunc("/v/best", app.bestVideosHandler).Methods("GET")
+	router.HandleFunc("/v/search", app.searchHandler).Methods("GET", "OPTIONS")
 	router.HandleFunc("/v/{id}.mp4", app.getVideoHandler).Methods("GET")
+	router.HandleFunc("/v/{id}/hls/{file}", app.getHLSHandler).Methods("GET")
+	router.HandleFunc("/v/{id}/hls/{version}/{file}", app.getHLSHandler).Methods("GET")
 	router.HandleFunc("/v/{id}", app.getVideoInfoHandler).Methods("GET", "OPTIONS")
 	router.HandleFunc("/user/{id}", app.getProfileHandler).Methods("GET", "OPTIONS")
 	router.HandleFunc("/user/{id}/video", app.getUserVideosHandler).Methods("GET", "OPTIONS")
+	router.HandleFunc("/user/{id}/feed.{format:xml|atom|json}", app.userFeedHandler).Methods("GET")
+	router.HandleFunc("/category/{id}/feed.{format:xml|atom|json}", app.categoryFeedHandler).Methods("GET")
+	router.HandleFunc("/feed.{format:xml|atom|json}", app.feedHandler).Methods("GET")
 
 	router.HandleFunc("/auth/signup", app.apiCreateUserHandler).Methods("POST", "OPTIONS")
 	router.HandleFunc("/auth/login", app.loginHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/auth/refresh", app.refreshHandler).Methods("POST", "OPTIONS")
+	router.HandleFunc("/auth/logout", app.logoutHandler).Methods("POST", "OPTIONS")
 
 	api := router.PathPrefix("/api").Subrouter()
-	api.Use(app.jwtVerify)
-	api.HandleFunc("/video", app.apiUploadVideoHandler).Methods("POST", "OPTIONS")
-	api.HandleFunc("/video/{id}", app.apiUpdateVideoInfoHandler).Methods("PUT", "OPTIONS")
-	api.HandleFunc("/video/{id}", app.apiDeleteVideoHandler).Methods("DELETE")
-	api.HandleFunc("/video/{id}/comments", app.apiGetVideoCommentsHandler).Methods("GET", "OPTIONS")
-	api.HandleFunc("/like/{id}", app.apiLikeHandler).Methods("POST", "DELETE", "OPTIONS")
-	api.HandleFunc("/like/{id}", app.apiCheckLiked).Methods("GET")
-	api.HandleFunc("/dislike/{id}", app.apiDislikeHandler).Methods("POST", "DELETE", "OPTIONS")
-	api.HandleFunc("/comment", app.apiCreateCommentHandler).Methods("POST", "OPTIONS")
-	api.HandleFunc("/comment/{id}", app.apiGetCommentHandler).Methods("GET", "OPTIONS")
-	api.HandleFunc("/comment/{id}", app.apiDeleteCommentHandler).Methods("DELETE")
-	api.HandleFunc("/category", app.apiGetCategoriesHandler).Methods("GET", "OPTIONS")
+	api.Handle("/video", app.protect(app.apiUploadVideoHandler, PermUpload)).Methods("POST", "OPTIONS")
+	api.Handle("/import", app.protect(app.apiImportVideoHandler, PermUpload)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/upload/", app.apiUploadOptionsHandler).Methods("OPTIONS")
+	api.HandleFunc("/upload/{id}", app.apiUploadOptionsHandler).Methods("OPTIONS")
+	api.Handle("/upload/", app.protect(tusResumable(app.apiCreateUploadHandler), PermUpload)).Methods("POST")
+	api.Handle("/upload/{id}", app.protect(tusResumable(app.apiGetUploadOffsetHandler), PermUpload)).Methods("HEAD")
+	api.Handle("/upload/{id}", app.protect(tusResumable(app.apiPatchUploadHandler), PermUpload)).Methods("PATCH")
+	api.Handle("/upload/{id}", app.protect(tusResumable(app.apiDeleteUploadHandler), PermUpload)).Methods("DELETE")
+	api.Handle("/video/{id}", app.protect(app.apiUpdateVideoInfoHandler)).Methods("PUT", "OPTIONS")
+	api.Handle("/video/{id}", app.protect(app.apiDeleteVideoHandler)).Methods("DELETE")
+	api.Handle("/video/{id}/thumbnail", app.protect(app.apiGetThumbnailHandler)).Methods("GET", "OPTIONS")
+	api.Handle("/video/{id}/thumbnail", app.protect(app.apiSetThumbnailHandler)).Methods("PUT")
+	api.Handle("/video/{id}/thumbnail", app.protect(app.apiUploadThumbnailHandler)).Methods("POST")
+	api.Handle("/video/{id}/status", app.protect(app.apiGetVideoStatusHandler)).Methods("GET", "OPTIONS")
+	api.Handle("/video/{id}/comments", app.protect(app.apiGetVideoCommentsHandler)).Methods("GET", "OPTIONS")
+	api.Handle("/video/{id}/reaction", app.protect(app.apiGetReactionHandler)).Methods("GET", "OPTIONS")
+	api.Handle("/video/{id}/reaction", app.protect(app.apiSetReactionHandler)).Methods("PUT")
+	api.Handle("/comment", app.protect(app.apiCreateCommentHandler)).Methods("POST", "OPTIONS")
+	api.Handle("/comment/{id}", app.protect(app.apiGetCommentHandler)).Methods("GET", "OPTIONS")
+	api.Handle("/comment/{id}", app.protect(app.apiEditCommentHandler)).Methods("PUT")
+	api.Handle("/comment/{id}", app.protect(app.apiDeleteCommentHandler)).Methods("DELETE")
+	api.Handle("/comment/{id}/replies", app.protect(app.apiGetCommentRepliesHandler)).Methods("GET", "OPTIONS")
+	api.Handle("/comment/{id}/like", app.protect(app.apiLikeCommentHandler)).Methods("PUT", "OPTIONS")
+	api.Handle("/comment/{id}/heart", app.protect(app.apiHeartCommentHandler)).Methods("PUT", "OPTIONS")
+	api.Handle("/comment/{id}/pin", app.protect(app.apiPinCommentHandler)).Methods("PUT", "OPTIONS")
+	api.Handle("/user/{id}/subscribe", app.protect(app.apiSubscribeHandler)).Methods("PUT", "OPTIONS")
+	api.Handle("/user/{id}/subscribe", app.protect(app.apiUnsubscribeHandler)).Methods("DELETE")
+	api.Handle("/user/{id}/subscriptions", app.protect(app.apiGetSubscriptionsHandler)).Methods("GET", "OPTIONS")
+	api.Handle("/feed/subscriptions", app.protect(app.apiSubscriptionFeedHandler)).Methods("GET", "OPTIONS")
+	api.Handle("/category", app.protect(app.apiGetCategoriesHandler)).Methods("GET", "OPTIONS")
 
 	admin := router.PathPrefix("/admin").Subrouter()
-	admin.Use(app.jwtVerifyAdmin)
-	admin.HandleFunc("/user", app.apiAdminGetUsersHandler).Methods("GET", "OPTIONS")
-	admin.HandleFunc("/user/chart", app.adminGetUserChartHandler).Methods("GET", "OPTIONS")
-	admin.HandleFunc("/user/{id}", app.adminDeleteUserHandler).Methods("DELETE", "OPTIONS")
-	admin.HandleFunc("/video", app.apiAdminGetVideosHandler).Methods("GET", "OPTIONS")
+	admin.Handle("/user", app.protect(app.apiAdminGetUsersHandler, PermManageUsers)).Methods("GET", "OPTIONS")
+	admin.Handle("/user/chart", app.protect(app.adminGetUserChartHandler, PermManageUsers)).Methods("GET", "OPTIONS")
+	admin.Handle("/user/{id}", app.protect(app.adminDeleteUserHandler, PermManageUsers)).Methods("DELETE", "OPTIONS")
+	admin.Handle("/user/{id}/role", app.protect(app.adminSetUserRoleHandler, PermManageUsers)).Methods("PUT", "OPTIONS")
+	admin.Handle("/video", app.protect(app.apiAdminGetVideosHandler, PermDeleteAnyVideo)).Methods("GET", "OPTIONS")
+	admin.Handle("/video/{id}", app.protect(app.adminDeleteVideoHandler, PermDeleteAnyVideo)).Methods("DELETE", "OPTIONS")
+	admin.Handle("/category", app.protect(app.adminCreateCategoryHandler, PermManageCategories)).Methods("POST", "OPTIONS")
+	admin.Handle("/category/{id}", app.protect(app.adminDeleteCategoryHandler, PermManageCategories)).Methods("DELETE", "OPTIONS")
+	admin.Handle("/audit", app.protect(app.adminGetAuditLogHandler, PermViewAuditLog)).Methods("GET", "OPTIONS")
 
 	// Static assets handler
 	// staticFs := http.FileServer(http.Dir("./static"))
@@ -125,45 +203,120 @@ func NewApp(cfg *Config) (*App, error) {
 	// 	Handler(http.StripPrefix("/static/", staticFs)).
 	// 	Methods("GET")
 
-	// Uploads static handler
-	uploadsFs := http.FileServer(http.Dir("./uploads"))
-	router.PathPrefix("/uploads/").
-		Handler(http.StripPrefix("/uploads/", uploadsFs)).
-		Methods("GET")
+	// Uploads handler
+	router.HandleFunc("/uploads/{key:.+}", app.getUploadHandler).Methods("GET")
 
 	cors := handlers.CORS(
-		handlers.AllowedHeaders([]string{
+		handlers.AllowedHeaders(append([]string{
 			"X-Requested-With",
 			"Content-Type",
 			"Authorization",
-		}),
+		}, tusHeaders...)),
+		handlers.ExposedHeaders(tusHeaders),
 		handlers.AllowedMethods([]string{
-			"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS",
+			"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS",
 		}),
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.AllowCredentials(),
 	)
-	router.Use(cors)
+	router.Use(func(next http.Handler) http.Handler {
+		withCORS := cors(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// an OPTIONS request without Origin isn't a CORS preflight but
+			// e.g. tus discovery, answered by its handler
+			if r.Method == http.MethodOptions && r.Header.Get("Origin") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			withCORS.ServeHTTP(w, r)
+		})
+	})
 
 	app.Router = router
 	return app, nil
 }
 
 //ConnectDB function: Make database connection
-func ConnectDB() (*gorm.DB, error) {
-	dsn := "tubeadmin:drowssap@tcp(127.0.0.1:3306)/nontube?charset=utf8mb4&parseTime=True&loc=Local"
-	return gorm.Open(mysql.Open(dsn), &gorm.Config{})
+func ConnectDB(cfg *DatabaseConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case "mysql":
+		if cfg.DSN == "" {
+			return nil, fmt.Errorf("no mysql DSN configured: set database.dsn or TUBE_DB_DSN")
+		}
+		dialector = mysql.Open(cfg.DSN)
+	case "sqlite":
+		dsn := cfg.DSN
+		if dsn == "" {
+			dsn = defaultSqliteDSN
+		}
+		dialector = sqlite.Open(sqliteDSN(dsn))
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Driver == "sqlite" {
+		// sqlite allows a single writer; serialize access instead of
+		// failing with "database is locked". The connection is kept for
+		// good, which also keeps in-memory databases alive.
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+	} else {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	}
+
+	return db, nil
+}
+
+// the sqlite database used when no DSN is configured
+const defaultSqliteDSN = "tube.sqlite"
+
+// sqliteDSN enables foreign keys in a sqlite DSN. A PRAGMA would only
+// apply to the connection open at the time, the DSN applies to every
+// connection the driver opens.
+func sqliteDSN(dsn string) string {
+	if strings.Contains(dsn, "_foreign_keys=") || strings.Contains(dsn, "_fk=") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_foreign_keys=1"
+	}
+	return dsn + "?_foreign_keys=1"
 }
 
 // Run imports the library and starts server.
 func (app *App) Run() error {
 	var err error
 
-	app.DataBase, err = ConnectDB()
+	app.DataBase, err = ConnectDB(app.Config.Database)
 	if err != nil {
 		return err
 	}
 
+	if app.Config.Database.AutoMigrate {
+		migrator, err := NewMigrator(app.DataBase, app.Config.Database.Driver)
+		if err != nil {
+			return err
+		}
+		if _, err := migrator.Up(); err != nil {
+			return err
+		}
+	}
+	if err := app.migrateStorageKeys(); err != nil {
+		return err
+	}
+
 	if err := os.MkdirAll(app.Config.Server.UploadPath, 0755); err != nil {
 		return fmt.Errorf(
 			"Error creating upload path %s: %w",
@@ -171,6 +324,43 @@ func (app *App) Run() error {
 		)
 	}
 
+	if err := app.openSearch(); err != nil {
+		return err
+	}
+	defer app.Search.Close()
+
+	if err := app.openViews(); err != nil {
+		return err
+	}
+	defer app.Views.Close()
+	defer app.flushViewCounts()
+
+	if err := app.openLibrary(); err != nil {
+		return err
+	}
+	defer app.Watcher.Close()
+
+	if err := app.Jobs.Start(app.DataBase); err != nil {
+		return err
+	}
+	defer app.Jobs.Stop()
+
+	// stops background work along with the job queue, waiting for a view
+	// flush in progress before the view store is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	var flushing sync.WaitGroup
+	defer flushing.Wait()
+	defer cancel()
+
+	go app.expireUploads(ctx)
+	go app.backfillVideoSizes(ctx)
+	flushing.Add(1)
+	go func() {
+		defer flushing.Done()
+		app.flushViews(ctx)
+	}()
+	go app.scheduleReconcileReactions(ctx)
+
 	return http.Serve(app.Listener, app.Router)
 }
 
@@ -186,24 +376,6 @@ func (app *App) render(name string, w http.ResponseWriter, ctx interface{}) {
 	}
 }
 
-// returns pagination offset and limit from url parameters 
-func getOffsetAndLimit(query url.Values) (int, int) {
-	var offset, limit int
-	offsets, ok := query["offset"]
-	if !ok || len(offsets[0]) < 1 {
-		offset = 0
-	} else {
-		offset, _ = strconv.Atoi(offsets[0])
-	}
-	limits, ok := query["limit"]
-	if !ok || len(limits[0]) < 1 {
-		limit = 10
-	} else {
-		limit, _ = strconv.Atoi(limits[0])
-	}
-	return offset, limit
-}
-
 // returns category id from url parameters 
 func getCategory(query url.Values) int {
 	category := 0
@@ -227,6 +399,8 @@ func (app *App) apiCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user.Password = string(pass)
+	// roles are granted by admins only
+	user.Role = models.RoleUploader
 
 	res := app.DataBase.Create(&user)
 	if res.Error != nil {
@@ -234,127 +408,13 @@ func (app *App) apiCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		log.Error(res.Error)
 		return
 	}
+	app.indexUser(user.ID)
 
+	user.Password = ""
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
-// HTTP handler for /auth/login
-func (app *App) loginHandler(w http.ResponseWriter, r *http.Request) {
-	log.Info("[POST] /auth/login")
-	user := &models.User{}
-	err := json.NewDecoder(r.Body).Decode(user)
-	if err != nil {
-		http.Error(w, "Login failed", http.StatusBadRequest)
-		log.Error(err)
-		return
-	}
-
-	resp, err := app.findUser(user.Name, user.Password)
-	if err != nil {
-		http.Error(w, "Login failed", http.StatusBadRequest)
-		log.Error(err)
-	} else {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
-	}
-}
-
-func (app *App) findUser(name, password string) (map[string]interface{}, error) {
-	user := &models.User{}
-	err := app.DataBase.Where("name = ?", name).First(user).Error
-	if err != nil {
-		return nil, fmt.Errorf("User name not found")
-	}
-
-	expiresAt := time.Now().Add(time.Minute * 100000).Unix()
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	// Password does not match!
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		return nil, fmt.Errorf("Invalid login credentials. Please try again")
-	}
-
-	tk := &models.UserClaims{
-		UserID: user.ID,
-		Name:   user.Name,
-		Email:  user.Email,
-		Password: user.Password,
-		IsAdmin: user.IsAdmin,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expiresAt,
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
-	tokenString, error := token.SignedString([]byte("secret"))
-	if error != nil {
-		fmt.Println(error)
-	}
-
-	var resp = map[string]interface{}{"status": false, "message": "Logged in successfully!"}
-	resp["token"] = tokenString // Store the token in the response
-	resp["user"] = user
-	return resp, nil
-}
-
-// MIDDLEWARE FOR USER AUTHENTICATION
-func (app *App) jwtVerify(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		header = strings.TrimSpace(header)
-		if header == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Token is not provided"))
-			return
-		}
-
-		tk := &models.UserClaims{}
-		_, err := jwt.ParseWithClaims(header, tk, func(token *jwt.Token) (interface{}, error) {
-			return []byte("secret"), nil
-		})
-
-		if err == nil {
-			ctx := context.WithValue(r.Context(), "userID", tk.UserID)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Authentication error"))
-		}
-	})
-}
-
-// MIDDLEWARE FOR ADMIN AUTHENTICATION
-func (app *App) jwtVerifyAdmin(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		header = strings.TrimSpace(header)
-		if header == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Token is not provided"))
-			return
-		}
-
-		tk := &models.UserClaims{}
-		_, err := jwt.ParseWithClaims(header, tk, func(token *jwt.Token) (interface{}, error) {
-			return []byte("secret"), nil
-		})
-
-		if err == nil {
-			if tk.IsAdmin {
-				ctx := context.WithValue(r.Context(), "userID", tk.UserID)
-				next.ServeHTTP(w, r.WithContext(ctx))
-			} else {
-				w.WriteHeader(http.StatusUnauthorized)
-				w.Write([]byte("You don't have admin priveleges!"))
-			}
-		} else {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("Authentication error"))
-		}
-	})
-}
-
-
 // HTTP handler for /api/upload
 func (app *App) apiUploadVideoHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseMultipartForm(app.Config.Server.MaxUploadSize)
@@ -372,6 +432,7 @@ func (app *App) apiUploadVideoHandler(w http.ResponseWriter, r *http.Request) {
 	vid := &models.Video{}
 	vid.Title = r.FormValue("title")
 	vid.Description = r.FormValue("description")
+	vid.Status = models.VideoPending
 	uid_ctx := r.Context().Value("userID")
 	vid.UserID = uid_ctx.(uint)
 
@@ -387,106 +448,389 @@ func (app *App) apiUploadVideoHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	_, err = io.Copy(tempCopy, file)
+	tempCopy.Close()
 	if err != nil {
+		os.Remove(tempCopy.Name())
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		log.Error(err, w)
 		return
 	}
 
+	log.Info(r.FormValue("categoryIds"));
+	catIds := make([]uint, 0)
+	json.Unmarshal([]byte(r.FormValue("categoryIds")), &catIds)
+
+	if err := app.createVideo(vid, catIds, tempCopy.Name(), nil); err != nil {
+		os.Remove(tempCopy.Name())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(vid)
+	log.Info(fmt.Sprintf("New upload: Id=%d; Title: \"%s\"", vid.ID, vid.Title))
+}
+
+// creates an uploaded video in its categories and enqueues the processing
+// of source, its uploaded file. This happens in a transaction, along with
+// whatever more the caller passes as then, so no video is left without its
+// processing job.
+func (app *App) createVideo(vid *models.Video, catIds []uint, source string, then func(tx *gorm.DB) error) error {
 	// GENERATE RANDOM IDNTIFIER
 	uniqueName := shortuuid.New()
-	vid.URL = filepath.Join(app.Config.Server.UploadPath, fmt.Sprintf("%s.mp4", uniqueName))
-	vid.ThumbnailURL = filepath.Join(app.Config.Server.UploadPath, fmt.Sprintf("%s.jpg", uniqueName))
 
-	res := app.DataBase.Create(&vid)
+	err := app.DataBase.Transaction(func(tx *gorm.DB) error {
+		if err := createVideoTx(tx, vid, uniqueName, catIds); err != nil {
+			return err
+		}
+
+		_, err := app.Jobs.EnqueueTx(tx, jobProcessVideo, vid.ID, &processVideoPayload{
+			VideoID:    vid.ID,
+			UniqueName: uniqueName,
+			Source:     source,
+		})
+		if err != nil {
+			return err
+		}
+		if then != nil {
+			return then(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	app.Jobs.notify()
+	return nil
+}
+
+// creates vid in tx as a pending video named uniqueName, in those of
+// catIds that are known categories
+func createVideoTx(tx *gorm.DB, vid *models.Video, uniqueName string, catIds []uint) error {
+	vid.Status = models.VideoPending
+	vid.URL = fmt.Sprintf("%s.mp4", uniqueName)
+	if res := tx.Create(vid); res.Error != nil {
+		return res.Error
+	}
+
+	// add video categories, skipping unknown ones
+	if len(catIds) == 0 {
+		return nil
+	}
+	known := []uint{}
+	res := tx.Model(&models.Category{}).Where("id IN ?", catIds).Pluck("id", &known)
 	if res.Error != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		log.Error(res.Error)
-		return
+		return res.Error
+	}
+	for _, cid := range known {
+		vcat := &models.VideoCategory{}
+		vcat.VID = vid.ID
+		vcat.CID = cid
+		if res := tx.Create(vcat); res.Error != nil {
+			return res.Error
+		}
 	}
+	return nil
+}
 
-	// add video categories
-	log.Info(r.FormValue("categoryIds"));
-	catIds := make([]uint, 0)
-	json.Unmarshal([]byte(r.FormValue("categoryIds")), &catIds)
-	if len(catIds) > 0 {
-		for _, cid := range catIds {
-			vcat := &models.VideoCategory{}
-			vcat.VID = vid.ID
-			vcat.CID = cid;
-			app.DataBase.Save(vcat);
+const jobProcessVideo = "process_video"
+
+// processVideoPayload is the job payload for jobProcessVideo
+type processVideoPayload struct {
+	VideoID    uint   `json:"videoId"`
+	UniqueName string `json:"uniqueName"`
+	Source     string `json:"source"`
+	// keep the existing thumbnail (e.g. one provided by an import source)
+	// instead of generating one
+	KeepThumbnail bool `json:"keepThumbnail,omitempty"`
+}
+
+// job handler for jobProcessVideo: transcodes the uploaded file and
+// generates its thumbnail
+func (app *App) processVideoJob(ctx context.Context, job *models.Job) error {
+	payload := &processVideoPayload{}
+	if err := decodePayload(job, payload); err != nil {
+		return err
+	}
+
+	video := &models.Video{}
+	res := app.DataBase.Find(video, payload.VideoID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if video.ID <= 0 {
+		// video was deleted while the job was waiting
+		os.Remove(payload.Source)
+		return nil
+	}
+
+	if err := app.processVideo(ctx, video, payload.UniqueName, payload.Source, payload.KeepThumbnail); err != nil {
+		// keep the video pending while there are retries left, or when
+		// the job was only interrupted
+		if job.Attempts < job.MaxAttempts || ctx.Err() != nil {
+			app.setVideoStatus(video, models.VideoPending, err.Error())
+		} else {
+			app.setVideoStatus(video, models.VideoFailed, err.Error())
+			os.Remove(payload.Source)
 		}
+		return err
 	}
-	
-	json.NewEncoder(w).Encode(vid)
-	log.Info(fmt.Sprintf("New upload: Id=%d; Title: \"%s\"", vid.ID, vid.Title))
 
-	defer app.processVideo(vid, uniqueName, tempCopy)
+	os.Remove(payload.Source)
+	return nil
 }
 
-func (app *App) processVideo(video *models.Video, uniqueName string, tempCopy *os.File) {
+// transcodes source and stores the video with its renditions, thumbnails
+// and HLS playlists. The commands it runs are killed once ctx is done.
+func (app *App) processVideo(ctx context.Context, video *models.Video, uniqueName string, source string, keepThumbnail bool) error {
 	transcodeFile, err := ioutil.TempFile(
 		app.Config.Server.UploadPath,
 		fmt.Sprintf("tube-transcode-*.mp4"),
 	)
-	tempThumb := fmt.Sprintf("%s.jpg", strings.TrimSuffix(transcodeFile.Name(), ".mp4"))
-	destThumb := filepath.Join(app.Config.Server.UploadPath, fmt.Sprintf("%s.jpg", uniqueName))
-	destVid := filepath.Join(app.Config.Server.UploadPath, fmt.Sprintf("%s.mp4", uniqueName))
-
-	if err := utils.RunCmd(
-		app.Config.Transcoder.Timeout,
-		"ffmpeg", "-y", "-i",
-		tempCopy.Name(),
+	if err != nil {
+		return err
+	}
+	transcodeFile.Close()
+	defer os.Remove(transcodeFile.Name())
+
+	videoKey := fmt.Sprintf("%s.mp4", uniqueName)
+
+	// keyframes for HLS are placed at the frame rate of the source, which
+	// transcoding keeps
+	var keyframes []string
+	if app.Config.Transcoder.HLS.Enabled {
+		fps := 0.0
+		if info, err := media.Probe(app.Config.Transcoder.ProbeTimeout, source); err == nil {
+			fps = info.FrameRate
+		}
+		keyframes = app.hlsKeyframeArgs(fps)
+	}
+
+	app.setVideoStatus(video, models.VideoTranscoding, "")
+	args := []string{
+		"-y", "-i",
+		source,
 		"-vcodec", "h264", "-acodec", "aac",
 		"-strict", "-2", "-loglevel", "quiet",
 		"-metadata", fmt.Sprintf("title=%s", video.Title),
 		"-metadata", fmt.Sprintf("comment=%s", video.Description),
-		transcodeFile.Name(),
-	); err != nil {
-		log.Error(err)
-		return
+	}
+	args = append(args, keyframes...)
+	args = append(args, transcodeFile.Name())
+	if err := utils.RunCmdContext(ctx, app.Config.Transcoder.Timeout, "ffmpeg", args...); err != nil {
+		return fmt.Errorf("error transcoding video: %w", err)
 	}
 
-	video.Duration, err = getVideoDuration(transcodeFile.Name())
-	app.DataBase.Save(&video)
+	if err := app.probeVideo(video, transcodeFile.Name()); err != nil {
+		return fmt.Errorf("error reading video information: %w", err)
+	}
+	info, err := os.Stat(transcodeFile.Name())
 	if err != nil {
-		log.Error(err)
-		return
+		return fmt.Errorf("error reading video size: %w", err)
+	}
+	video.Size = info.Size()
+	if res := app.DataBase.Save(video); res.Error != nil {
+		return res.Error
 	}
 
-	err = utils.RunCmd(app.Config.Thumbnailer.Timeout,
-		"mt", "-b", "-s", "-n", "1",
-		transcodeFile.Name(),
-	)
+	renditions, err := app.transcodeRenditions(ctx, video, transcodeFile.Name(), uniqueName)
 	if err != nil {
-		log.Error(err)
-		return
+		return err
 	}
+	// rendition files are local until they are stored
+	defer func(files []models.Rendition) {
+		for _, rend := range files {
+			os.Remove(rend.URL)
+		}
+	}(append([]models.Rendition(nil), renditions...))
 
-	if err := os.Rename(tempThumb, destThumb); err != nil {
-		log.Error(err)
-		return
+	// candidates are offered even when the thumbnail is kept
+	app.setVideoStatus(video, models.VideoThumbnailing, "")
+	if err := app.generateThumbnails(ctx, video, transcodeFile.Name(), keepThumbnail); err != nil {
+		return err
 	}
-	if err := os.Rename(transcodeFile.Name(), destVid); err != nil {
-		log.Error(err)
-		return
+
+	// HLS files left over once done: those of the previous run, or those
+	// of this one if it fails
+	staleHLS := ""
+	defer func() {
+		if staleHLS == "" {
+			return
+		}
+		if err := app.Storage.DeletePrefix(context.Background(), staleHLS+"/"); err != nil {
+			log.WithError(err).WithField("video", video.ID).Warn("error removing hls files")
+		}
+	}()
+
+	// packaged from the local files, before they are stored
+	hlsPath := ""
+	if app.Config.Transcoder.HLS.Enabled {
+		app.setVideoStatus(video, models.VideoPackaging, "")
+		// a new prefix each run, so cached playlists and segments never
+		// go stale
+		hlsPath = path.Join("hls", uniqueName+"-"+shortuuid.New())
+		dir, err := app.packageHLS(ctx, video, hlsPath, transcodeFile.Name(), renditions)
+		if err != nil {
+			return err
+		}
+		staleHLS = hlsPath
+		if err := app.storeHLS(hlsPath, dir); err != nil {
+			return err
+		}
+	}
+
+	for i := range renditions {
+		key := fmt.Sprintf("%s#%s.mp4", uniqueName, renditions[i].Quality)
+		if err := app.storeFile(key, renditions[i].URL); err != nil {
+			return err
+		}
+		renditions[i].URL = key
+	}
+	if err := app.storeFile(videoKey, transcodeFile.Name()); err != nil {
+		return err
+	}
+
+	// replace renditions left over from a previous attempt
+	res := app.DataBase.Where("video_id = ?", video.ID).Delete(&models.Rendition{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if len(renditions) > 0 {
+		if res := app.DataBase.Create(&renditions); res.Error != nil {
+			return res.Error
+		}
+	}
+	video.Renditions = renditions
+
+	if hlsPath != "" {
+		previous := video.HLSPath
+		res := app.DataBase.Model(video).Updates(map[string]interface{}{
+			"hls":      true,
+			"hls_path": hlsPath,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		video.HLS = true
+		video.HLSPath = hlsPath
+		staleHLS = previous
 	}
+
+	app.setVideoStatus(video, models.VideoReady, "")
+	app.indexVideo(video.ID)
 	log.Info("Video processed!")
-	defer os.Remove(tempCopy.Name())
+	return nil
 }
 
-func getVideoDuration(filename string) (int, error) {
-	cmd := fmt.Sprintf("ffmpeg -i %s 2>&1 | grep Duration | awk '{print $2}'", filename)
-	out, err := exec.Command("bash", "-c", cmd).Output()
-	if err != nil {
-		return -1, err
+// transcodes lower quality renditions of a video, one per configured size,
+// to local files stored as e.g. hd720 -> <name>#720p.mp4 once processed
+func (app *App) transcodeRenditions(ctx context.Context, video *models.Video, source, uniqueName string) ([]models.Rendition, error) {
+	sizes := make([]string, 0, len(app.Config.Transcoder.Sizes))
+	for size := range app.Config.Transcoder.Sizes {
+		sizes = append(sizes, size)
+	}
+	sort.Strings(sizes)
+
+	renditions := []models.Rendition{}
+	for _, size := range sizes {
+		suffix := app.Config.Transcoder.Sizes[size]
+		if !downscales(size, video) {
+			log.
+				WithField("size", size).
+				WithField("video", video.ID).
+				Info("skipping rendition not smaller than the video")
+			continue
+		}
+		log.
+			WithField("size", size).
+			WithField("video", video.ID).
+			Info("resizing video for lower quality playback")
+
+		dest := filepath.Join(
+			app.Config.Server.UploadPath,
+			fmt.Sprintf("tube-rendition-%s#%s.mp4", uniqueName, suffix),
+		)
+		args := []string{
+			"-y", "-i", source, "-s", size,
+			"-c:v", "libx264", "-c:a", "aac",
+			"-crf", "18", "-strict", "-2", "-loglevel", "quiet",
+			"-metadata", fmt.Sprintf("title=%s", video.Title),
+			"-metadata", fmt.Sprintf("comment=%s", video.Description),
+		}
+		args = append(args, app.hlsKeyframeArgs(video.FrameRate)...)
+		args = append(args, dest)
+		if err := utils.RunCmdContext(ctx, app.Config.Transcoder.Timeout, "ffmpeg", args...); err != nil {
+			for _, rend := range renditions {
+				os.Remove(rend.URL)
+			}
+			return nil, fmt.Errorf("error transcoding %s rendition: %w", suffix, err)
+		}
+
+		renditions = append(renditions, models.Rendition{
+			VideoID: video.ID,
+			Quality: suffix,
+			Size:    size,
+			URL:     dest,
+		})
+	}
+	return renditions, nil
+}
+
+// reports whether an ffmpeg -s size has fewer pixels than the video, so
+// that no rendition is upscaled. Unknown sizes are taken as smaller.
+func downscales(size string, video *models.Video) bool {
+	var width, height int
+	if _, err := fmt.Sscanf(sizeResolution(size), "%dx%d", &width, &height); err != nil {
+		return true
+	}
+	if video.Width <= 0 || video.Height <= 0 {
+		return true
+	}
+	return width*height < video.Width*video.Height
+}
+
+// removes rendition files and records of a video
+func (app *App) removeRenditions(video *models.Video) {
+	renditions := []models.Rendition{}
+	app.DataBase.Where("video_id = ?", video.ID).Find(&renditions)
+	for _, rend := range renditions {
+		if err := app.Storage.Delete(context.Background(), rend.URL); err != nil {
+			log.Error(err)
+		}
+	}
+	app.DataBase.Where("video_id = ?", video.ID).Delete(&models.Rendition{})
+}
+
+// updates processing status of a video
+func (app *App) setVideoStatus(video *models.Video, status, message string) {
+	video.Status = status
+	video.StatusError = message
+	res := app.DataBase.Model(video).Updates(map[string]interface{}{
+		"status":       status,
+		"status_error": message,
+	})
+	if res.Error != nil {
+		log.Error(res.Error)
 	}
-	tmstr := strings.TrimSpace(string(out[:]))
-	tmstr = strings.Trim(tmstr, ",")
+}
 
-	tm, err := time.Parse("15:04:05.00", tmstr)
-	dur := tm.Second()
-	return dur, nil
+// reads the duration, resolution, codecs etc. of a video file into video
+func (app *App) probeVideo(video *models.Video, filename string) error {
+	info, err := media.Probe(app.Config.Transcoder.ProbeTimeout, filename)
+	if err != nil {
+		return err
+	}
+	video.Duration = int(math.Round(info.Duration))
+	video.Width = info.Width
+	video.Height = info.Height
+	video.VideoCodec = info.VideoCodec
+	video.AudioCodec = info.AudioCodec
+	video.Bitrate = info.Bitrate
+	video.FrameRate = info.FrameRate
+	video.AudioChannels = info.AudioChannels
+	video.Rotation = info.Rotation
+	return nil
 }
 
 // HTTP handler for [DELETE] /api/video/id
@@ -500,24 +844,21 @@ func (app *App) apiDeleteVideoHandler(w http.ResponseWriter, r *http.Request) {
 	video := &models.Video{}
 	app.DataBase.Find(video, id)
 
-	if video.UserID != uid {
+	if video.UserID != uid && !can(r, PermDeleteAnyVideo) {
 		http.Error(w, "You are not the owner of this video", http.StatusForbidden)
 		log.Error("Deletion not permitted")
 		return
 	}
 
-	if err := os.Remove(video.URL); err != nil {
-		http.Error(w, "Error", http.StatusInternalServerError)
-		log.Error(err)
-		return
-	}
-	if err := os.Remove(video.ThumbnailURL); err != nil {
+	// files don't exist yet if the video was never processed
+	if err := app.removeVideoFiles(video); err != nil {
 		http.Error(w, "Error", http.StatusInternalServerError)
 		log.Error(err)
 		return
 	}
 
 	app.DataBase.Delete(&video)
+	app.unindexVideo(video.ID)
 }
 
 // HTTP handler for [PUT] /api/video/id
@@ -569,46 +910,45 @@ func (app *App) apiUpdateVideoInfoHandler(w http.ResponseWriter, r *http.Request
 			app.DataBase.Save(vcat);
 		}
 	}
+	app.indexVideo(vid.ID)
 
 	json.NewEncoder(w).Encode(vid)
 }
 
 
 // HTTP handler for /v/list
+// Query parameters: category, sort (newest, views, likes, duration),
+// limit, cursor
 func (app *App) listVideosHandler(w http.ResponseWriter, r *http.Request) {
-	category := getCategory(r.URL.Query())	
+	p, err := parsePage(r.URL.Query(), videoSorts, "newest")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	category := getCategory(r.URL.Query())
+
 	videos := []models.Video{}
-	if category > 0 {
-		videos = videosByCategory(category, app.DataBase)
-	} else {
-		videos = getAllVideos(app.DataBase)
+	resp, err := p.find(func() *gorm.DB {
+		query := app.DataBase.Model(&models.Video{}).
+			Where("videos.status = ?", models.VideoReady)
+		if category > 0 {
+			query = query.Where(
+				"EXISTS (SELECT 1 FROM video_categories WHERE v_id = videos.id AND c_id = ?)",
+				category,
+			)
+		}
+		return query
+	}, "videos", &videos, "Categories", "Categories.Category", "User")
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
 	}
 
-	json.NewEncoder(w).Encode(videos)
-}
-
-func videosByCategory (id int, db *gorm.DB) []models.Video  {
-	vids := make([]uint, 0)
-	db.Raw("SELECT v_id FROM video_categories WHERE c_id = ?", id).
-	   Scan(&vids)
-	
-	videos := []models.Video{}
-	db.Preload("Categories").
-		Preload("Categories.Category").
-		Preload("User").
-		Find(&videos, vids)
-
-	return videos
-}
-
-func getAllVideos (db *gorm.DB) []models.Video  {
-	videos := []models.Video{}
-	db.Preload("Categories").
-		Preload("Categories.Category").
-		Preload("User").
-		Find(&videos)
-
-	return videos
+	for i := range videos {
+		videos[i].User.Password = ""
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
 // HTTP handler for /v/best
@@ -621,6 +961,7 @@ func (app *App) bestVideosHandler(w http.ResponseWriter, r *http.Request) {
 		Preload("Categories").
 		Preload("Categories.Category").
 		Preload("User").
+		Where("status = ?", models.VideoReady).
 		Order("views desc").
 		Limit(10).
 		Find(&videos)
@@ -640,22 +981,38 @@ func (app *App) getVideoHandler(w http.ResponseWriter, r *http.Request) {
 	video := &models.Video{}
 	app.DataBase.First(video, id)
 
-	if video.ID > 0 {
-		_, filename := path.Split(video.URL)
-		disposition := `attachment; filename="` + filename + `"`
-		w.Header().Set("Content-Disposition", disposition)
-		w.Header().Set("Content-Type", "video/mp4")
-		http.ServeFile(w, r, video.URL)
-	} else {
+	if video.ID <= 0 {
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte("Video not found"))
+		return
+	}
+	if video.Status != models.VideoReady {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Video is not ready yet"))
+		return
+	}
+
+	key := video.URL
+	if quality := r.URL.Query().Get("quality"); quality != "" {
+		rend := &models.Rendition{}
+		app.DataBase.Where("video_id = ? AND quality = ?", video.ID, quality).Find(rend)
+		if rend.ID <= 0 {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Quality not available"))
+			return
+		}
+		key = rend.URL
 	}
-}
 
-func (app *App) incrementViews(vid *models.Video) {
-	log.Info("Incrementing views")
-	vid.Views++
-	app.DataBase.Save(&vid)
+	disposition := `attachment; filename="` + path.Base(key) + `"`
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Type", "video/mp4")
+	if video.SourcePath != "" && key == video.URL {
+		// library videos are served from the library path
+		http.ServeFile(w, r, key)
+		return
+	}
+	app.serveObject(w, r, key)
 }
 
 // HTTP handler for /v/id
@@ -669,22 +1026,65 @@ func (app *App) getVideoInfoHandler(w http.ResponseWriter, r *http.Request) {
 	app.DataBase.
 		Preload("Categories").
 		Preload("Categories.Category").
+		Preload("Renditions").
 		First(video, id)
 
 	if video.ID > 0 {
 		app.DataBase.First(&video.User, video.UserID)
 
+		// views not flushed yet, including this one
+		app.recordView(r, video)
+		if views, err := app.Views.GetViews(video.ID); err == nil {
+			video.Views += int(views)
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(video)
 	} else {
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte("Video not found"))
 	}
+}
 
-	defer app.incrementViews(video)
+// HTTP handler for [GET] /api/video/id/status
+// Only the owner of the video and moderators see it, as errors may tell
+// about the server.
+func (app *App) apiGetVideoStatusHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+	id := mux.Vars(r)["id"]
+
+	video := &models.Video{}
+	app.DataBase.Find(video, id)
+	if video.ID <= 0 {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		log.Info("Video not found")
+		return
+	}
+	if video.UserID != uid && !can(r, PermManageVideos) {
+		http.Error(w, "You are not the owner of this video", http.StatusForbidden)
+		log.Error("Video status not permitted")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"id":     video.ID,
+		"status": video.Status,
+		"error":  video.StatusError,
+	}
+
+	// latest background job of the video, with its progress
+	job := &models.Job{}
+	app.DataBase.Where("video_id = ?", video.ID).Order("id DESC").Limit(1).Find(job)
+	if job.ID > 0 {
+		resp["job"] = job
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 // HTTP handler for [GET] /user/id
+// Returns the user with their number of subscribers and, for authenticated
+// requests, whether the caller is subscribed.
 func (app *App) getProfileHandler(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
@@ -695,15 +1095,40 @@ func (app *App) getProfileHandler(w http.ResponseWriter, r *http.Request) {
 		log.Info("User not found")
 		return
 	}
-
 	user.Password = ""
-	json.NewEncoder(w).Encode(user)
+
+	profile := &profileResponse{User: user}
+	subscribers, err := app.countSubscribers(user.ID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	profile.Subscribers = subscribers
+	if tk, err := app.authenticate(r); err == nil {
+		subscribed, err := app.isSubscribed(tk.UserID, user.ID)
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			log.Error(err)
+			return
+		}
+		profile.Subscribed = subscribed
+	}
+
+	json.NewEncoder(w).Encode(profile)
 }
 
 // HTTP handler for [GET] /user/id/video
+// Query parameters: sort (newest, views, likes, duration), limit, cursor
 func (app *App) getUserVideosHandler(w http.ResponseWriter, r *http.Request) {
 	uid := mux.Vars(r)["id"]
 
+	p, err := parsePage(r.URL.Query(), videoSorts, "newest")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	user := &models.User{}
 	app.DataBase.Find(user, uid);
 	if user.ID <= 0 {
@@ -711,134 +1136,26 @@ func (app *App) getUserVideosHandler(w http.ResponseWriter, r *http.Request) {
 		log.Info("User not found")
 		return
 	}
+	user.Password = ""
 
-	var videos []models.Video
-	app.DataBase.Where("user_id = ?", uid).Find(&videos)
-
-	for i := range videos {
-		videos[i].User = *user
-	}
-
-	json.NewEncoder(w).Encode(videos)
-}
-
-func (app *App) apiLikeHandler(w http.ResponseWriter, r *http.Request) {
-	vID := mux.Vars(r)["id"]
-	uidCtx := r.Context().Value("userID")
-
-	like := &models.Like{}
-	app.DataBase.Table("likes").Where("uid = ? AND v_id = ?", uidCtx, vID).First(like)
-
-	video := &models.Video{}
-	app.DataBase.First(video, vID)
-	if video.ID <= 0 {
-		http.Error(w, "Video not found", http.StatusNotFound)
-		log.Info("Video not found")
+	videos := []models.Video{}
+	resp, err := p.find(func() *gorm.DB {
+		return app.DataBase.Model(&models.Video{}).
+			Where("videos.user_id = ? AND videos.status = ?", user.ID, models.VideoReady)
+	}, "videos", &videos)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
 		return
 	}
 
-	if r.Method == http.MethodPost {
-		// IF LIKE FOUND AND IT IS DISLIKE
-		if like.ID > 0 && like.IsDislike {
-			// change to like and save
-			like.IsDislike = false
-			video.Dislikes--
-			video.Likes++
-			app.DataBase.Save(like)
-			app.DataBase.Save(video)
-		} else if like.ID > 0 && !like.IsDislike {
-			// already exits
-		} else {
-			// new like
-			video.Likes++
-			like.UID = uidCtx.(uint)
-			like.VID = video.ID
-			app.DataBase.Save(like)
-			app.DataBase.Save(video)
-		}
-	} else if r.Method == http.MethodDelete {
-		// IF LIKE FOUND AND IT IS NOT DISLIKE
-		if like.ID > 0 && like.IsDislike == false {
-			video.Likes--
-			app.DataBase.Delete(like)
-			app.DataBase.Save(video)
-		} else {
-			http.Error(w, "Bad request", http.StatusBadRequest)
-			log.Info("Bad request")
-		}
-	}
-}
-
-func (app *App) apiCheckLiked(w http.ResponseWriter, r *http.Request) {
-	vID := mux.Vars(r)["id"]
-	uidCtx := r.Context().Value("userID")
-
-	like := &models.Like{}
-	app.DataBase.Table("likes").Where("uid = ? AND v_id = ?", uidCtx, vID).First(like)
-
-	video := &models.Video{}
-	app.DataBase.First(video, vID)
-	if video.ID <= 0 {
-		http.Error(w, "Video not found", http.StatusNotFound)
-		log.Info("Video not found")
-		return
+	for i := range videos {
+		videos[i].User = *user
 	}
 
-	resp := map[string]bool{
-		"liked":    (like.ID > 0 && !like.IsDislike),
-		"disliked": (like.ID > 0 && like.IsDislike),
-	}
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (app *App) apiDislikeHandler(w http.ResponseWriter, r *http.Request) {
-	vID := mux.Vars(r)["id"]
-	uidCtx := r.Context().Value("userID")
-
-	like := &models.Like {}
-	app.DataBase.Table("likes").Where("uid = ? AND v_id = ?", uidCtx, vID).First(like)
-
-	video := &models.Video{}
-	app.DataBase.First(video, vID)
-	if video.ID <= 0 {
-		http.Error(w, "Video not found", http.StatusBadRequest)
-		log.Info("Video not found")
-		return
-	}
-
-	if r.Method == http.MethodPost {
-		// IF LIKE FOUND AND IT IS NOT DISLIKE
-		if like.ID > 0 && like.IsDislike == false {
-			// change to like and save
-			like.IsDislike = false
-			video.Dislikes++
-			video.Likes--
-			app.DataBase.Save(like)
-			app.DataBase.Save(video)
-		} else if like.ID > 0 && like.IsDislike {
-			// already exits
-		} else {
-			// new dislike
-			video.Dislikes++
-			like.IsDislike = true
-			like.UID = uidCtx.(uint)
-			like.VID = video.ID
-			app.DataBase.Save(like)
-			app.DataBase.Save(video)
-		}
-	} else if r.Method == http.MethodDelete {
-		// IF LIKE FOUND AND IT IS DISLIKE
-		if like.ID > 0 && like.IsDislike {
-			video.Dislikes--
-			app.DataBase.Delete(like)
-			app.DataBase.Save(video)
-		} else {
-			http.Error(w, "Bad request", http.StatusBadRequest)
-			log.Info("Bad request")
-		}
-	}
-}
-
 // HTTP handler for [POST] /api/comment/
 func (app *App) apiCreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 	uidCtx := r.Context().Value("userID")
@@ -851,7 +1168,18 @@ func (app *App) apiCreateCommentHandler(w http.ResponseWriter, r *http.Request)
 		log.Info(err)
 		return
 	}
+	// a client-supplied id would overwrite that comment
+	comment.ID = 0
 	comment.UserID = uidCtx.(uint)
+	comment.ReplyCount = 0
+	comment.LikeCount = 0
+	comment.Score = 0
+	comment.Hearted = false
+	comment.Pinned = false
+	comment.CreatedAt = time.Time{}
+	comment.UpdatedAt = time.Time{}
+	comment.EditedAt = nil
+	comment.DeletedAt = nil
 
 	log.Info(fmt.Sprintf("Creating comment %s", comment.Text))
 
@@ -868,7 +1196,7 @@ func (app *App) apiCreateCommentHandler(w http.ResponseWriter, r *http.Request)
 	if (comment.ReplyTo.Int64 > 0) {
 		refcomm := &models.Comment{}
 		app.DataBase.Find(refcomm, comment.ReplyTo);
-		if refcomm.ID <= 0 {
+		if refcomm.ID <= 0 || refcomm.DeletedAt != nil || refcomm.VideoID != comment.VideoID {
 			http.Error(w, "Refrenced comment not found", http.StatusBadRequest)
 			log.Info("Refrenced comment not found")
 			return
@@ -876,90 +1204,361 @@ func (app *App) apiCreateCommentHandler(w http.ResponseWriter, r *http.Request)
 	} else {
 		comment.ReplyTo.Valid = false
 	}
-	res := app.DataBase.Save(comment)
-	
-	if res.Error != nil {
-		http.Error(w, res.Error.Error(), http.StatusInternalServerError)
-		log.Error(res.Error)
+	err = app.DataBase.Transaction(func(tx *gorm.DB) error {
+		if res := tx.Create(comment); res.Error != nil {
+			return res.Error
+		}
+		if !comment.ReplyTo.Valid {
+			return nil
+		}
+		return tx.Model(&models.Comment{}).
+			Where("id = ?", comment.ReplyTo).
+			UpdateColumns(map[string]interface{}{
+				"reply_count": gorm.Expr("reply_count + 1"),
+				"score":       gorm.Expr("score + 1"),
+			}).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Error(err)
 		return
 	}
+	app.indexComment(comment.ID)
 	json.NewEncoder(w).Encode(comment)
 }
 
+var errCommentDeleted = errors.New("comment already deleted")
+
+// HTTP handler for [DELETE] /api/comment/{id}
+// A comment may be deleted by its author, the owner of the video or a
+// moderator. Its text is replaced so that the replies stay in place.
 func (app *App) apiDeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
 	commID := mux.Vars(r)["id"]
 
 	comment := &models.Comment{}
 	app.DataBase.Find(comment, commID)
-	if comment.ID <= 0 {
-		http.Error(w, "Comment not found", http.StatusBadRequest)
+	if comment.ID <= 0 || comment.DeletedAt != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
 		log.Info("Comment not found")
 		return
 	}
 
-	app.DataBase.Delete(&comment)
+	video := &models.Video{}
+	app.DataBase.Find(video, comment.VideoID)
+
+	var reason string
+	switch {
+	case comment.UserID == uid:
+		reason = "author"
+	case video.UserID == uid:
+		reason = "video_owner"
+	case can(r, PermDeleteAnyComment):
+		reason = "moderator"
+	default:
+		http.Error(w, "You are not allowed to delete this comment", http.StatusForbidden)
+		log.Error("Comment deletion not permitted")
+		return
+	}
+
+	log.Info(fmt.Sprintf("Deleting comment %d (by %s %d)", comment.ID, reason, uid))
+	text := comment.Text
+	err := app.DataBase.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(comment).
+			Where("deleted_at IS NULL").
+			Updates(map[string]interface{}{
+				"text":       models.DeletedCommentText,
+				"pinned":     false,
+				"deleted_at": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return errCommentDeleted
+		}
+		// a deleted comment stays listed only while it has replies
+		if comment.ReplyTo.Valid {
+			var replies int64
+			res := tx.Model(&models.Comment{}).Where("reply_to = ?", comment.ID).Count(&replies)
+			if res.Error != nil {
+				return res.Error
+			}
+			if replies == 0 {
+				res := tx.Model(&models.Comment{}).
+					Where("id = ?", comment.ReplyTo).
+					UpdateColumns(map[string]interface{}{
+						"reply_count": gorm.Expr("reply_count - 1"),
+						"score":       gorm.Expr("score - 1"),
+					})
+				if res.Error != nil {
+					return res.Error
+				}
+			}
+		}
+
+		return audit(tx, uid, auditDeleteComment, "comment", comment.ID, map[string]interface{}{
+			"videoId":  comment.VideoID,
+			"authorId": comment.UserID,
+			"text":     text,
+			"reason":   reason,
+		})
+	})
+	if err == errCommentDeleted {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	app.unindexComment(comment.ID)
 
+	app.DataBase.Find(comment, comment.ID)
+	redactComment(comment)
 	json.NewEncoder(w).Encode(comment)
 }
 
+// hides the author of a deleted comment
+func redactComment(comment *models.Comment) {
+	if comment.DeletedAt == nil {
+		return
+	}
+	comment.Text = models.DeletedCommentText
+	comment.EditedAt = nil
+	comment.Hearted = false
+	comment.UserID = 0
+	comment.User = models.User{}
+}
+
 // HTTP handler for [GET] /api/comment/{id}
+// Replies are listed by /api/comment/{id}/replies.
 func (app *App) apiGetCommentHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+	app.writeComment(w, mux.Vars(r)["id"], uid)
+}
+
+// HTTP handler for [GET] /api/comment/{id}/replies
+// Query parameters: sort (oldest, newest, top), limit, cursor
+func (app *App) apiGetCommentRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
 	commID := mux.Vars(r)["id"]
 
+	p, err := parsePage(r.URL.Query(), commentSorts, "oldest")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	comment := &models.Comment{}
 	app.DataBase.Find(comment, commID)
 	if comment.ID <= 0 {
-		http.Error(w, "Comment not found", http.StatusBadRequest)
+		http.Error(w, "Comment not found", http.StatusNotFound)
 		log.Info("Comment not found")
 		return
 	}
 
-	res := app.DataBase.
-		Table("comments").
-		Where("reply_to = ? AND deleted_at IS NULL", comment.ID).
-		Scan(&comment.Replies)
+	app.writeComments(w, p, uid, false, func() *gorm.DB {
+		return app.DataBase.Model(&models.Comment{}).
+			Where("reply_to = ? AND "+visibleComments, comment.ID)
+	})
+}
+
+// HTTP handler for [PUT] /api/comment/{id}
+// Only the author may edit a comment, which is then marked as edited.
+func (app *App) apiEditCommentHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+	commID := mux.Vars(r)["id"]
+
+	req := struct {
+		Text string `json:"text"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	comment := &models.Comment{}
+	app.DataBase.Find(comment, commID)
+	if comment.ID <= 0 || comment.DeletedAt != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		log.Info("Comment not found")
+		return
+	}
+	if comment.UserID != uid {
+		http.Error(w, "You are not allowed to edit this comment", http.StatusForbidden)
+		return
+	}
+
+	res := app.DataBase.Model(comment).
+		Where("deleted_at IS NULL").
+		Updates(map[string]interface{}{
+			"text":      req.Text,
+			"edited_at": time.Now(),
+		})
 	if res.Error != nil {
-		http.Error(w, res.Error.Error(), http.StatusInternalServerError)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
 		log.Error(res.Error)
 		return
 	}
-
-	comment.ReplyCount = len(comment.Replies)
-	for i := range comment.Replies {
-		app.DataBase.Find(&comment.Replies[i].User, comment.Replies[i].UserID)
-		app.DataBase.
-			Raw("SELECT COUNT(*) FROM comments WHERE reply_to = ? AND deleted_at IS NULL;", comment.Replies[i].ID).
-			Scan(&comment.Replies[i].ReplyCount)
+	if res.RowsAffected != 1 {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
 	}
+	app.indexComment(comment.ID)
 
-	json.NewEncoder(w).Encode(comment);
+	app.writeComment(w, comment.ID, uid)
 }
 
 // HTTP handler for [GET] /api/video/{id}/comments
-// This thing is really slooow
+// Query parameters: sort (oldest, newest, top), limit, cursor
+// The pinned comment, if any, comes first on the first page.
 func (app *App) apiGetVideoCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
 	vID := mux.Vars(r)["id"]
 
+	p, err := parsePage(r.URL.Query(), commentSorts, "oldest")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app.writeComments(w, p, uid, true, func() *gorm.DB {
+		return app.DataBase.Model(&models.Comment{}).
+			Where("video_id = ? AND reply_to IS NULL AND "+visibleComments, vID)
+	})
+}
+
+// writes a page of the comments matched by query as listed to user uid,
+// with the pinned one first if pinFirst is set. The pinned comment takes a
+// place on the first page and is left out of the others. The page takes
+// the same few queries however many comments it has: the pinned comment,
+// the count, the comments (with their counters), the authors and uid's
+// likes.
+func (app *App) writeComments(w http.ResponseWriter, p *page, uid uint, pinFirst bool, query func() *gorm.DB) {
+	pinned := []models.Comment{}
+	if pinFirst {
+		if res := query().Where("pinned = ?", true).Limit(1).Find(&pinned); res.Error != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			log.Error(res.Error)
+			return
+		}
+	}
+
+	find := query
+	if len(pinned) > 0 {
+		find = func() *gorm.DB {
+			return query().Where("comments.id <> ?", pinned[0].ID)
+		}
+		if p.Cursor == nil {
+			first := *p
+			first.Limit--
+			p = &first
+		}
+	}
+
 	comments := []models.Comment{}
+	resp, err := p.find(find, "comments", &comments)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	if len(pinned) > 0 {
+		resp.Total++
+		if p.Cursor == nil {
+			comments = append(pinned, comments...)
+		}
+	}
 
-	res := app.DataBase.
-		Table("comments").
-		Where("video_id = ? AND reply_to IS NULL AND deleted_at IS NULL", vID).
-		Scan(&comments)
-	if res.Error != nil {
-		http.Error(w, res.Error.Error(), http.StatusInternalServerError)
+	if err := app.loadCommentDetails(comments, uid); err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	resp.Items = comments
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writes a single comment as listed to user uid
+func (app *App) writeComment(w http.ResponseWriter, id interface{}, uid uint) {
+	comments := []models.Comment{}
+	if res := app.DataBase.Where("id = ?", id).Limit(1).Find(&comments); res.Error != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
 		log.Error(res.Error)
 		return
 	}
+	if len(comments) == 0 {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		log.Info("Comment not found")
+		return
+	}
+	if err := app.loadCommentDetails(comments, uid); err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
 
+	json.NewEncoder(w).Encode(&comments[0])
+}
+
+// visibleComments matches comments that are listed: deleted comments are
+// only shown (as a placeholder) while they have replies.
+const visibleComments = "(deleted_at IS NULL OR EXISTS " +
+	"(SELECT 1 FROM comments AS r WHERE r.reply_to = comments.id))"
+
+// loads the authors of listed comments and whether user uid liked them,
+// a query each, hiding the authors of deleted comments
+func (app *App) loadCommentDetails(comments []models.Comment, uid uint) error {
+	ids := []uint{}
+	userIDs := []uint{}
 	for i := range comments {
-		app.DataBase.Find(&comments[i].User, comments[i].UserID)
-		app.DataBase.
-			Raw("SELECT COUNT(*) FROM comments WHERE reply_to = ? AND deleted_at IS NULL;", comments[i].ID).
-			Scan(&comments[i].ReplyCount)
+		redactComment(&comments[i])
+		ids = append(ids, comments[i].ID)
+		if comments[i].DeletedAt == nil {
+			userIDs = append(userIDs, comments[i].UserID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
 	}
 
-	json.NewEncoder(w).Encode(comments)
+	if len(userIDs) > 0 {
+		users := []models.User{}
+		if res := app.DataBase.Where("id IN ?", userIDs).Find(&users); res.Error != nil {
+			return res.Error
+		}
+		byID := make(map[uint]models.User, len(users))
+		for _, user := range users {
+			user.Password = ""
+			byID[user.ID] = user
+		}
+		for i := range comments {
+			if comments[i].DeletedAt == nil {
+				comments[i].User = byID[comments[i].UserID]
+			}
+		}
+	}
+
+	liked := []uint{}
+	res := app.DataBase.
+		Model(&models.CommentLike{}).
+		Where("user_id = ? AND comment_id IN ?", uid, ids).
+		Pluck("comment_id", &liked)
+	if res.Error != nil {
+		return res.Error
+	}
+	likedIDs := make(map[uint]bool, len(liked))
+	for _, id := range liked {
+		likedIDs[id] = true
+	}
+	for i := range comments {
+		comments[i].Liked = likedIDs[comments[i].ID]
+	}
+	return nil
 }
 
 // HTTP handler for [GET] /api/category
@@ -977,23 +1576,67 @@ func (app *App) apiGetCategoriesHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(categs)
 }
 
+// HTTP handler for [POST] /admin/category
+func (app *App) adminCreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	categ := &models.Category{}
+	if err := json.NewDecoder(r.Body).Decode(categ); err != nil || categ.Title == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	categ.ID = 0
+
+	res := app.DataBase.Create(categ)
+	if res.Error != nil {
+		http.Error(w, "Failed to create category", http.StatusInternalServerError)
+		log.Error(res.Error)
+		return
+	}
+
+	json.NewEncoder(w).Encode(categ)
+}
+
+// HTTP handler for [DELETE] /admin/category/id
+func (app *App) adminDeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	log.Info(fmt.Sprintf("Deleting a category; id = %s", id))
+
+	categ := &models.Category{}
+	app.DataBase.Find(categ, id)
+	if categ.ID <= 0 {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	// video_categories rows are removed by the foreign key cascade
+	res := app.DataBase.Delete(categ)
+	if res.Error != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(res.Error)
+		return
+	}
+}
+
 // HTTP handler for [GET] /admin/user
+// Query parameters: sort (newest, oldest), limit, cursor
 func (app *App) apiAdminGetUsersHandler(w http.ResponseWriter, r *http.Request) {
-	offset, limit := getOffsetAndLimit(r.URL.Query())
-	users := []models.User{}
-	app.DataBase.Limit(limit).Offset(offset).
-				 Find(&users)
+	p, err := parsePage(r.URL.Query(), userSorts, "newest")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	var total int
-	app.DataBase.
-		Raw("SELECT COUNT(*) FROM users WHERE deleted_at IS NULL").
-		Scan(&total)
+	users := []models.User{}
+	resp, err := p.find(func() *gorm.DB {
+		return app.DataBase.Model(&models.User{})
+	}, "users", &users)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
 
-	var resp = map[string]interface{}{
-		"total": total, 
-		"offset": offset,
-		"count": len(users),
-		"users": users,
+	for i := range users {
+		users[i].Password = ""
 	}
 	json.NewEncoder(w).Encode(resp);
 }
@@ -1007,6 +1650,7 @@ func (app *App) adminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	app.DataBase.Find(user, id)
 
 	app.DataBase.Delete(&user)
+	app.unindexUser(user.ID)
 }
 
 // HTTP handler for [DELETE] /admin/video/id
@@ -1017,18 +1661,15 @@ func (app *App) adminDeleteVideoHandler(w http.ResponseWriter, r *http.Request)
 	video := &models.Video{}
 	app.DataBase.Find(video, id)
 
-	if err := os.Remove(video.URL); err != nil {
-		http.Error(w, "Error", http.StatusInternalServerError)
-		log.Error(err)
-		return
-	}
-	if err := os.Remove(video.ThumbnailURL); err != nil {
+	// files don't exist yet if the video was never processed
+	if err := app.removeVideoFiles(video); err != nil {
 		http.Error(w, "Error", http.StatusInternalServerError)
 		log.Error(err)
 		return
 	}
 
 	app.DataBase.Delete(&video)
+	app.unindexVideo(video.ID)
 }
 
 // HTTP handler for [GET] /admin/user/chart
@@ -1050,52 +1691,27 @@ func (app *App) adminGetUserChartHandler(w http.ResponseWriter, r *http.Request)
 }
 
 // HTTP handler for [GET] /admin/video
+// Lists videos in any state. Query parameters: sort (newest, views,
+// likes, duration), limit, cursor
 func (app *App) apiAdminGetVideosHandler(w http.ResponseWriter, r *http.Request) {
-	offset, limit := getOffsetAndLimit(r.URL.Query())
-	videos := []models.Video{}
-	app.DataBase.Limit(limit).Offset(offset).
-				 Preload("User").
-				 Find(&videos)
+	p, err := parsePage(r.URL.Query(), videoSorts, "newest")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	var total int
-	app.DataBase.
-		Raw("SELECT COUNT(*) FROM videos WHERE deleted_at IS NULL").
-		Scan(&total)
+	videos := []models.Video{}
+	resp, err := p.find(func() *gorm.DB {
+		return app.DataBase.Model(&models.Video{})
+	}, "videos", &videos, "User")
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
 
-	var resp = map[string]interface{}{
-		"total": total, 
-		"offset": offset,
-		"count": len(videos),
-		"videos": videos,
+	for i := range videos {
+		videos[i].User.Password = ""
 	}
 	json.NewEncoder(w).Encode(resp);
 }
-
-
-// TODO: Make this a background job
-// Resize for lower quality options
-// for size, suffix := range app.Config.Transcoder.Sizes {
-// 	log.
-// 		WithField("size", size).
-// 		WithField("vf", filepath.Base(vf)).
-// 		Info("resizing video for lower quality playback")
-// 	sf := fmt.Sprintf(
-// 		"%s#%s.mp4",
-// 		strings.TrimSuffix(vf, filepath.Ext(vf)),
-// 		suffix,
-// 	)
-// 	if err := utils.RunCmd(
-// 		app.Config.Transcoder.Timeout,
-// 		"ffmpeg", "-y", "-i", vf, "-s", size,
-// 		"-c:v", "libx264", "-c:a", "aac",
-// 		"-crf", "18", "-strict", "-2", "-loglevel", "quiet",
-// 		"-metadata", fmt.Sprintf("title=%s", title),
-// 		"-metadata", fmt.Sprintf("comment=%s", description),
-// 		sf,
-// 	); err != nil {
-// 		err := fmt.Errorf("error transcoding video: %w", err)
-// 		log.Error(err)
-// 		http.Error(w, err.Error(), http.StatusInternalServerError)
-// 		return
-// 	}
-// }
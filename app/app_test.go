@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/search"
+	"gorm.io/gorm"
+)
+
+// newTestDB connects to a new, empty sqlite database
+func newTestDB(t *testing.T) (*Config, *gorm.DB) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "tube-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cfg := DefaultConfig()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.DSN = filepath.Join(dir, "tube.sqlite")
+	cfg.Server.UploadPath = filepath.Join(dir, "uploads")
+	cfg.Server.StorePath = filepath.Join(dir, "store")
+	cfg.Search.Path = filepath.Join(dir, "search.bleve")
+
+	db, err := ConnectDB(cfg.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return cfg, db
+}
+
+// newTestApp returns an app on a new, migrated sqlite database
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+
+	cfg, db := newTestDB(t)
+	migrator, err := NewMigrator(db, cfg.Database.Driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	// jobs are enqueued but not run
+	jobs := newJobQueue(cfg.Jobs)
+	jobs.db = db
+
+	index, err := search.Open(search.BackendBleve, cfg.Search.Path, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { index.Close() })
+
+	return &App{Config: cfg, DataBase: db, Jobs: jobs, Search: index}
+}
+
+// newTestUser creates a user named name
+func newTestUser(t *testing.T, app *App, name string) *models.User {
+	t.Helper()
+	user := &models.User{Name: name, Email: name + "@example.com", Password: "secret", Role: models.RoleUploader}
+	if err := app.DataBase.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// newTestVideo creates a ready video of user uid
+func newTestVideo(t *testing.T, app *App, uid uint) *models.Video {
+	t.Helper()
+	video := &models.Video{UserID: uid, Title: "video", URL: "videos/video.mp4", Status: models.VideoReady}
+	if err := app.DataBase.Create(video).Error; err != nil {
+		t.Fatal(err)
+	}
+	return video
+}
+
+// newTestRequest returns a request as authenticated by protect for user
+// uid, with the given route variables
+func newTestRequest(method, target, body string, uid uint, vars map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r = mux.SetURLVars(r, vars)
+	ctx := context.WithValue(r.Context(), "userID", uid)
+	ctx = context.WithValue(ctx, "role", models.RoleUploader)
+	return r.WithContext(ctx)
+}
+
+// serve calls handler with r and decodes its JSON response into v, failing
+// unless the response has status code
+func serve(t *testing.T, handler http.HandlerFunc, r *http.Request, code int, v interface{}) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != code {
+		t.Fatalf("%s %s: got status %d, want %d: %s", r.Method, r.URL, w.Code, code, w.Body)
+	}
+	if v != nil {
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: decoding response: %s", r.Method, r.URL, err)
+		}
+	}
+}
+
+func id(v uint) map[string]string {
+	return map[string]string{"id": fmt.Sprint(v)}
+}
+
+func TestSqliteDSN(t *testing.T) {
+	tests := []struct {
+		dsn, want string
+	}{
+		{"tube.sqlite", "tube.sqlite?_foreign_keys=1"},
+		{"file:tube.sqlite?cache=shared", "file:tube.sqlite?cache=shared&_foreign_keys=1"},
+		{"tube.sqlite?_foreign_keys=0", "tube.sqlite?_foreign_keys=0"},
+		{"tube.sqlite?_fk=1", "tube.sqlite?_fk=1"},
+	}
+	for _, test := range tests {
+		if got := sqliteDSN(test.dsn); got != test.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", test.dsn, got, test.want)
+		}
+	}
+}
+
+func TestConnectDBWithoutDSN(t *testing.T) {
+	cfg := DefaultConfig()
+	if cfg.Database.Driver != "sqlite" || cfg.Database.DSN != "" {
+		t.Errorf("got default database %s %q, want sqlite without DSN", cfg.Database.Driver, cfg.Database.DSN)
+	}
+
+	cfg.Database.Driver = "mysql"
+	_, err := ConnectDB(cfg.Database)
+	if err == nil || !strings.Contains(err.Error(), "TUBE_DB_DSN") {
+		t.Errorf("got %v connecting to mysql without DSN, want to be told to set it", err)
+	}
+}
+
+func TestConnectDBForeignKeys(t *testing.T) {
+	app := newTestApp(t)
+
+	sqlDB, err := app.DataBase.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// make the pool replace its connection, as a lifetime would
+	sqlDB.SetConnMaxLifetime(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	var enabled int
+	if err := app.DataBase.Raw("PRAGMA foreign_keys").Scan(&enabled).Error; err != nil {
+		t.Fatal(err)
+	}
+	if enabled != 1 {
+		t.Fatalf("foreign_keys = %d on a new connection, want 1", enabled)
+	}
+
+	comment := &models.Comment{UserID: 42, VideoID: 42, Text: "orphan"}
+	if err := app.DataBase.Create(comment).Error; err == nil {
+		t.Fatal("created a comment of a missing video and user")
+	}
+}
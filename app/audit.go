@@ -0,0 +1,68 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/prologic/tube/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Audited actions
+const (
+	auditDeleteComment = "comment.delete"
+)
+
+// records that actor performed action on a target. detail is stored as JSON.
+func audit(tx *gorm.DB, actor uint, action, targetType string, targetID uint, detail interface{}) error {
+	data, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.AuditLog{
+		ActorID:    actor,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Detail:     string(data),
+	}).Error
+}
+
+// HTTP handler for [GET] /admin/audit
+// Query parameters: action, actor, target_type, target_id, sort (newest,
+// oldest), limit, cursor
+func (app *App) adminGetAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	p, err := parsePage(q, auditSorts, "newest")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	logs := []models.AuditLog{}
+	resp, err := p.find(func() *gorm.DB {
+		query := app.DataBase.Model(&models.AuditLog{})
+		if action := q.Get("action"); action != "" {
+			query = query.Where("action = ?", action)
+		}
+		if actor, err := strconv.Atoi(q.Get("actor")); err == nil {
+			query = query.Where("actor_id = ?", actor)
+		}
+		if targetType := q.Get("target_type"); targetType != "" {
+			query = query.Where("target_type = ?", targetType)
+		}
+		if targetID, err := strconv.Atoi(q.Get("target_id")); err == nil {
+			query = query.Where("target_id = ?", targetID)
+		}
+		return query
+	}, "audit_logs", &logs)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
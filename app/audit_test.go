@@ -0,0 +1,57 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prologic/tube/models"
+)
+
+// auditPage is a page of the audit log
+type auditPage struct {
+	Items      []models.AuditLog `json:"items"`
+	NextCursor string            `json:"nextCursor"`
+	Total      int64             `json:"total"`
+}
+
+func TestGetAuditLog(t *testing.T) {
+	app := newTestApp(t)
+	for i := uint(1); i <= 3; i++ {
+		if err := audit(app.DataBase, 1, auditDeleteComment, "comment", i, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := audit(app.DataBase, 2, "video.delete", "video", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	targets := func(logs []models.AuditLog) []uint {
+		ids := []uint{}
+		for _, l := range logs {
+			ids = append(ids, l.TargetID)
+		}
+		return ids
+	}
+
+	page := &auditPage{}
+	r := newTestRequest("GET", "/?action=comment.delete&limit=2", "", 0, nil)
+	serve(t, app.adminGetAuditLogHandler, r, 200, page)
+	if got := fmt.Sprint(targets(page.Items)); got != "[3 2]" || page.Total != 3 || page.NextCursor == "" {
+		t.Fatalf("got %s of %d, want [3 2] of 3 and a next page", got, page.Total)
+	}
+
+	r = newTestRequest("GET", "/?action=comment.delete&limit=2&cursor="+page.NextCursor, "", 0, nil)
+	page = &auditPage{}
+	serve(t, app.adminGetAuditLogHandler, r, 200, page)
+	if got := fmt.Sprint(targets(page.Items)); got != "[1]" || page.NextCursor != "" {
+		t.Errorf("got %s on the next page, want [1] and no more", got)
+	}
+
+	page = &auditPage{}
+	serve(t, app.adminGetAuditLogHandler, newTestRequest("GET", "/?sort=oldest", "", 0, nil), 200, page)
+	if got := fmt.Sprint(targets(page.Items)); got != "[1 2 3 1]" {
+		t.Errorf("got %s oldest first, want [1 2 3 1]", got)
+	}
+
+	serve(t, app.adminGetAuditLogHandler, newTestRequest("GET", "/?sort=views", "", 0, nil), 400, nil)
+}
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/prologic/tube/models"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errNoToken = errors.New("Token is not provided")
+
+// keyRing holds the keys used to sign and verify access tokens. Tokens are
+// signed with the active key; any configured key is accepted for
+// verification so keys can be rotated without logging everyone out.
+type keyRing struct {
+	active *SigningKey
+	keys   map[string][]byte
+}
+
+func newKeyRing(cfg *AuthConfig) (*keyRing, error) {
+	ring := &keyRing{keys: make(map[string][]byte)}
+
+	for _, key := range cfg.SigningKeys {
+		if key.ID == "" || key.Secret == "" {
+			return nil, fmt.Errorf("signing keys need both an id and a secret")
+		}
+		if _, ok := ring.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key id: %s", key.ID)
+		}
+		ring.keys[key.ID] = []byte(key.Secret)
+		if key.ID == cfg.ActiveKey || (cfg.ActiveKey == "" && ring.active == nil) {
+			ring.active = key
+		}
+	}
+
+	if len(ring.keys) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		log.Warn("No signing keys configured, using a random key. Tokens won't survive a restart!")
+		ring.active = &SigningKey{ID: "ephemeral", Secret: string(secret)}
+		ring.keys[ring.active.ID] = secret
+	}
+	if ring.active == nil {
+		return nil, fmt.Errorf("active signing key %s not found", cfg.ActiveKey)
+	}
+
+	return ring, nil
+}
+
+// Sign returns a HS256 token for claims with the active key id in its header
+func (k *keyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = k.active.ID
+	return token.SignedString([]byte(k.active.Secret))
+}
+
+// Parse verifies a token against the key named by its kid header
+func (k *keyRing) Parse(tokenString string) (*models.UserClaims, error) {
+	claims := &models.UserClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		secret, ok := k.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+		return secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// HTTP handler for /auth/login
+func (app *App) loginHandler(w http.ResponseWriter, r *http.Request) {
+	log.Info("[POST] /auth/login")
+	user := &models.User{}
+	err := json.NewDecoder(r.Body).Decode(user)
+	if err != nil {
+		http.Error(w, "Login failed", http.StatusBadRequest)
+		log.Error(err)
+		return
+	}
+
+	resp, err := app.findUser(user.Name, user.Password)
+	if err != nil {
+		http.Error(w, "Login failed", http.StatusBadRequest)
+		log.Error(err)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (app *App) findUser(name, password string) (map[string]interface{}, error) {
+	user := &models.User{}
+	err := app.DataBase.Where("name = ?", name).First(user).Error
+	if err != nil {
+		return nil, fmt.Errorf("User name not found")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid login credentials. Please try again")
+	}
+
+	resp, err := app.issueTokens(user)
+	if err != nil {
+		return nil, err
+	}
+	resp["message"] = "Logged in successfully!"
+	return resp, nil
+}
+
+// issues a new access token and refresh token pair for user
+func (app *App) issueTokens(user *models.User) (map[string]interface{}, error) {
+	ttl := time.Duration(app.Config.Auth.AccessTokenTTL) * time.Second
+	claims := &models.UserClaims{
+		UserID: user.ID,
+		Name:   user.Name,
+		Email:  user.Email,
+		Role:   user.Role,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+	}
+	tokenString, err := app.Keys.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("error signing token: %w", err)
+	}
+
+	refreshToken, err := app.createRefreshToken(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	var resp = map[string]interface{}{"status": true}
+	resp["token"] = tokenString // Store the token in the response
+	resp["expiresIn"] = app.Config.Auth.AccessTokenTTL
+	resp["refreshToken"] = refreshToken
+	resp["user"] = user
+	return resp, nil
+}
+
+// stores a new refresh token for uid; only its hash is kept server-side
+func (app *App) createRefreshToken(uid uint) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	ttl := time.Duration(app.Config.Auth.RefreshTokenTTL) * time.Second
+	res := app.DataBase.Create(&models.RefreshToken{
+		UserID:    uid,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if res.Error != nil {
+		return "", fmt.Errorf("error storing refresh token: %w", res.Error)
+	}
+	return token, nil
+}
+
+// revokes a refresh token, returning the revoked record
+func (app *App) revokeRefreshToken(token string) (*models.RefreshToken, error) {
+	rt := &models.RefreshToken{}
+	app.DataBase.Where("token_hash = ?", hashToken(token)).Find(rt)
+	if rt.ID <= 0 || rt.RevokedAt != nil || rt.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+
+	// the revoked_at check makes concurrent use of one token fail
+	res := app.DataBase.Model(rt).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 1 {
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	return rt, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HTTP handler for [POST] /auth/refresh
+// Exchanges a refresh token for a new token pair; the old one is revoked.
+func (app *App) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		RefreshToken string `json:"refreshToken"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	rt, err := app.revokeRefreshToken(req.RefreshToken)
+	if err != nil {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		log.Info(err)
+		return
+	}
+
+	user := &models.User{}
+	app.DataBase.Find(user, rt.UserID)
+	if user.ID <= 0 {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		log.Info("User not found")
+		return
+	}
+
+	resp, err := app.issueTokens(user)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HTTP handler for [POST] /auth/logout
+func (app *App) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		RefreshToken string `json:"refreshToken"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := app.revokeRefreshToken(req.RefreshToken); err != nil {
+		log.Info(err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// returns the verified claims of the request's access token
+func (app *App) authenticate(r *http.Request) (*models.UserClaims, error) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	header = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	if header == "" {
+		return nil, errNoToken
+	}
+	return app.Keys.Parse(header)
+}
@@ -0,0 +1,182 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// setCommentLike makes user uid like a comment or not. As with video
+// reactions the like count and score change by what was actually changed,
+// in the same transaction as the comment_likes row.
+func (app *App) setCommentLike(commentID, uid uint, liked bool) error {
+	return app.DataBase.Transaction(func(tx *gorm.DB) error {
+		var res *gorm.DB
+		delta := 1
+		if liked {
+			// the unique (comment_id, user_id) index keeps a second like out
+			res = tx.
+				Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.CommentLike{CommentID: commentID, UserID: uid})
+		} else {
+			res = tx.
+				Where("comment_id = ? AND user_id = ?", commentID, uid).
+				Delete(&models.CommentLike{})
+			delta = -1
+		}
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		res = tx.
+			Model(&models.Comment{}).
+			Where("id = ?", commentID).
+			UpdateColumns(map[string]interface{}{
+				"like_count": gorm.Expr("like_count + ?", delta),
+				"score":      gorm.Expr("score + ?", delta),
+			})
+		return res.Error
+	})
+}
+
+// HTTP handler for [PUT] /api/comment/id/like: likes the comment or, with
+// {"liked": false}, takes the like back
+func (app *App) apiLikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+
+	req := struct {
+		Liked bool `json:"liked"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	comment := &models.Comment{}
+	app.DataBase.Find(comment, mux.Vars(r)["id"])
+	if comment.ID <= 0 || comment.DeletedAt != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	}
+
+	if err := app.setCommentLike(comment.ID, uid, req.Liked); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	app.writeComment(w, comment.ID, uid)
+}
+
+// finds the comment a request is about and checks that the user owns its
+// video; writes an error and returns nil otherwise
+func (app *App) findOwnedComment(w http.ResponseWriter, r *http.Request) *models.Comment {
+	uid := r.Context().Value("userID").(uint)
+
+	comment := &models.Comment{}
+	app.DataBase.Find(comment, mux.Vars(r)["id"])
+	if comment.ID <= 0 || comment.DeletedAt != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return nil
+	}
+
+	video := &models.Video{}
+	app.DataBase.Find(video, comment.VideoID)
+	if video.UserID != uid {
+		http.Error(w, "You are not the owner of this video", http.StatusForbidden)
+		return nil
+	}
+	return comment
+}
+
+// HTTP handler for [PUT] /api/comment/id/heart: the owner of the video
+// hearts the comment or, with {"hearted": false}, takes the heart back
+func (app *App) apiHeartCommentHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+
+	req := struct {
+		Hearted bool `json:"hearted"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	comment := app.findOwnedComment(w, r)
+	if comment == nil {
+		return
+	}
+
+	res := app.DataBase.Model(comment).UpdateColumn("hearted", req.Hearted)
+	if res.Error != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(res.Error)
+		return
+	}
+
+	app.writeComment(w, comment.ID, uid)
+}
+
+// reports whether a comment of video videoID other than commentID is pinned
+func (app *App) hasPinnedComment(videoID, commentID uint) bool {
+	var n int64
+	app.DataBase.Model(&models.Comment{}).
+		Where("video_id = ? AND pinned = ? AND id <> ?", videoID, true, commentID).
+		Count(&n)
+	return n > 0
+}
+
+// HTTP handler for [PUT] /api/comment/id/pin: the owner of the video pins
+// a top-level comment, unpinning the one pinned before, or unpins it with
+// {"pinned": false}
+func (app *App) apiPinCommentHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+
+	req := struct {
+		Pinned bool `json:"pinned"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	comment := app.findOwnedComment(w, r)
+	if comment == nil {
+		return
+	}
+	if req.Pinned && comment.ReplyTo.Valid {
+		http.Error(w, "Only top-level comments can be pinned", http.StatusBadRequest)
+		return
+	}
+
+	err := app.DataBase.Transaction(func(tx *gorm.DB) error {
+		if req.Pinned {
+			// a video has a single pinned comment, which a unique index
+			// enforces against concurrent requests
+			res := tx.Model(&models.Comment{}).
+				Where("video_id = ? AND pinned = ?", comment.VideoID, true).
+				UpdateColumn("pinned", false)
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		return tx.Model(comment).UpdateColumn("pinned", req.Pinned).Error
+	})
+	if err != nil && req.Pinned && app.hasPinnedComment(comment.VideoID, comment.ID) {
+		http.Error(w, "Another comment was pinned meanwhile", http.StatusConflict)
+		log.Info(err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	app.writeComment(w, comment.ID, uid)
+}
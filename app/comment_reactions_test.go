@@ -0,0 +1,56 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prologic/tube/models"
+)
+
+func TestCommentLikes(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	viewer := newTestUser(t, app, "viewer")
+	video := newTestVideo(t, app, owner.ID)
+	comment := newTestComment(t, app, owner.ID, video.ID, 0, "comment")
+
+	tests := []struct {
+		liked        bool
+		likes, score int
+	}{
+		{true, 1, 1},
+		{true, 1, 1},
+		{false, 0, 0},
+		{false, 0, 0},
+		{true, 1, 1},
+	}
+	for _, test := range tests {
+		resp := &models.Comment{}
+		r := newTestRequest("PUT", "/", fmt.Sprintf(`{"liked": %v}`, test.liked), viewer.ID, id(comment.ID))
+		serve(t, app.apiLikeCommentHandler, r, 200, resp)
+		if resp.Liked != test.liked || resp.LikeCount != test.likes || resp.Score != test.score {
+			t.Errorf("liked %v: got %+v, want %d likes and score %d", test.liked, resp, test.likes, test.score)
+		}
+	}
+}
+
+func TestHeartComment(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	viewer := newTestUser(t, app, "viewer")
+	video := newTestVideo(t, app, owner.ID)
+	comment := newTestComment(t, app, viewer.ID, video.ID, 0, "comment")
+
+	serve(t, app.apiHeartCommentHandler, newTestRequest("PUT", "/", `{"hearted": true}`, viewer.ID, id(comment.ID)), 403, nil)
+
+	resp := &models.Comment{}
+	serve(t, app.apiHeartCommentHandler, newTestRequest("PUT", "/", `{"hearted": true}`, owner.ID, id(comment.ID)), 200, resp)
+	if !resp.Hearted {
+		t.Errorf("got %+v, want hearted", resp)
+	}
+	resp = &models.Comment{}
+	serve(t, app.apiHeartCommentHandler, newTestRequest("PUT", "/", `{"hearted": false}`, owner.ID, id(comment.ID)), 200, resp)
+	if resp.Hearted {
+		t.Errorf("got %+v, want the heart taken back", resp)
+	}
+}
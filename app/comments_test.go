@@ -0,0 +1,232 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prologic/tube/models"
+)
+
+// commentPage is a page of comments as written by writeComments
+type commentPage struct {
+	Items      []models.Comment `json:"items"`
+	NextCursor string           `json:"nextCursor"`
+	Total      int64            `json:"total"`
+}
+
+// newTestComment has user uid comment a video, replying to replyTo if set
+func newTestComment(t *testing.T, app *App, uid, videoID, replyTo uint, text string) *models.Comment {
+	t.Helper()
+	body := fmt.Sprintf(`{"videoId": %d, "text": %q}`, videoID, text)
+	if replyTo > 0 {
+		body = fmt.Sprintf(`{"videoId": %d, "text": %q, "replyTo": %d}`, videoID, text, replyTo)
+	}
+	comment := &models.Comment{}
+	serve(t, app.apiCreateCommentHandler, newTestRequest("POST", "/", body, uid, nil), 200, comment)
+	return comment
+}
+
+func commentTexts(comments []models.Comment) []string {
+	texts := []string{}
+	for _, comment := range comments {
+		texts = append(texts, comment.Text)
+	}
+	return texts
+}
+
+func TestCommentThreads(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	viewer := newTestUser(t, app, "viewer")
+	video := newTestVideo(t, app, owner.ID)
+
+	first := newTestComment(t, app, viewer.ID, video.ID, 0, "first")
+	second := newTestComment(t, app, owner.ID, video.ID, 0, "second")
+	reply := newTestComment(t, app, owner.ID, video.ID, first.ID, "reply")
+	newTestComment(t, app, viewer.ID, video.ID, first.ID, "another reply")
+	newTestComment(t, app, viewer.ID, video.ID, reply.ID, "nested reply")
+
+	page := &commentPage{}
+	r := newTestRequest("GET", "/?sort=top", "", viewer.ID, id(video.ID))
+	serve(t, app.apiGetVideoCommentsHandler, r, 200, page)
+	if got := commentTexts(page.Items); fmt.Sprint(got) != "[first second]" || page.Total != 2 {
+		t.Fatalf("got top comments %v of %d, want [first second] of 2", got, page.Total)
+	}
+	if page.Items[0].ReplyCount != 2 || page.Items[0].User.Name != "viewer" || page.Items[0].User.Password != "" {
+		t.Errorf("got first comment %+v, want 2 replies by viewer without password", page.Items[0])
+	}
+	if page.Items[1].ID != second.ID || page.Items[1].User.Name != "owner" {
+		t.Errorf("got second comment %+v, want by owner", page.Items[1])
+	}
+
+	// replies, a page at a time
+	r = newTestRequest("GET", "/?limit=1", "", viewer.ID, id(first.ID))
+	serve(t, app.apiGetCommentRepliesHandler, r, 200, page)
+	if got := commentTexts(page.Items); fmt.Sprint(got) != "[reply]" || page.NextCursor == "" {
+		t.Fatalf("got first page of replies %v, want [reply] and a cursor", got)
+	}
+	r = newTestRequest("GET", "/?limit=1&cursor="+page.NextCursor, "", viewer.ID, id(first.ID))
+	page = &commentPage{}
+	serve(t, app.apiGetCommentRepliesHandler, r, 200, page)
+	if got := commentTexts(page.Items); fmt.Sprint(got) != "[another reply]" || page.NextCursor != "" {
+		t.Fatalf("got second page of replies %v, want [another reply] and no cursor", got)
+	}
+
+	// a deleted reply with replies stays listed, a deleted leaf doesn't
+	serve(t, app.apiDeleteCommentHandler, newTestRequest("DELETE", "/", "", owner.ID, id(reply.ID)), 200, nil)
+	comment := &models.Comment{}
+	serve(t, app.apiGetCommentHandler, newTestRequest("GET", "/", "", viewer.ID, id(first.ID)), 200, comment)
+	if comment.ReplyCount != 2 {
+		t.Errorf("got %d replies after deleting one with replies, want 2", comment.ReplyCount)
+	}
+	last := newTestComment(t, app, viewer.ID, video.ID, first.ID, "last")
+	serve(t, app.apiDeleteCommentHandler, newTestRequest("DELETE", "/", "", viewer.ID, id(last.ID)), 200, nil)
+	serve(t, app.apiGetCommentHandler, newTestRequest("GET", "/", "", viewer.ID, id(first.ID)), 200, comment)
+	if comment.ReplyCount != 2 {
+		t.Errorf("got %d replies after deleting a leaf, want 2", comment.ReplyCount)
+	}
+}
+
+func TestEditComment(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	viewer := newTestUser(t, app, "viewer")
+	video := newTestVideo(t, app, owner.ID)
+	comment := newTestComment(t, app, viewer.ID, video.ID, 0, "tpyo")
+	if comment.EditedAt != nil {
+		t.Fatal("new comment marked as edited")
+	}
+
+	serve(t, app.apiEditCommentHandler, newTestRequest("PUT", "/", `{"text": "hacked"}`, owner.ID, id(comment.ID)), 403, nil)
+	serve(t, app.apiEditCommentHandler, newTestRequest("PUT", "/", `{"text": " "}`, viewer.ID, id(comment.ID)), 400, nil)
+
+	edited := &models.Comment{}
+	serve(t, app.apiEditCommentHandler, newTestRequest("PUT", "/", `{"text": "typo"}`, viewer.ID, id(comment.ID)), 200, edited)
+	if edited.Text != "typo" || edited.EditedAt == nil {
+		t.Errorf("got %+v, want text typo marked as edited", edited)
+	}
+
+	serve(t, app.apiDeleteCommentHandler, newTestRequest("DELETE", "/", "", viewer.ID, id(comment.ID)), 200, nil)
+	serve(t, app.apiEditCommentHandler, newTestRequest("PUT", "/", `{"text": "back"}`, viewer.ID, id(comment.ID)), 404, nil)
+}
+
+// listComments gets the pages of a video's comments with the given query
+// parameters and returns their texts, page by page
+func listComments(t *testing.T, app *App, uid, videoID uint, params string) [][]string {
+	t.Helper()
+	pages := [][]string{}
+	cursor := ""
+	for i := 0; i < 10; i++ {
+		page := &commentPage{}
+		r := newTestRequest("GET", "/?"+params+cursor, "", uid, id(videoID))
+		serve(t, app.apiGetVideoCommentsHandler, r, 200, page)
+		pages = append(pages, commentTexts(page.Items))
+		if page.NextCursor == "" {
+			return pages
+		}
+		cursor = "&cursor=" + page.NextCursor
+	}
+	t.Fatalf("no last page after %v", pages)
+	return nil
+}
+
+func TestPinnedComment(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	viewer := newTestUser(t, app, "viewer")
+	video := newTestVideo(t, app, owner.ID)
+	first := newTestComment(t, app, viewer.ID, video.ID, 0, "first")
+	newTestComment(t, app, viewer.ID, video.ID, 0, "second")
+	third := newTestComment(t, app, viewer.ID, video.ID, 0, "third")
+
+	pin := func(comment *models.Comment) {
+		r := newTestRequest("PUT", "/", `{"pinned": true}`, owner.ID, id(comment.ID))
+		serve(t, app.apiPinCommentHandler, r, 200, nil)
+	}
+	pin(first)
+	pin(third)
+
+	// the pinned comment counts towards the limit and isn't repeated
+	tests := []struct {
+		params string
+		want   string
+	}{
+		{"limit=2", "[[third first] [second]]"},
+		{"limit=1", "[[third] [first] [second]]"},
+		{"limit=3", "[[third first second]]"},
+		{"limit=1&sort=newest", "[[third] [second] [first]]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(listComments(t, app, viewer.ID, video.ID, test.params)); got != test.want {
+			t.Errorf("got pages %s with %s, want %s", got, test.params, test.want)
+		}
+	}
+
+	page := &commentPage{}
+	serve(t, app.apiGetVideoCommentsHandler, newTestRequest("GET", "/", "", viewer.ID, id(video.ID)), 200, page)
+	if page.Total != 3 || !page.Items[0].Pinned || page.Items[1].Pinned {
+		t.Errorf("got %d comments %+v, want 3 with only the first pinned", page.Total, page.Items)
+	}
+
+	// the database keeps a video from having two pinned comments
+	res := app.DataBase.Model(first).UpdateColumn("pinned", true)
+	if res.Error == nil {
+		t.Error("pinned a second comment of the video")
+	}
+}
+
+func TestCommentCursor(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	video := newTestVideo(t, app, owner.ID)
+	first := newTestComment(t, app, owner.ID, video.ID, 0, "first")
+	newTestComment(t, app, owner.ID, video.ID, 0, "second")
+	newTestComment(t, app, owner.ID, video.ID, 0, "third")
+	if err := app.setCommentLike(first.ID, owner.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	page := &commentPage{}
+	r := newTestRequest("GET", "/?sort=top&limit=1", "", owner.ID, id(video.ID))
+	serve(t, app.apiGetVideoCommentsHandler, r, 200, page)
+	if got := commentTexts(page.Items); fmt.Sprint(got) != "[first]" {
+		t.Fatalf("got top comment %v, want [first]", got)
+	}
+
+	// the cursor still points after a comment that is gone
+	if err := app.DataBase.Exec("DELETE FROM comments WHERE id = ?", first.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	r = newTestRequest("GET", "/?sort=top&limit=2&cursor="+page.NextCursor, "", owner.ID, id(video.ID))
+	page = &commentPage{}
+	serve(t, app.apiGetVideoCommentsHandler, r, 200, page)
+	if got := commentTexts(page.Items); fmt.Sprint(got) != "[third second]" {
+		t.Errorf("got next comments %v, want [third second]", got)
+	}
+
+	// cursors without a sort value are rejected
+	cursor := (&cursor{Sort: "top", LastID: first.ID}).encode()
+	r = newTestRequest("GET", "/?sort=top&cursor="+cursor, "", owner.ID, id(video.ID))
+	serve(t, app.apiGetVideoCommentsHandler, r, 400, nil)
+}
+
+func TestCreateCommentIgnoresID(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	viewer := newTestUser(t, app, "viewer")
+	video := newTestVideo(t, app, owner.ID)
+	original := newTestComment(t, app, owner.ID, video.ID, 0, "original")
+
+	body := fmt.Sprintf(`{"id": "%d", "videoId": %d, "text": "overwritten", "createdAt": "2000-01-01T00:00:00Z"}`, original.ID, video.ID)
+	created := &models.Comment{}
+	serve(t, app.apiCreateCommentHandler, newTestRequest("POST", "/", body, viewer.ID, nil), 200, created)
+	if created.ID == original.ID || created.CreatedAt.Year() == 2000 {
+		t.Errorf("got %+v, want a new comment created now", created)
+	}
+
+	comment := &models.Comment{}
+	app.DataBase.Find(comment, original.ID)
+	if comment.Text != "original" || comment.UserID != owner.ID {
+		t.Errorf("got %+v, want the original comment untouched", comment)
+	}
+}
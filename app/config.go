@@ -3,13 +3,25 @@ package app
 import (
 	"encoding/json"
 	"os"
+	"strings"
 )
 
 // Config settings for main App.
 type Config struct {
+	Library     []*PathConfig      `json:"library"`
+	LibraryUser string             `json:"library_user"`
 	Server      *ServerConfig      `json:"server"`
+	Database    *DatabaseConfig    `json:"database"`
+	Auth        *AuthConfig        `json:"auth"`
 	Thumbnailer *ThumbnailerConfig `json:"thumbnailer"`
 	Transcoder  *TranscoderConfig  `json:"transcoder"`
+	Jobs        *JobsConfig        `json:"jobs"`
+	Search      *SearchConfig      `json:"search"`
+	Feed        *FeedConfig        `json:"feed"`
+	Import      *ImportConfig      `json:"import"`
+	Storage     *StorageConfig     `json:"storage"`
+	Tus         *TusConfig         `json:"tus"`
+	Views       *ViewsConfig       `json:"views"`
 }
 
 // PathConfig settings for media library path.
@@ -27,9 +39,38 @@ type ServerConfig struct {
 	MaxUploadSize int64  `json:"max_upload_size"`
 }
 
+// DatabaseConfig settings for database connection. An empty DSN is
+// defaultSqliteDSN with sqlite; mysql needs one, e.g. from TUBE_DB_DSN.
+type DatabaseConfig struct {
+	Driver          string `json:"driver"`
+	DSN             string `json:"dsn"`
+	MaxOpenConns    int    `json:"max_open_conns"`
+	MaxIdleConns    int    `json:"max_idle_conns"`
+	ConnMaxLifetime int    `json:"conn_max_lifetime"`
+	AutoMigrate     bool   `json:"auto_migrate"`
+}
+
+// AuthConfig settings for token authentication.
+type AuthConfig struct {
+	SigningKeys     []*SigningKey `json:"signing_keys"`
+	ActiveKey       string        `json:"active_key"`
+	AccessTokenTTL  int           `json:"access_token_ttl"`
+	RefreshTokenTTL int           `json:"refresh_token_ttl"`
+}
+
+// SigningKey is a HMAC secret used to sign and verify access tokens,
+// identified by the kid token header.
+type SigningKey struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
 // ThumbnailerConfig settings for Transcoder
 type ThumbnailerConfig struct {
 	Timeout int `json:"timeout"`
+	// Candidates is the no. of frames taken from a video to pick its
+	// thumbnail from
+	Candidates int `json:"candidates"`
 }
 
 // Sizes a map of ffmpeg -s option to suffix. e.g: hd720 -> #720p
@@ -37,14 +78,129 @@ type Sizes map[string]string
 
 // TranscoderConfig settings for Transcoder
 type TranscoderConfig struct {
-	Timeout int   `json:"timeout"`
-	Sizes   Sizes `json:"sizes"`
+	Timeout int `json:"timeout"`
+	// ProbeTimeout is the no. of seconds ffprobe may take to read a file
+	ProbeTimeout int        `json:"probe_timeout"`
+	Sizes        Sizes      `json:"sizes"`
+	HLS          *HLSConfig `json:"hls"`
+}
+
+// HLSConfig settings for HLS packaging
+type HLSConfig struct {
+	Enabled         bool `json:"enabled"`
+	SegmentDuration int  `json:"segment_duration"`
+}
+
+// JobsConfig settings for background job queue
+type JobsConfig struct {
+	Workers      int `json:"workers"`
+	MaxAttempts  int `json:"max_attempts"`
+	Backoff      int `json:"backoff"`
+	PollInterval int `json:"poll_interval"`
+	// ReconcileInterval is the no. of seconds between recomputing the
+	// reaction counters of videos, 0 to never do it
+	ReconcileInterval int `json:"reconcile_interval"`
+}
+
+// SearchConfig settings for the search index of videos, users and
+// comments. An empty Backend picks mysql for MySQL databases and bleve
+// otherwise.
+type SearchConfig struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+}
+
+// FeedConfig settings for App Feed.
+type FeedConfig struct {
+	ExternalURL string `json:"external_url"`
+	Title       string `json:"title"`
+	Link        string `json:"link"`
+	Description string `json:"description"`
+	Author      struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"author"`
+	Copyright string `json:"copyright"`
+}
+
+// ImportConfig settings for importing videos from URLs
+type ImportConfig struct {
+	MaxSize   int64             `json:"max_size"`
+	Importers []*ImporterConfig `json:"importers"`
+	YtDlp     *YtDlpConfig      `json:"ytdlp"`
+}
+
+// ImporterConfig enables an importer (youtube, vimeo, ytdlp or direct) for
+// URLs matching any of the Match regular expressions. Matching importers
+// are tried from the highest Priority down until one succeeds.
+type ImporterConfig struct {
+	Name     string   `json:"name"`
+	Priority int      `json:"priority"`
+	Match    []string `json:"match"`
+}
+
+// YtDlpConfig settings for the yt-dlp importer
+type YtDlpConfig struct {
+	Binary  string `json:"binary"`
+	Format  string `json:"format"`
+	Timeout int    `json:"timeout"`
+	Proxy   string `json:"proxy"`
+}
+
+// StorageConfig settings for where media files are kept: below Path (the
+// upload path if empty) with the local backend or in a bucket with the s3
+// backend.
+type StorageConfig struct {
+	Backend string    `json:"backend"`
+	Path    string    `json:"path"`
+	S3      *S3Config `json:"s3"`
 }
 
+// S3Config settings for an S3 compatible object storage. With Redirect,
+// media is downloaded by clients straight from the storage through signed
+// URLs valid for URLExpiry seconds.
+type S3Config struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	PathStyle bool   `json:"path_style"`
+	Redirect  bool   `json:"redirect"`
+	URLExpiry int    `json:"url_expiry"`
+}
+
+// TusConfig settings for resumable uploads. Uploads left unfinished for
+// Expiry seconds are deleted.
+type TusConfig struct {
+	MaxSize int64 `json:"max_size"`
+	Expiry  int   `json:"expiry"`
+}
+
+// ViewsConfig settings for view counting. Store is bitcask (kept in the
+// server's store_path) or sql. A viewer is counted once per video within
+// Window seconds and views are added to the videos every FlushInterval
+// seconds. Requests whose User-Agent contains any of Crawlers (case
+// insensitive) aren't counted. With TrustProxy, the viewer's address is
+// taken from the X-Forwarded-For header set by a reverse proxy.
+type ViewsConfig struct {
+	Store         string   `json:"store"`
+	Window        int      `json:"window"`
+	FlushInterval int      `json:"flush_interval"`
+	Crawlers      []string `json:"crawlers"`
+	TrustProxy    bool     `json:"trust_proxy"`
+}
 
 // DefaultConfig returns Config initialized with default values.
 func DefaultConfig() *Config {
-	return &Config{
+	cfg := &Config{
+		Library: []*PathConfig{
+			{
+				Path:   "videos",
+				Prefix: "",
+			},
+		},
+		LibraryUser: "library@localhost",
 		Server: &ServerConfig{
 			Host:          "0.0.0.0",
 			Port:          8000,
@@ -52,14 +208,103 @@ func DefaultConfig() *Config {
 			UploadPath:    "uploads",
 			MaxUploadSize: 104857600,
 		},
+		Database: &DatabaseConfig{
+			Driver:          "sqlite",
+			MaxOpenConns:    10,
+			MaxIdleConns:    2,
+			ConnMaxLifetime: 3600,
+			AutoMigrate:     true,
+		},
+		Auth: &AuthConfig{
+			AccessTokenTTL:  900,
+			RefreshTokenTTL: 2592000,
+		},
 		Thumbnailer: &ThumbnailerConfig{
-			Timeout: 60,
+			Timeout:    60,
+			Candidates: 5,
 		},
 		Transcoder: &TranscoderConfig{
-			Timeout: 300,
-			Sizes:   Sizes(nil),
+			Timeout:      300,
+			ProbeTimeout: 60,
+			Sizes:        Sizes(nil),
+			HLS: &HLSConfig{
+				Enabled:         true,
+				SegmentDuration: 6,
+			},
+		},
+		Jobs: &JobsConfig{
+			Workers:           2,
+			MaxAttempts:       3,
+			Backoff:           30,
+			PollInterval:      5,
+			ReconcileInterval: 3600,
+		},
+		Search: &SearchConfig{
+			Path: "search.bleve",
+		},
+		Feed: &FeedConfig{
+			Title:       "Feed Title",
+			Link:        "http://your-url.example/about",
+			Description: "Feed Description",
+			Copyright:   "Copyright Text",
+		},
+		Import: &ImportConfig{
+			MaxSize: 10737418240,
+			Importers: []*ImporterConfig{
+				{
+					Name:     "direct",
+					Priority: 30,
+					Match:    []string{`^https?://`},
+				},
+				{
+					Name:     "ytdlp",
+					Priority: 20,
+					Match:    []string{`^https?://`, `^(youtube|vimeo):`},
+				},
+				{
+					Name:     "youtube",
+					Priority: 10,
+					Match:    []string{`^youtube:`, `^https?://([^/]+\.)?(youtube\.com|youtu\.be)/`},
+				},
+				{
+					Name:     "vimeo",
+					Priority: 10,
+					Match:    []string{`^vimeo:`, `^https?://([^/]+\.)?vimeo\.com/`},
+				},
+			},
+			YtDlp: &YtDlpConfig{
+				Binary:  "yt-dlp",
+				Format:  "bestvideo[ext=mp4]+bestaudio[ext=m4a]/best[ext=mp4]/best",
+				Timeout: 3600,
+			},
+		},
+		Storage: &StorageConfig{
+			Backend: "local",
+			Path:    "",
+			S3: &S3Config{
+				Endpoint:  "https://s3.amazonaws.com",
+				Region:    "us-east-1",
+				Redirect:  true,
+				URLExpiry: 3600,
+			},
+		},
+		Tus: &TusConfig{
+			MaxSize: 10737418240,
+			Expiry:  86400,
+		},
+		Views: &ViewsConfig{
+			Store:         StoreBitcask,
+			Window:        1800,
+			FlushInterval: 60,
+			Crawlers: []string{
+				"bot", "crawl", "spider", "slurp", "facebookexternalhit",
+				"embedly", "preview", "headless", "lighthouse",
+			},
 		},
 	}
+	cfg.Feed.Author.Name = "Author Name"
+	cfg.Feed.Author.Email = "author@somewhere.example"
+	return cfg
 }
 
 // ReadFile reads a JSON file into Config.
@@ -72,3 +317,37 @@ func (c *Config) ReadFile(path string) error {
 	d := json.NewDecoder(f)
 	return d.Decode(c)
 }
+
+// ReadEnv overrides settings that shouldn't live in the config file
+// (e.g. credentials) from environment variables.
+func (c *Config) ReadEnv() {
+	if driver := os.Getenv("TUBE_DB_DRIVER"); driver != "" {
+		c.Database.Driver = driver
+	}
+	if dsn := os.Getenv("TUBE_DB_DSN"); dsn != "" {
+		c.Database.DSN = dsn
+	}
+	// TUBE_JWT_KEYS is a comma separated list of id:secret pairs
+	if keys := os.Getenv("TUBE_JWT_KEYS"); keys != "" {
+		c.Auth.SigningKeys = nil
+		for _, pair := range strings.Split(keys, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			c.Auth.SigningKeys = append(c.Auth.SigningKeys, &SigningKey{
+				ID:     parts[0],
+				Secret: parts[1],
+			})
+		}
+	}
+	if active := os.Getenv("TUBE_JWT_ACTIVE_KEY"); active != "" {
+		c.Auth.ActiveKey = active
+	}
+	if key := os.Getenv("TUBE_S3_ACCESS_KEY"); key != "" {
+		c.Storage.S3.AccessKey = key
+	}
+	if secret := os.Getenv("TUBE_S3_SECRET_KEY"); secret != "" {
+		c.Storage.S3.SecretKey = secret
+	}
+}
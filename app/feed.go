@@ -0,0 +1,201 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	log "github.com/sirupsen/logrus"
+	"github.com/wybiral/feeds"
+	"gorm.io/gorm"
+)
+
+// number of most recent videos listed in a feed
+const feedSize = 50
+
+// returns the base URL of links in feeds
+func (app *App) externalURL() string {
+	if app.Config.Feed.ExternalURL != "" {
+		return strings.TrimSuffix(app.Config.Feed.ExternalURL, "/")
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	return fmt.Sprintf("http://%s:%d", hostname, app.Config.Server.Port)
+}
+
+// builds a feed of the most recent ready videos matching query
+func (app *App) buildFeed(f *feeds.Feed, query *gorm.DB) error {
+	videos := []models.Video{}
+	res := query.
+		Preload("User").
+		Where("videos.status = ?", models.VideoReady).
+		Order("videos.created_at DESC").
+		Limit(feedSize).
+		Find(&videos)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	base := app.externalURL()
+	for _, video := range videos {
+		link := fmt.Sprintf("%s/v/%d", base, video.ID)
+		thumbnail := fmt.Sprintf("%s/%s", base, video.Thumbnail)
+
+		// unknown for videos processed before sizes were kept
+		var length string
+		if video.Size > 0 {
+			length = strconv.FormatInt(video.Size, 10)
+		}
+
+		f.Items = append(f.Items, &feeds.Item{
+			Id:          link,
+			Title:       video.Title,
+			Link:        &feeds.Link{Href: link},
+			Description: video.Description,
+			Content: fmt.Sprintf(
+				`<p><img src="%s" alt="%s"/></p><p>%s</p>`,
+				html.EscapeString(thumbnail),
+				html.EscapeString(video.Title),
+				html.EscapeString(video.Description),
+			),
+			Enclosure: &feeds.Enclosure{
+				Url:    fmt.Sprintf("%s/v/%d.mp4", base, video.ID),
+				Length: length,
+				Type:   "video/mp4",
+			},
+			Author:  &feeds.Author{Name: video.User.Name},
+			Created: video.CreatedAt,
+		})
+		if video.CreatedAt.After(f.Updated) {
+			f.Updated = video.CreatedAt
+		}
+	}
+	return nil
+}
+
+// returns the feed header common to all feeds
+func (app *App) newFeed(title, description string) *feeds.Feed {
+	cfg := app.Config.Feed
+	return &feeds.Feed{
+		Title:       title,
+		Link:        &feeds.Link{Href: cfg.Link},
+		Description: description,
+		Author: &feeds.Author{
+			Name:  cfg.Author.Name,
+			Email: cfg.Author.Email,
+		},
+		Created:   time.Now(),
+		Copyright: cfg.Copyright,
+	}
+}
+
+// writes f in the format requested by the route: xml (RSS 2.0), atom or json
+func writeFeed(w http.ResponseWriter, r *http.Request, f *feeds.Feed) {
+	var err error
+	w.Header().Set("Cache-Control", "public, max-age=7200")
+	switch mux.Vars(r)["format"] {
+	case "atom":
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		err = f.WriteAtom(w)
+	case "json":
+		w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+		err = json.NewEncoder(w).Encode(jsonFeed(f))
+	default:
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		err = f.WriteRss(w)
+	}
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// converts f to a JSON Feed. Video enclosures become attachments, which
+// the feeds package only does for images.
+func jsonFeed(f *feeds.Feed) *feeds.JSONFeed {
+	jf := (&feeds.JSON{Feed: f}).JSONFeed()
+	for i, item := range f.Items {
+		if item.Enclosure == nil || !strings.HasPrefix(item.Enclosure.Type, "video/") {
+			continue
+		}
+		size, _ := strconv.ParseInt(item.Enclosure.Length, 10, 32)
+		jf.Items[i].Attachments = []feeds.JSONAttachment{{
+			Url:      item.Enclosure.Url,
+			MIMEType: item.Enclosure.Type,
+			Size:     int32(size),
+		}}
+	}
+	return jf
+}
+
+// HTTP handler for /feed.{xml,atom,json}
+func (app *App) feedHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := app.Config.Feed
+	f := app.newFeed(cfg.Title, cfg.Description)
+	if err := app.buildFeed(f, app.DataBase.Model(&models.Video{})); err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	writeFeed(w, r, f)
+}
+
+// HTTP handler for /user/{id}/feed.{xml,atom,json}
+func (app *App) userFeedHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	user := &models.User{}
+	app.DataBase.Find(user, id)
+	if user.ID <= 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	f := app.newFeed(
+		fmt.Sprintf("%s - %s", user.Name, app.Config.Feed.Title),
+		fmt.Sprintf("Videos uploaded by %s", user.Name),
+	)
+	f.Author = &feeds.Author{Name: user.Name}
+	query := app.DataBase.Model(&models.Video{}).Where("videos.user_id = ?", user.ID)
+	if err := app.buildFeed(f, query); err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	writeFeed(w, r, f)
+}
+
+// HTTP handler for /category/{id}/feed.{xml,atom,json}
+func (app *App) categoryFeedHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	categ := &models.Category{}
+	app.DataBase.Find(categ, id)
+	if categ.ID <= 0 {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	f := app.newFeed(
+		fmt.Sprintf("%s - %s", categ.Title, app.Config.Feed.Title),
+		fmt.Sprintf("Videos in %s", categ.Title),
+	)
+	query := app.DataBase.Model(&models.Video{}).Where(
+		"EXISTS (SELECT 1 FROM video_categories WHERE v_id = videos.id AND c_id = ?)",
+		categ.ID,
+	)
+	if err := app.buildFeed(f, query); err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	writeFeed(w, r, f)
+}
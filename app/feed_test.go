@@ -0,0 +1,22 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/wybiral/feeds"
+)
+
+func TestFeedEnclosureSize(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "owner")
+	video := newTestVideo(t, app, user.ID)
+	app.DataBase.Model(video).Update("size", 1234)
+
+	// sizes are read from the videos, without any storage to stat
+	f := &feeds.JSONFeed{}
+	r := newTestRequest("GET", "/", "", 0, map[string]string{"format": "json"})
+	serve(t, app.feedHandler, r, 200, f)
+	if len(f.Items) != 1 || len(f.Items[0].Attachments) != 1 || f.Items[0].Attachments[0].Size != 1234 {
+		t.Errorf("got items %+v, want the video with its size", f.Items)
+	}
+}
@@ -0,0 +1,265 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/media"
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const hlsMasterPlaylist = "master.m3u8"
+
+// resolutions of ffmpeg size abbreviations commonly used in Sizes
+var sizeResolutions = map[string]string{
+	"hd1080": "1920x1080",
+	"hd720":  "1280x720",
+	"hd480":  "852x480",
+	"nhd":    "640x360",
+	"film":   "352x240",
+	"vga":    "640x480",
+	"qvga":   "320x240",
+	"ntsc":   "720x480",
+	"pal":    "720x576",
+}
+
+// hlsVariant is a single stream listed in the master playlist
+type hlsVariant struct {
+	Name       string
+	Source     string
+	Resolution string
+	Bandwidth  int64
+	// RFC 6381 codecs, empty if unknown
+	Codecs string
+}
+
+// returns the ffmpeg options encoding a video with a keyframe every HLS
+// segment duration and none in between, so that segments split without
+// transcoding all have the same length and start at the same time in
+// every variant. fps is the frame rate of the video, 0 if unknown. Empty
+// if HLS is disabled.
+func (app *App) hlsKeyframeArgs(fps float64) []string {
+	if !app.Config.Transcoder.HLS.Enabled {
+		return nil
+	}
+	seconds := app.Config.Transcoder.HLS.SegmentDuration
+	if fps <= 0 {
+		return []string{
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", seconds),
+			"-sc_threshold", "0",
+		}
+	}
+	gop := strconv.Itoa(int(math.Round(fps * float64(seconds))))
+	return []string{"-g", gop, "-keyint_min", gop, "-sc_threshold", "0"}
+}
+
+// segments the video and each of its renditions for HLS and writes a
+// master playlist referencing all of them, to be stored below prefix.
+// Returns the local output directory.
+func (app *App) packageHLS(ctx context.Context, video *models.Video, prefix, source string, renditions []models.Rendition) (string, error) {
+	dir, err := ioutil.TempDir(app.Config.Server.UploadPath, fmt.Sprintf("tube-hls-%s-*", path.Base(prefix)))
+	if err != nil {
+		return "", fmt.Errorf("error creating hls path: %w", err)
+	}
+
+	variants := []*hlsVariant{{Name: "source", Source: source}}
+	for _, rend := range renditions {
+		variants = append(variants, &hlsVariant{
+			Name:       rend.Quality,
+			Source:     rend.URL,
+			Resolution: sizeResolution(rend.Size),
+		})
+	}
+
+	for _, variant := range variants {
+		log.
+			WithField("variant", variant.Name).
+			WithField("video", video.ID).
+			Info("segmenting video for hls")
+
+		if err := utils.RunCmdContext(
+			ctx, app.Config.Transcoder.Timeout,
+			"ffmpeg", "-y", "-i", variant.Source,
+			"-c", "copy", "-loglevel", "quiet",
+			"-f", "hls",
+			"-hls_time", strconv.Itoa(app.Config.Transcoder.HLS.SegmentDuration),
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(dir, variant.Name+"_%04d.ts"),
+			filepath.Join(dir, variant.Name+".m3u8"),
+		); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("error segmenting %s variant: %w", variant.Name, err)
+		}
+
+		bandwidth, err := playlistBandwidth(dir, variant.Name+".m3u8")
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		variant.Bandwidth = bandwidth
+
+		info, err := media.Probe(app.Config.Transcoder.ProbeTimeout, variant.Source)
+		if err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		variant.Codecs = info.Codecs()
+	}
+
+	if err := writeMasterPlaylist(dir, path.Base(prefix), variants); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// stores the files packaged in dir below prefix and removes dir. The
+// master playlist goes last so that it never references missing files.
+func (app *App) storeHLS(prefix, dir string) error {
+	defer os.RemoveAll(dir)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.IsDir() || file.Name() == hlsMasterPlaylist {
+			continue
+		}
+		if err := app.storeFile(path.Join(prefix, file.Name()), filepath.Join(dir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return app.storeFile(path.Join(prefix, hlsMasterPlaylist), filepath.Join(dir, hlsMasterPlaylist))
+}
+
+// returns WxH for an ffmpeg -s value, or "" when unknown
+func sizeResolution(size string) string {
+	if res, ok := sizeResolutions[size]; ok {
+		return res
+	}
+	if strings.Count(size, "x") == 1 {
+		return size
+	}
+	return ""
+}
+
+// computes the peak bitrate (bits/s) over all segments of a media playlist
+func playlistBandwidth(dir, playlist string) (int64, error) {
+	f, err := os.Open(filepath.Join(dir, playlist))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var (
+		peak     int64
+		duration float64
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#EXTINF:") {
+			value := strings.TrimSuffix(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			value = strings.SplitN(value, ",", 2)[0]
+			duration, _ = strconv.ParseFloat(value, 64)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") || duration <= 0 {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(dir, line))
+		if err != nil {
+			return 0, err
+		}
+		if bps := int64(float64(info.Size()*8) / duration); bps > peak {
+			peak = bps
+		}
+		duration = 0
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return peak, nil
+}
+
+// writes the master playlist of variants to dir. The media playlists are
+// referenced in the version directory, which is part of their URLs so that
+// those of a new run are never mistaken for cached ones.
+func writeMasterPlaylist(dir, version string, variants []*hlsVariant) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:3\n")
+	for _, variant := range variants {
+		b.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d", variant.Bandwidth))
+		if variant.Resolution != "" {
+			b.WriteString(fmt.Sprintf(",RESOLUTION=%s", variant.Resolution))
+		}
+		if variant.Codecs != "" {
+			b.WriteString(fmt.Sprintf(",CODECS=\"%s\"", variant.Codecs))
+		}
+		b.WriteString(fmt.Sprintf(",NAME=\"%s\"\n", variant.Name))
+		b.WriteString(path.Join(version, variant.Name+".m3u8") + "\n")
+	}
+
+	tmp := filepath.Join(dir, hlsMasterPlaylist+".tmp")
+	if err := ioutil.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, hlsMasterPlaylist))
+}
+
+// HTTP handler for /v/id/hls/file and /v/id/hls/version/file. The master
+// playlist is served without version, the media playlists and segments it
+// references with the version of the run that packaged them.
+func (app *App) getHLSHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	name := filepath.Base(vars["file"])
+
+	video := &models.Video{}
+	app.DataBase.First(video, id)
+	if video.ID <= 0 || video.Status != models.VideoReady || !video.HLS {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Video not found"))
+		return
+	}
+	if version, ok := vars["version"]; ok && version != path.Base(video.HLSPath) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("File not found"))
+		return
+	}
+
+	switch filepath.Ext(name) {
+	case ".m3u8":
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		if name == hlsMasterPlaylist {
+			// the set of variants changes if the video is reprocessed
+			w.Header().Set("Cache-Control", "public, max-age=300")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+		}
+	case ".ts":
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("File not found"))
+		return
+	}
+
+	app.serveObject(w, r, path.Join(video.HLSPath, name))
+}
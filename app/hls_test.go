@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/storage"
+)
+
+func TestHLSKeyframeArgs(t *testing.T) {
+	app := &App{Config: DefaultConfig()}
+	app.Config.Transcoder.HLS = &HLSConfig{Enabled: true, SegmentDuration: 6}
+
+	tests := []struct {
+		fps  float64
+		want string
+	}{
+		{30, "[-g 180 -keyint_min 180 -sc_threshold 0]"},
+		{30000.0 / 1001, "[-g 180 -keyint_min 180 -sc_threshold 0]"},
+		{25, "[-g 150 -keyint_min 150 -sc_threshold 0]"},
+		{0, "[-force_key_frames expr:gte(t,n_forced*6) -sc_threshold 0]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(app.hlsKeyframeArgs(test.fps)); got != test.want {
+			t.Errorf("hlsKeyframeArgs(%v) = %s, want %s", test.fps, got, test.want)
+		}
+	}
+
+	app.Config.Transcoder.HLS.Enabled = false
+	if args := app.hlsKeyframeArgs(30); args != nil {
+		t.Errorf("got %v with HLS disabled, want none", args)
+	}
+}
+
+func TestWriteMasterPlaylist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tube-hls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	variants := []*hlsVariant{
+		{Name: "source", Bandwidth: 5000000, Codecs: "avc1.640028,mp4a.40.2"},
+		{Name: "720p", Bandwidth: 2500000, Resolution: "1280x720", Codecs: "avc1.64001f,mp4a.40.2"},
+		{Name: "360p", Bandwidth: 800000, Resolution: "640x360"},
+	}
+	if err := writeMasterPlaylist(dir, "abc-v1", variants); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, hlsMasterPlaylist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,CODECS="avc1.640028,mp4a.40.2",NAME="source"
+abc-v1/source.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720,CODECS="avc1.64001f,mp4a.40.2",NAME="720p"
+abc-v1/720p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,NAME="360p"
+abc-v1/360p.m3u8
+`
+	if string(data) != want {
+		t.Errorf("got master playlist:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestGetHLSHandler(t *testing.T) {
+	app := newTestApp(t)
+	store, err := storage.NewLocal(app.Config.Server.UploadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Storage = store
+
+	owner := newTestUser(t, app, "owner")
+	video := newTestVideo(t, app, owner.ID)
+	app.DataBase.Model(video).Updates(map[string]interface{}{"hls": true, "hls_path": "hls/abc-v2"})
+	for _, key := range []string{"hls/abc-v2/master.m3u8", "hls/abc-v2/source.m3u8", "hls/abc-v2/source_0000.ts"} {
+		if err := store.Put(context.Background(), key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		vars map[string]string
+		code int
+	}{
+		{map[string]string{"file": "master.m3u8"}, 200},
+		{map[string]string{"version": "abc-v2", "file": "source.m3u8"}, 200},
+		{map[string]string{"version": "abc-v2", "file": "source_0000.ts"}, 200},
+		// a previous run's files are gone
+		{map[string]string{"version": "abc-v1", "file": "source.m3u8"}, 404},
+		{map[string]string{"version": "abc-v2", "file": "source.mp4"}, 404},
+	} {
+		test.vars["id"] = fmt.Sprint(video.ID)
+		r := mux.SetURLVars(httptest.NewRequest("GET", "/", nil), test.vars)
+		w := httptest.NewRecorder()
+		app.getHLSHandler(w, r)
+		if w.Code != test.code {
+			t.Errorf("got status %d for %v, want %d", w.Code, test.vars, test.code)
+		}
+	}
+
+	app.DataBase.Model(video).Update("status", models.VideoTranscoding)
+	r := mux.SetURLVars(httptest.NewRequest("GET", "/", nil), map[string]string{"id": fmt.Sprint(video.ID), "file": "master.m3u8"})
+	w := httptest.NewRecorder()
+	app.getHLSHandler(w, r)
+	if w.Code != 404 {
+		t.Errorf("got status %d for a video being processed, want 404", w.Code)
+	}
+}
@@ -0,0 +1,251 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prologic/tube/importers"
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/utils"
+	"github.com/renstrom/shortuuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const jobImportVideo = "import_video"
+
+// largest thumbnail downloaded on import
+const maxThumbnailSize = 10 << 20
+
+// importClient downloads imported videos and thumbnails, from public
+// addresses only
+var importClient = importers.NewPublicClient(0)
+
+// importVideoPayload is the job payload for jobImportVideo
+type importVideoPayload struct {
+	VideoID    uint   `json:"videoId"`
+	UniqueName string `json:"uniqueName"`
+	URL        string `json:"url"`
+}
+
+// newImporters builds the importer registry from the configured importers.
+// yt-dlp is left out when its binary can't be found.
+func newImporters(cfg *ImportConfig) (*importers.Registry, error) {
+	registry := importers.NewRegistry()
+	for _, ic := range cfg.Importers {
+		var importer importers.Importer
+		switch ic.Name {
+		case "direct":
+			importer = importers.NewDirectImporter()
+		case "ytdlp":
+			if !utils.CmdExists(cfg.YtDlp.Binary) {
+				log.Warn(fmt.Sprintf("%s not found, yt-dlp importer disabled", cfg.YtDlp.Binary))
+				continue
+			}
+			importer = &importers.YtDlpImporter{
+				Binary:  cfg.YtDlp.Binary,
+				Format:  cfg.YtDlp.Format,
+				Timeout: cfg.YtDlp.Timeout,
+				MaxSize: cfg.MaxSize,
+				Proxy:   cfg.YtDlp.Proxy,
+			}
+		case "youtube":
+			importer = &importers.YoutubeImporter{}
+		case "vimeo":
+			importer = &importers.VimeoImporter{}
+		default:
+			return nil, fmt.Errorf("unknown importer: %s", ic.Name)
+		}
+		if err := registry.Register(ic.Name, ic.Priority, ic.Match, importer); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// importRequest is the body of [POST] /api/import
+type importRequest struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	CategoryIds []uint `json:"categoryIds"`
+}
+
+// HTTP handler for [POST] /api/import
+// The video is created right away and downloaded by a background job; its
+// progress is reported by /api/video/{id}/status.
+func (app *App) apiImportVideoHandler(w http.ResponseWriter, r *http.Request) {
+	req := &importRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if !app.Importers.Supports(req.URL) {
+		http.Error(w, "Unsupported video URL", http.StatusBadRequest)
+		return
+	}
+
+	uniqueName := shortuuid.New()
+	vid := &models.Video{
+		UserID:      r.Context().Value("userID").(uint),
+		Title:       req.Title,
+		Description: req.Description,
+	}
+	// the video is created along with its import job, or not at all
+	err := app.DataBase.Transaction(func(tx *gorm.DB) error {
+		if err := createVideoTx(tx, vid, uniqueName, req.CategoryIds); err != nil {
+			return err
+		}
+		_, err := app.Jobs.EnqueueTx(tx, jobImportVideo, vid.ID, &importVideoPayload{
+			VideoID:    vid.ID,
+			UniqueName: uniqueName,
+			URL:        req.URL,
+		})
+		return err
+	})
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	app.Jobs.notify()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(vid)
+	log.Info(fmt.Sprintf("New import: Id=%d; URL: %s", vid.ID, req.URL))
+}
+
+// job handler for jobImportVideo: resolves the URL with an importer,
+// downloads the video and its thumbnail and hands them over to
+// jobProcessVideo
+func (app *App) importVideoJob(ctx context.Context, job *models.Job) error {
+	payload := &importVideoPayload{}
+	if err := decodePayload(job, payload); err != nil {
+		return err
+	}
+
+	video := &models.Video{}
+	res := app.DataBase.Find(video, payload.VideoID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if video.ID <= 0 {
+		// video was deleted while the job was waiting
+		os.Remove(app.importSource(payload) + ".part")
+		return nil
+	}
+
+	if err := app.importVideo(ctx, job, video, payload); err != nil {
+		// keep the video pending while there are retries left, or when
+		// the job was only interrupted
+		if job.Attempts < job.MaxAttempts || ctx.Err() != nil {
+			app.setVideoStatus(video, models.VideoPending, err.Error())
+		} else {
+			app.setVideoStatus(video, models.VideoFailed, err.Error())
+			os.Remove(app.importSource(payload) + ".part")
+		}
+		return err
+	}
+	return nil
+}
+
+// returns where the video of an import is downloaded to. The name stays the
+// same across attempts so that downloads are resumed.
+func (app *App) importSource(payload *importVideoPayload) string {
+	return filepath.Join(
+		app.Config.Server.UploadPath,
+		fmt.Sprintf("tube-import-%s.mp4", payload.UniqueName),
+	)
+}
+
+func (app *App) importVideo(ctx context.Context, job *models.Job, video *models.Video, payload *importVideoPayload) error {
+	app.setVideoStatus(video, models.VideoDownloading, "")
+
+	importer, info, err := app.Importers.GetVideoInfo(payload.URL)
+	if err != nil {
+		return err
+	}
+	app.Jobs.SetProgress(job, 10)
+
+	// title and description given on import win over the source's
+	if video.Title == "" {
+		video.Title = info.Title
+		if video.Description == "" {
+			video.Description = info.Description
+		}
+		res := app.DataBase.Model(video).Updates(map[string]interface{}{
+			"title":       video.Title,
+			"description": video.Description,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+	}
+
+	source := app.importSource(payload)
+	if downloader, ok := importer.(importers.Downloader); ok {
+		err = downloader.Download(ctx, info, source)
+	} else {
+		// the download makes up most of the job: 10% to 80%
+		reported := 10
+		err = utils.Download(ctx, info.VideoURL, source, &utils.DownloadOptions{
+			Client:  importClient,
+			MaxSize: app.Config.Import.MaxSize,
+			Retries: 3,
+			Progress: func(done, total int64) {
+				if total <= 0 {
+					return
+				}
+				if progress := 10 + int(70*done/total); progress != reported {
+					app.Jobs.SetProgress(job, progress)
+					reported = progress
+				}
+			},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("error downloading video: %w", err)
+	}
+	app.Jobs.SetProgress(job, 80)
+
+	// the source's thumbnail is usually better than a generated one
+	keepThumbnail := false
+	if info.ThumbnailURL != "" {
+		thumb := strings.TrimSuffix(source, ".mp4") + ".jpg"
+		err := utils.Download(ctx, info.ThumbnailURL, thumb, &utils.DownloadOptions{
+			Client:  importClient,
+			MaxSize: maxThumbnailSize,
+			Retries: 1,
+		})
+		if err == nil {
+			err = app.setThumbnail(video, thumb)
+		}
+		os.Remove(thumb)
+		if err != nil {
+			os.Remove(thumb + ".part")
+			log.WithError(err).WithField("video", video.ID).Warn("error downloading thumbnail")
+		} else {
+			keepThumbnail = true
+		}
+	}
+	app.Jobs.SetProgress(job, 90)
+
+	_, err = app.Jobs.Enqueue(jobProcessVideo, video.ID, &processVideoPayload{
+		VideoID:       video.ID,
+		UniqueName:    payload.UniqueName,
+		Source:        source,
+		KeepThumbnail: keepThumbnail,
+	})
+	if err != nil {
+		return err
+	}
+
+	app.setVideoStatus(video, models.VideoPending, "")
+	return nil
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prologic/tube/importers"
+	"github.com/prologic/tube/models"
+)
+
+// newTestImportApp returns an app importing https URLs
+func newTestImportApp(t *testing.T) *App {
+	t.Helper()
+	app := newTestApp(t)
+	app.Importers = importers.NewRegistry()
+	if err := app.Importers.Register("direct", 10, []string{`^https://`}, importers.NewDirectImporter()); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestImportVideo(t *testing.T) {
+	app := newTestImportApp(t)
+	user := newTestUser(t, app, "importer")
+	category := &models.Category{Title: "music"}
+	app.DataBase.Create(category)
+
+	body := fmt.Sprintf(`{"url": "https://example.com/video.mp4", "title": "imported", "categoryIds": [%d, 4242]}`, category.ID)
+	vid := &models.Video{}
+	serve(t, app.apiImportVideoHandler, newTestRequest("POST", "/", body, user.ID, nil), 202, vid)
+
+	video := &models.Video{}
+	app.DataBase.Preload("Categories").Find(video, vid.ID)
+	if video.Status != models.VideoPending || len(video.Categories) != 1 || video.Categories[0].CID != category.ID {
+		t.Errorf("got video %+v, want pending in the known category only", video)
+	}
+	var jobs int64
+	app.DataBase.Model(&models.Job{}).Where("video_id = ? AND type = ?", video.ID, jobImportVideo).Count(&jobs)
+	if jobs != 1 {
+		t.Errorf("got %d import jobs, want 1", jobs)
+	}
+
+	serve(t, app.apiImportVideoHandler, newTestRequest("POST", "/", `{"url": "ftp://example.com/v.mp4"}`, user.ID, nil), 400, nil)
+}
+
+func TestImportVideoRollsBack(t *testing.T) {
+	app := newTestImportApp(t)
+	user := newTestUser(t, app, "importer")
+	// enqueuing the job fails
+	if err := app.DataBase.Exec("DROP TABLE jobs").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"url": "https://example.com/video.mp4"}`
+	serve(t, app.apiImportVideoHandler, newTestRequest("POST", "/", body, user.ID, nil), 500, nil)
+
+	var videos int64
+	app.DataBase.Model(&models.Video{}).Count(&videos)
+	if videos != 0 {
+		t.Errorf("got %d videos after the job couldn't be enqueued, want none", videos)
+	}
+}
+
+func TestVideoStatus(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	other := newTestUser(t, app, "other")
+	video := newTestVideo(t, app, owner.ID)
+	app.DataBase.Model(video).Update("status_error", "ffmpeg: /srv/tube/videos/x.mp4 not found")
+
+	status := map[string]interface{}{}
+	serve(t, app.apiGetVideoStatusHandler, newTestRequest("GET", "/", "", owner.ID, id(video.ID)), 200, &status)
+	if status["error"] != "ffmpeg: /srv/tube/videos/x.mp4 not found" {
+		t.Errorf("got status %v, want the error", status)
+	}
+
+	serve(t, app.apiGetVideoStatusHandler, newTestRequest("GET", "/", "", other.ID, id(video.ID)), 403, nil)
+
+	r := newTestRequest("GET", "/", "", other.ID, id(video.ID))
+	r = r.WithContext(context.WithValue(r.Context(), "role", models.RoleModerator))
+	serve(t, app.apiGetVideoStatusHandler, r, 200, nil)
+}
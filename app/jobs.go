@@ -0,0 +1,285 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prologic/tube/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// JobHandler runs a single background job. A returned error marks the
+// attempt as failed and the job is retried until MaxAttempts is reached.
+// ctx is cancelled when the queue is stopped; long running handlers should
+// give up then, and the job is run again on next start.
+type JobHandler func(ctx context.Context, job *models.Job) error
+
+// jobQueue is a durable job queue backed by the jobs table. Jobs survive
+// restarts: anything left running when the server stopped is requeued on
+// startup.
+type jobQueue struct {
+	sync.Mutex
+
+	db       *gorm.DB
+	cfg      *JobsConfig
+	handlers map[string]JobHandler
+
+	wake chan struct{}
+	quit chan struct{}
+	wg   sync.WaitGroup
+
+	// cancelled by Stop to interrupt running jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newJobQueue(cfg *JobsConfig) *jobQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &jobQueue{
+		cfg:      cfg,
+		handlers: make(map[string]JobHandler),
+		wake:     make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Register associates a job type with its handler.
+func (q *jobQueue) Register(jobType string, handler JobHandler) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.handlers[jobType] = handler
+}
+
+// Enqueue persists a new job of the given type. payload is stored as JSON.
+// videoID is the video the job works on, 0 if none.
+func (q *jobQueue) Enqueue(jobType string, videoID uint, payload interface{}) (*models.Job, error) {
+	job, err := q.EnqueueTx(q.db, jobType, videoID, payload)
+	if err != nil {
+		return nil, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// EnqueueTx persists a new job as Enqueue does, in transaction tx so that
+// it only exists along with the rows it works on. Workers find it on their
+// next poll, or call notify once tx is committed.
+func (q *jobQueue) EnqueueTx(tx *gorm.DB, jobType string, videoID uint, payload interface{}) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding job payload: %w", err)
+	}
+
+	job := &models.Job{
+		Type:        jobType,
+		VideoID:     videoID,
+		Payload:     string(data),
+		State:       models.JobQueued,
+		MaxAttempts: q.cfg.MaxAttempts,
+		RunAt:       time.Now(),
+	}
+	if err := tx.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("error creating job: %w", err)
+	}
+	return job, nil
+}
+
+// SetProgress records the percentage of a running job's work that is done.
+func (q *jobQueue) SetProgress(job *models.Job, progress int) {
+	if progress < 0 {
+		progress = 0
+	} else if progress > 100 {
+		progress = 100
+	}
+	job.Progress = progress
+	res := q.db.Model(job).Update("progress", progress)
+	if res.Error != nil {
+		log.Error(res.Error)
+	}
+}
+
+// Start recovers interrupted jobs and starts the worker pool.
+func (q *jobQueue) Start(db *gorm.DB) error {
+	q.db = db
+
+	res := q.db.Model(&models.Job{}).
+		Where("state = ?", models.JobRunning).
+		Update("state", models.JobQueued)
+	if res.Error != nil {
+		return fmt.Errorf("error recovering interrupted jobs: %w", res.Error)
+	}
+	if res.RowsAffected > 0 {
+		log.Info(fmt.Sprintf("Recovered %d interrupted job(s)", res.RowsAffected))
+	}
+
+	workers := q.cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return nil
+}
+
+// Stop signals workers to exit, interrupts running jobs and waits for them
+// to return.
+func (q *jobQueue) Stop() {
+	close(q.quit)
+	q.cancel()
+	q.wg.Wait()
+}
+
+func (q *jobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *jobQueue) worker() {
+	defer q.wg.Done()
+
+	interval := time.Duration(q.cfg.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// drain the queue before going back to sleep
+		for {
+			job, err := q.claim()
+			if err != nil {
+				log.Error(err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			q.run(job)
+
+			select {
+			case <-q.quit:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-q.quit:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim picks the oldest runnable job and marks it as running. The state
+// check in the UPDATE makes sure only one worker wins a given job.
+func (q *jobQueue) claim() (*models.Job, error) {
+	for {
+		job := &models.Job{}
+		res := q.db.
+			Where("state = ? AND run_at <= ?", models.JobQueued, time.Now()).
+			Order("run_at, id").
+			Limit(1).
+			Find(job)
+		if res.Error != nil {
+			return nil, fmt.Errorf("error fetching job: %w", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return nil, nil
+		}
+
+		res = q.db.Model(&models.Job{}).
+			Where("id = ? AND state = ?", job.ID, models.JobQueued).
+			Updates(map[string]interface{}{
+				"state":    models.JobRunning,
+				"attempts": gorm.Expr("attempts + 1"),
+				"progress": 0,
+			})
+		if res.Error != nil {
+			return nil, fmt.Errorf("error claiming job %d: %w", job.ID, res.Error)
+		}
+		if res.RowsAffected == 1 {
+			job.State = models.JobRunning
+			job.Attempts++
+			job.Progress = 0
+			return job, nil
+		}
+		// another worker got there first, try the next one
+	}
+}
+
+func (q *jobQueue) run(job *models.Job) {
+	q.Lock()
+	handler, ok := q.handlers[job.Type]
+	q.Unlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler for job type %s", job.Type)
+	} else {
+		err = q.safeCall(handler, job)
+	}
+
+	updates := map[string]interface{}{}
+	if err != nil && q.ctx.Err() != nil {
+		// interrupted by Stop, the attempt doesn't count
+		updates["state"] = models.JobQueued
+		updates["attempts"] = gorm.Expr("attempts - 1")
+		updates["last_error"] = err.Error()
+		log.Info(fmt.Sprintf("Job %d (%s) interrupted", job.ID, job.Type))
+	} else if err == nil {
+		updates["state"] = models.JobDone
+		updates["last_error"] = ""
+		updates["progress"] = 100
+		log.Info(fmt.Sprintf("Job %d (%s) done", job.ID, job.Type))
+	} else if job.Attempts < job.MaxAttempts {
+		delay := time.Duration(q.cfg.Backoff) * time.Second << uint(job.Attempts-1)
+		updates["state"] = models.JobQueued
+		updates["last_error"] = err.Error()
+		updates["run_at"] = time.Now().Add(delay)
+		log.
+			WithField("attempt", job.Attempts).
+			WithField("retry_in", delay).
+			Warn(fmt.Sprintf("Job %d (%s) failed: %s", job.ID, job.Type, err))
+	} else {
+		updates["state"] = models.JobFailed
+		updates["last_error"] = err.Error()
+		log.Error(fmt.Sprintf("Job %d (%s) failed permanently: %s", job.ID, job.Type, err))
+	}
+
+	if res := q.db.Model(job).Updates(updates); res.Error != nil {
+		log.Error(res.Error)
+	}
+}
+
+// safeCall runs handler, turning a panic into an error so a bad job can't
+// take a worker down with it.
+func (q *jobQueue) safeCall(handler JobHandler, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(q.ctx, job)
+}
+
+// decodePayload unmarshals a job's JSON payload into v.
+func decodePayload(job *models.Job, v interface{}) error {
+	if err := json.Unmarshal([]byte(job.Payload), v); err != nil {
+		return fmt.Errorf("error decoding payload of job %d: %w", job.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/utils"
+)
+
+// newTestQueue returns a job queue on the database of app whose jobs are
+// retried after 10s, 20s, ... up to 3 attempts. Workers aren't started.
+func newTestQueue(app *App) *jobQueue {
+	q := newJobQueue(&JobsConfig{Workers: 1, MaxAttempts: 3, Backoff: 10, PollInterval: 1})
+	q.db = app.DataBase
+	return q
+}
+
+// findJob reloads job from the database
+func findJob(t *testing.T, app *App, job *models.Job) *models.Job {
+	t.Helper()
+	found := &models.Job{}
+	if err := app.DataBase.First(found, job.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestJobClaim(t *testing.T) {
+	app := newTestApp(t)
+	q := newTestQueue(app)
+	job, err := q.Enqueue("test", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	claimed := make(chan *models.Job, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job, err := q.claim()
+			if err != nil {
+				t.Error(err)
+			}
+			if job != nil {
+				claimed <- job
+			}
+		}()
+	}
+	wg.Wait()
+	close(claimed)
+
+	if len(claimed) != 1 {
+		t.Fatalf("job claimed %d times, want once", len(claimed))
+	}
+	if found := findJob(t, app, job); found.State != models.JobRunning || found.Attempts != 1 {
+		t.Errorf("got job %s after %d attempts, want running after 1", found.State, found.Attempts)
+	}
+}
+
+func TestJobRetries(t *testing.T) {
+	app := newTestApp(t)
+	q := newTestQueue(app)
+	q.Register("test", func(ctx context.Context, job *models.Job) error {
+		return errors.New("failure")
+	})
+	job, err := q.Enqueue("test", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt, backoff := range []time.Duration{10 * time.Second, 20 * time.Second, 0} {
+		claimed, err := q.claim()
+		if err != nil || claimed == nil {
+			t.Fatalf("attempt %d: got job %v and error %v, want the job", attempt+1, claimed, err)
+		}
+		start := time.Now()
+		q.run(claimed)
+
+		found := findJob(t, app, job)
+		if found.Attempts != attempt+1 || found.LastError != "failure" {
+			t.Errorf("attempt %d: got %d attempts and error %q", attempt+1, found.Attempts, found.LastError)
+		}
+		if backoff == 0 {
+			if found.State != models.JobFailed {
+				t.Errorf("got job %s after the last attempt, want failed", found.State)
+			}
+			break
+		}
+		if delay := found.RunAt.Sub(start); found.State != models.JobQueued || delay < backoff || delay > backoff+5*time.Second {
+			t.Errorf("attempt %d: got job %s to run in %s, want queued in %s", attempt+1, found.State, delay, backoff)
+		}
+
+		// not run before its backoff is over
+		if claimed, _ := q.claim(); claimed != nil {
+			t.Fatalf("attempt %d: job claimed before its backoff", attempt+1)
+		}
+		app.DataBase.Model(found).Update("run_at", time.Now().Add(-time.Second))
+	}
+
+	if claimed, _ := q.claim(); claimed != nil {
+		t.Error("failed job claimed again")
+	}
+}
+
+func TestJobInterrupted(t *testing.T) {
+	app := newTestApp(t)
+	q := newTestQueue(app)
+	started := make(chan struct{})
+	q.Register("test", func(ctx context.Context, job *models.Job) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	job, err := q.Enqueue("test", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := q.claim()
+	if err != nil || claimed == nil {
+		t.Fatalf("got job %v and error %v, want the job", claimed, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		q.run(claimed)
+		close(done)
+	}()
+	<-started
+	q.Stop()
+	<-done
+
+	// the attempt doesn't count
+	if found := findJob(t, app, job); found.State != models.JobQueued || found.Attempts != 0 {
+		t.Errorf("got job %s after %d attempts, want queued after none", found.State, found.Attempts)
+	}
+}
+
+func TestJobRecovery(t *testing.T) {
+	app := newTestApp(t)
+	q := newTestQueue(app)
+	ran := make(chan uint, 1)
+	q.Register("test", func(ctx context.Context, job *models.Job) error {
+		ran <- job.ID
+		return nil
+	})
+
+	// left running when the server stopped
+	job := &models.Job{Type: "test", State: models.JobRunning, Attempts: 1, MaxAttempts: 3, RunAt: time.Now()}
+	if err := app.DataBase.Create(job).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Start(app.DataBase); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case id := <-ran:
+		if id != job.ID {
+			t.Errorf("ran job %d, want %d", id, job.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("interrupted job not run again after starting")
+	}
+	q.Stop()
+
+	if found := findJob(t, app, job); found.State != models.JobDone || found.Attempts != 2 {
+		t.Errorf("got job %s after %d attempts, want done after 2", found.State, found.Attempts)
+	}
+}
+
+func TestProcessVideoJobFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempts   int
+		cancel     bool
+		status     string
+		keepSource bool
+	}{
+		{"retries left", 1, false, models.VideoPending, true},
+		{"interrupted", 3, true, models.VideoPending, true},
+		{"retries exhausted", 3, false, models.VideoFailed, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(t)
+			if err := os.MkdirAll(app.Config.Server.UploadPath, 0755); err != nil {
+				t.Fatal(err)
+			}
+			user := newTestUser(t, app, "user")
+			video := newTestVideo(t, app, user.ID)
+
+			// not a video, so transcoding fails
+			source := filepath.Join(app.Config.Server.UploadPath, "tube-upload-video.mp4")
+			if err := ioutil.WriteFile(source, []byte("not a video"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			job, err := app.Jobs.Enqueue(jobProcessVideo, video.ID, &processVideoPayload{
+				VideoID:    video.ID,
+				UniqueName: "video",
+				Source:     source,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			job.Attempts = test.attempts
+			job.MaxAttempts = 3
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancel {
+				cancel()
+			}
+			if err := app.processVideoJob(ctx, job); err == nil {
+				t.Fatal("processing a file that's not a video succeeded")
+			}
+
+			if err := app.DataBase.First(video, video.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if video.Status != test.status {
+				t.Errorf("got status %q, want %q", video.Status, test.status)
+			}
+			if kept := utils.FileExists(source); kept != test.keepSource {
+				t.Errorf("source kept: %t, want %t", kept, test.keepSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prologic/tube/media"
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/storage"
+	"github.com/prologic/tube/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// time without events after which a new or changed file is imported,
+	// so files still being copied aren't read half written
+	librarySettle = 5 * time.Second
+	// time a removed file waits for a new file with the same size and
+	// modification time, which is then taken as a rename
+	libraryMoveWindow = 2 * librarySettle
+)
+
+// opens the configured library paths, brings the database in line with
+// their content and starts watching them for changes
+func (app *App) openLibrary() error {
+	user, err := app.libraryUser()
+	if err != nil {
+		return err
+	}
+	app.libraryUserID = user.ID
+
+	for _, pc := range app.Config.Library {
+		p := &media.Path{
+			Path:   filepath.ToSlash(filepath.Clean(pc.Path)),
+			Prefix: pc.Prefix,
+		}
+		if err := app.Library.AddPath(p); err != nil {
+			return err
+		}
+		if err := app.Library.Import(p); err != nil {
+			return err
+		}
+		if err := app.Watcher.Add(p.Path); err != nil {
+			return fmt.Errorf("error watching library path %s: %w", p.Path, err)
+		}
+	}
+
+	if err := app.syncLibrary(); err != nil {
+		return err
+	}
+	go app.watchLibrary()
+	return nil
+}
+
+// returns the user library videos are attributed to, creating it without
+// a password (so it can't log in) if it doesn't exist
+func (app *App) libraryUser() (*models.User, error) {
+	user := &models.User{}
+	res := app.DataBase.Where("email = ?", app.Config.LibraryUser).Find(user)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if user.ID > 0 {
+		return user, nil
+	}
+
+	user.Name = "Library"
+	user.Email = app.Config.LibraryUser
+	user.Role = models.RoleUploader
+	if res := app.DataBase.Create(user); res.Error != nil {
+		return nil, fmt.Errorf("error creating library user: %w", res.Error)
+	}
+	app.indexUser(user.ID)
+	log.Info(fmt.Sprintf("Created library user %s", user.Email))
+	return user, nil
+}
+
+// imports library files missing from the database, updates changed ones
+// and removes videos whose file is gone
+func (app *App) syncLibrary() error {
+	videos := []models.Video{}
+	res := app.DataBase.Where("source_path <> ''").Find(&videos)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	// videos whose file is gone may have been renamed while we weren't
+	// watching
+	missing := make(map[string]*models.Video)
+	for i := range videos {
+		if !utils.FileExists(videos[i].SourcePath) {
+			missing[videos[i].SourcePath] = &videos[i]
+		}
+	}
+
+	for _, lv := range app.Library.Playlist() {
+		app.syncLibraryVideo(lv, missing)
+	}
+	for _, video := range missing {
+		app.removeLibraryVideo(video)
+	}
+	return nil
+}
+
+// creates or updates the video of a library file. A new file matching one
+// of moved (old path -> video) is taken as a rename of it.
+func (app *App) syncLibraryVideo(lv *media.Video, moved map[string]*models.Video) {
+	logger := log.WithField("file", lv.Path)
+	modTime := lv.Timestamp
+	// the file is there, whatever happened to it before
+	delete(moved, lv.Path)
+
+	video := &models.Video{}
+	res := app.DataBase.Where("source_path = ?", lv.Path).Find(video)
+	if res.Error != nil {
+		logger.WithError(res.Error).Error("error loading library video")
+		return
+	}
+
+	if video.ID <= 0 {
+		for oldPath, old := range moved {
+			if old.SourceSize == lv.Size && old.SourceModTime != nil &&
+				old.SourceModTime.Unix() == modTime.Unix() {
+				delete(moved, oldPath)
+				video = old
+				logger.WithField("from", oldPath).Info("library video moved")
+				break
+			}
+		}
+	}
+
+	modified := video.ID <= 0 || video.SourceSize != lv.Size ||
+		video.SourceModTime == nil || video.SourceModTime.Unix() != modTime.Unix()
+	if video.ID <= 0 {
+		video.UserID = app.libraryUserID
+		video.Status = models.VideoReady
+		video.CreatedAt = modTime
+	} else if !modified && video.SourcePath == lv.Path {
+		// unchanged, only bring back a thumbnail that went missing
+		missing := video.ThumbnailURL == ""
+		if !missing {
+			_, err := app.Storage.Stat(context.Background(), video.ThumbnailURL)
+			missing = errors.Is(err, storage.ErrNotFound)
+		}
+		if missing {
+			if err := app.libraryThumbnail(video, lv); err != nil {
+				logger.WithError(err).Error("error generating thumbnail")
+			}
+		}
+		return
+	}
+
+	video.Title = lv.Title
+	video.Description = lv.Description
+	video.URL = lv.Path
+	video.Size = lv.Size
+	video.SourcePath = lv.Path
+	video.SourceSize = lv.Size
+	video.SourceModTime = &modTime
+
+	if modified {
+		if err := app.probeVideo(video, lv.Path); err != nil {
+			logger.WithError(err).Warn("error reading video information")
+		}
+	}
+
+	if res := app.DataBase.Save(video); res.Error != nil {
+		logger.WithError(res.Error).Error("error saving library video")
+		return
+	}
+
+	// thumbnails are stored by the video's id
+	if modified {
+		if err := app.libraryThumbnail(video, lv); err != nil {
+			logger.WithError(err).Error("error generating thumbnail")
+		}
+	}
+	app.indexVideo(video.ID)
+	logger.WithField("video", video.ID).Info("library video imported")
+}
+
+// stores the thumbnail of a library video: the picture embedded in the file
+// or next to it if there is one, the best of several frames otherwise
+func (app *App) libraryThumbnail(video *models.Video, lv *media.Video) error {
+	if len(lv.Thumb) == 0 {
+		return app.generateThumbnails(context.Background(), video, lv.Path, false)
+	}
+
+	thumb, err := ioutil.TempFile(
+		app.Config.Server.UploadPath,
+		fmt.Sprintf("tube-thumbnail-%d-*", video.ID),
+	)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(thumb.Name())
+
+	_, err = thumb.Write(lv.Thumb)
+	if cerr := thumb.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return app.setThumbnail(video, thumb.Name())
+}
+
+// deletes the video of a library file that is gone, along with the
+// thumbnail generated for it
+func (app *App) removeLibraryVideo(video *models.Video) {
+	if err := app.removeThumbnails(video); err != nil {
+		log.Error(err)
+	}
+	if res := app.DataBase.Delete(video); res.Error != nil {
+		log.Error(res.Error)
+		return
+	}
+	app.unindexVideo(video.ID)
+	log.WithField("file", video.SourcePath).Info("library video removed")
+}
+
+// handles watcher events until the watcher is closed. Changes are applied
+// once files settle; removals wait a little longer so that a rename (a
+// remove followed by a create) keeps the video, with its views and comments.
+func (app *App) watchLibrary() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	changed := make(map[string]time.Time)
+	removed := make(map[string]time.Time)
+	moved := make(map[string]*models.Video)
+
+	for {
+		select {
+		case e, ok := <-app.Watcher.Events:
+			if !ok {
+				return
+			}
+			if e.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Chmod) > 0 {
+				changed[e.Name] = time.Now()
+			} else if e.Op&(fsnotify.Remove|fsnotify.Rename) > 0 {
+				delete(changed, e.Name)
+				app.Library.Remove(e.Name)
+				video := &models.Video{}
+				app.DataBase.Where("source_path = ?", filepath.ToSlash(e.Name)).Find(video)
+				if video.ID > 0 {
+					moved[video.SourcePath] = video
+					removed[video.SourcePath] = time.Now()
+				}
+			}
+		case err, ok := <-app.Watcher.Errors:
+			if !ok {
+				return
+			}
+			log.WithError(err).Error("library watcher error")
+		case now := <-ticker.C:
+			for fp, t := range changed {
+				if now.Sub(t) < librarySettle {
+					continue
+				}
+				delete(changed, fp)
+				if !utils.FileExists(fp) {
+					continue
+				}
+				lv, err := app.Library.Add(fp)
+				if err != nil {
+					// not a video we can read
+					continue
+				}
+				app.syncLibraryVideo(lv, moved)
+			}
+			for fp, t := range removed {
+				if now.Sub(t) < libraryMoveWindow {
+					continue
+				}
+				delete(removed, fp)
+				if video, ok := moved[fp]; ok {
+					delete(moved, fp)
+					app.removeLibraryVideo(video)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	rice "github.com/GeertJohan/go.rice"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// Migrator applies the SQL migrations embedded for a database driver.
+// Files are named <version>_<name>.up.sql / <version>_<name>.down.sql.
+type Migrator struct {
+	db         *gorm.DB
+	driver     string
+	migrations []*Migration
+}
+
+// NewMigrator loads the migrations for driver
+func NewMigrator(db *gorm.DB, driver string) (*Migrator, error) {
+	box, err := rice.FindBox("../migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error finding migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	err = box.Walk(driver, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		name := path.Base(filepath.ToSlash(fp))
+		var up bool
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			up = true
+			name = strings.TrimSuffix(name, ".up.sql")
+		case strings.HasSuffix(name, ".down.sql"):
+			name = strings.TrimSuffix(name, ".down.sql")
+		default:
+			return nil
+		}
+
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return fmt.Errorf("invalid migration file name: %s", fp)
+		}
+
+		content, err := box.String(fp)
+		if err != nil {
+			return err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if up {
+			m.Up = content
+		} else {
+			m.Down = content
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s migrations: %w", driver, err)
+	}
+	if len(byVersion) == 0 {
+		return nil, fmt.Errorf("no migrations found for driver %s", driver)
+	}
+
+	migrator := &Migrator{db: db, driver: driver}
+	for _, m := range byVersion {
+		migrator.migrations = append(migrator.migrations, m)
+	}
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+func (m *Migrator) init() error {
+	return m.db.Exec(
+		"CREATE TABLE IF NOT EXISTS schema_migrations (" +
+			"version INTEGER NOT NULL PRIMARY KEY, " +
+			"name VARCHAR(255) NOT NULL, " +
+			"applied_at DATETIME NOT NULL)",
+	).Error
+}
+
+func (m *Migrator) applied() (map[int]schemaMigration, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	rows := []schemaMigration{}
+	if err := m.db.Table("schema_migrations").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]schemaMigration)
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Up applies all pending migrations in order and returns how many ran
+func (m *Migrator) Up() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+
+		log.Info(fmt.Sprintf("Applying migration %04d_%s", mig.Version, mig.Name))
+		err := m.run(func(tx *gorm.DB) error {
+			if mig.Version == 1 && m.driver == "mysql" {
+				if err := adoptLegacySchema(tx); err != nil {
+					return err
+				}
+			}
+			if err := execScript(tx, mig.Up); err != nil {
+				return err
+			}
+			return tx.Table("schema_migrations").Create(&schemaMigration{
+				Version:   mig.Version,
+				Name:      mig.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return n, fmt.Errorf("error applying migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Down reverts the last steps applied migrations and returns how many ran
+func (m *Migrator) Down(steps int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == "" {
+			return n, fmt.Errorf("migration %04d_%s can't be reverted", mig.Version, mig.Name)
+		}
+
+		log.Info(fmt.Sprintf("Reverting migration %04d_%s", mig.Version, mig.Name))
+		err := m.run(func(tx *gorm.DB) error {
+			if err := execScript(tx, mig.Down); err != nil {
+				return err
+			}
+			return tx.Table("schema_migrations").
+				Where("version = ?", mig.Version).
+				Delete(&schemaMigration{}).Error
+		})
+		if err != nil {
+			return n, fmt.Errorf("error reverting migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// run runs fn in a transaction. SQLite can't drop columns, so down scripts
+// rebuild tables instead; dropping the old table would cascade to the rows
+// referencing it, so foreign keys are turned off for the run (which only
+// works outside a transaction) and checked before committing.
+func (m *Migrator) run(fn func(tx *gorm.DB) error) error {
+	if m.driver != "sqlite" {
+		return m.db.Transaction(fn)
+	}
+
+	var enabled int
+	if err := m.db.Raw("PRAGMA foreign_keys").Scan(&enabled).Error; err != nil {
+		return err
+	}
+	if enabled == 1 {
+		if err := m.db.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		defer m.db.Exec("PRAGMA foreign_keys = ON")
+	}
+
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		rows, err := tx.Raw("PRAGMA foreign_key_check").Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		if rows.Next() {
+			var table string
+			if err := rows.Scan(&table, new(interface{}), new(interface{}), new(interface{})); err != nil {
+				return err
+			}
+			return fmt.Errorf("foreign key violation in table %s", table)
+		}
+		return rows.Err()
+	})
+}
+
+// Status lists all known migrations and when they were applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := MigrationStatus{Migration: *mig}
+		if row, ok := applied[mig.Version]; ok {
+			appliedAt := row.AppliedAt
+			st.AppliedAt = &appliedAt
+		}
+		status = append(status, st)
+	}
+	return status, nil
+}
+
+// execScript runs each statement of a SQL script. Statements end with a
+// semicolon at the end of a line; lines starting with -- are comments.
+func execScript(db *gorm.DB, script string) error {
+	var stmt strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if err := db.Exec(stmt.String()).Error; err != nil {
+				return err
+			}
+			stmt.Reset()
+		}
+	}
+	if strings.TrimSpace(stmt.String()) != "" {
+		return db.Exec(stmt.String()).Error
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// legacyVideoColumns are the videos columns of the initial migration that
+// the old db.sql didn't create
+var legacyVideoColumns = []struct {
+	Name       string
+	Definition string
+}{
+	{"hls", "boolean NOT NULL DEFAULT 0"},
+	{"hls_path", "varchar(511) NOT NULL DEFAULT ''"},
+	{"status", "varchar(20) NOT NULL DEFAULT 'ready'"},
+	{"status_error", "text NOT NULL"},
+}
+
+// legacyScript makes the columns db.sql left nullable NOT NULL and turns its
+// timestamp columns, which MySQL may set on every update, into datetimes
+const legacyScript = `
+UPDATE videos SET
+    description = COALESCE(description, ''),
+    thumbnail_url = COALESCE(thumbnail_url, ''),
+    duration = COALESCE(duration, 0),
+    views = COALESCE(views, 0),
+    likes = COALESCE(likes, 0),
+    dislikes = COALESCE(dislikes, 0);
+ALTER TABLE videos
+    MODIFY description text NOT NULL,
+    MODIFY thumbnail_url varchar(511) NOT NULL DEFAULT '',
+    MODIFY duration int NOT NULL DEFAULT 0,
+    MODIFY views int NOT NULL DEFAULT 0,
+    MODIFY likes int NOT NULL DEFAULT 0,
+    MODIFY dislikes int NOT NULL DEFAULT 0,
+    MODIFY created_at datetime(3) NULL,
+    MODIFY updated_at datetime(3) NULL,
+    MODIFY deleted_at datetime(3) NULL;
+ALTER TABLE users
+    MODIFY created_at datetime(3) NULL,
+    MODIFY updated_at datetime(3) NULL,
+    MODIFY deleted_at datetime(3) NULL;
+ALTER TABLE comments
+    MODIFY created_at datetime(3) NULL,
+    MODIFY updated_at datetime(3) NULL,
+    MODIFY deleted_at datetime(3) NULL;
+`
+
+// legacyCategoryKeysScript replaces the video_categories foreign keys of
+// db.sql, which pointed c_id at videos and v_id at categories. Rows that
+// only satisfied the swapped keys can't be kept.
+const legacyCategoryKeysScript = `
+ALTER TABLE video_categories
+    DROP FOREIGN KEY fk_video_categories_categ_id,
+    DROP FOREIGN KEY fk_video_categories_video_id;
+DELETE FROM video_categories
+    WHERE v_id NOT IN (SELECT id FROM videos) OR c_id NOT IN (SELECT id FROM categories);
+ALTER TABLE video_categories
+    ADD CONSTRAINT fk_video_categories_video_id FOREIGN KEY (v_id) REFERENCES videos (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_video_categories_categ_id FOREIGN KEY (c_id) REFERENCES categories (id) ON DELETE CASCADE;
+`
+
+// adoptLegacySchema brings a MySQL database set up from the old db.sql to the
+// schema of the initial migration, which only creates missing tables. It
+// runs along with the initial migration and leaves new databases alone.
+func adoptLegacySchema(tx *gorm.DB) error {
+	rows, err := tx.Raw(
+		"SELECT column_name FROM information_schema.columns " +
+			"WHERE table_schema = DATABASE() AND table_name = 'videos'",
+	).Rows()
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[column] = true
+	}
+	rows.Close()
+	if len(existing) == 0 {
+		// a new database
+		return nil
+	}
+
+	for _, column := range legacyVideoColumns {
+		if existing[column.Name] {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE videos ADD COLUMN %s %s", column.Name, column.Definition)
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	if err := execScript(tx, legacyScript); err != nil {
+		return err
+	}
+
+	var referenced string
+	res := tx.Raw(
+		"SELECT referenced_table_name FROM information_schema.key_column_usage " +
+			"WHERE table_schema = DATABASE() AND table_name = 'video_categories' " +
+			"AND constraint_name = 'fk_video_categories_categ_id'",
+	).Scan(&referenced)
+	if res.Error != nil || referenced != "videos" {
+		return res.Error
+	}
+	return execScript(tx, legacyCategoryKeysScript)
+}
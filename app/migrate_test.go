@@ -0,0 +1,134 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prologic/tube/models"
+	"gorm.io/gorm"
+)
+
+// queryRows returns the rows of a query as maps. Pragmas have no column
+// types, which gorm needs to scan into maps, so the rows are scanned here.
+func queryRows(t *testing.T, db *gorm.DB, query string) []map[string]interface{} {
+	t.Helper()
+	rows, err := db.Raw(query).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		row := make(map[string]interface{})
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// sqliteSchema describes the columns, foreign keys and indexes of all tables
+func sqliteSchema(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+
+	var schema strings.Builder
+	tables := queryRows(t, db, "SELECT name FROM sqlite_master WHERE type = 'table' "+
+		"AND name NOT IN ('sqlite_sequence', 'schema_migrations') ORDER BY name")
+	for _, table := range tables {
+		fmt.Fprintf(&schema, "%s\n", table["name"])
+		for _, pragma := range []string{"table_info", "foreign_key_list", "index_list"} {
+			for _, row := range queryRows(t, db, fmt.Sprintf("PRAGMA %s(%s)", pragma, table["name"])) {
+				// index numbers follow the order indexes were created in
+				delete(row, "seq")
+				fmt.Fprintf(&schema, "  %s %v\n", pragma, row)
+				if pragma == "index_list" {
+					info := queryRows(t, db, fmt.Sprintf("PRAGMA index_info(%s)", row["name"]))
+					fmt.Fprintf(&schema, "    %v\n", info)
+				}
+			}
+		}
+	}
+	return schema.String()
+}
+
+func TestMigrationsDown(t *testing.T) {
+	_, db := newTestDB(t)
+	migrator, err := NewMigrator(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the schema before and after each migration
+	schemas := []string{sqliteSchema(t, db)}
+	for i, mig := range migrator.migrations {
+		step := &Migrator{db: db, driver: "sqlite", migrations: migrator.migrations[:i+1]}
+		if n, err := step.Up(); err != nil || n != 1 {
+			t.Fatalf("applying %04d_%s: applied %d: %v", mig.Version, mig.Name, n, err)
+		}
+		schemas = append(schemas, sqliteSchema(t, db))
+	}
+
+	// rows the rebuilt tables and the tables referencing them must keep
+	app := &App{DataBase: db}
+	user := newTestUser(t, app, "user")
+	video := newTestVideo(t, app, user.ID)
+	comment := &models.Comment{VideoID: video.ID, UserID: user.ID, Text: "comment"}
+	if err := db.Create(comment).Error; err != nil {
+		t.Fatal(err)
+	}
+	reply := &models.Comment{VideoID: video.ID, UserID: user.ID, Text: "reply"}
+	reply.ReplyTo.SetValid(int64(comment.ID))
+	if err := db.Create(reply).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for i := len(migrator.migrations) - 1; i >= 0; i-- {
+		mig := migrator.migrations[i]
+		if n, err := migrator.Down(1); err != nil || n != 1 {
+			t.Fatalf("reverting %04d_%s: reverted %d: %v", mig.Version, mig.Name, n, err)
+		}
+		if got := sqliteSchema(t, db); got != schemas[i] {
+			t.Fatalf("schema after reverting %04d_%s:\n%s\nwant:\n%s", mig.Version, mig.Name, got, schemas[i])
+		}
+		if i == 0 {
+			break
+		}
+		for table, want := range map[string]int64{"users": 1, "videos": 1, "comments": 2} {
+			var n int64
+			if err := db.Table(table).Count(&n).Error; err != nil {
+				t.Fatal(err)
+			}
+			if n != want {
+				t.Errorf("%d %s after reverting %04d_%s, want %d", n, table, mig.Version, mig.Name, want)
+			}
+		}
+	}
+
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sqliteSchema(t, db); got != schemas[len(schemas)-1] {
+		t.Fatalf("schema after migrating up again:\n%s\nwant:\n%s", got, schemas[len(schemas)-1])
+	}
+}
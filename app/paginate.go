@@ -0,0 +1,215 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// page sizes of list endpoints
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// sortKey orders a list by a column, with the id as tie breaker
+type sortKey struct {
+	Column string
+	Desc   bool
+}
+
+// sort keys of video lists
+var videoSorts = map[string]sortKey{
+	"newest":   {Column: "created_at", Desc: true},
+	"views":    {Column: "views", Desc: true},
+	"likes":    {Column: "likes", Desc: true},
+	"duration": {Column: "duration", Desc: true},
+}
+
+// sort keys of comment lists
+var commentSorts = map[string]sortKey{
+	"newest": {Column: "created_at", Desc: true},
+	"oldest": {Column: "created_at"},
+	"top":    {Column: "score", Desc: true},
+}
+
+// sort keys of subscription lists
+var subscriptionSorts = map[string]sortKey{
+	"newest": {Column: "created_at", Desc: true},
+	"oldest": {Column: "created_at"},
+}
+
+// sort keys of the subscription feed, which is always newest first
+var feedSorts = map[string]sortKey{
+	"newest": {Column: "created_at", Desc: true},
+}
+
+// sort keys of user lists
+var userSorts = map[string]sortKey{
+	"newest": {Column: "created_at", Desc: true},
+	"oldest": {Column: "created_at"},
+}
+
+// sort keys of the audit log
+var auditSorts = map[string]sortKey{
+	"newest": {Column: "created_at", Desc: true},
+	"oldest": {Column: "created_at"},
+}
+
+// pageResponse is the envelope of all paginated list responses
+type pageResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+	Total      int64       `json:"total"`
+}
+
+// cursor points after the last item of a page, by its sort value and id.
+// It is sent to clients base64 encoded and must be treated as opaque by
+// them.
+type cursor struct {
+	Sort   string          `json:"s"`
+	LastID uint            `json:"id,omitempty"`
+	Value  json.RawMessage `json:"v,omitempty"`
+	Offset int             `json:"o,omitempty"`
+}
+
+func (c *cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	return c, nil
+}
+
+// page is a request for one page of a list
+type page struct {
+	Sort   string
+	Key    sortKey
+	Limit  int
+	Cursor *cursor
+}
+
+// parsePage reads the limit, sort and cursor query parameters. sorts are
+// the sort keys the list supports.
+func parsePage(query url.Values, sorts map[string]sortKey, defaultSort string) (*page, error) {
+	p := &page{Sort: query.Get("sort"), Limit: defaultPageSize}
+	if p.Sort == "" {
+		p.Sort = defaultSort
+	}
+	key, ok := sorts[p.Sort]
+	if !ok {
+		return nil, fmt.Errorf("Invalid sort: %s", p.Sort)
+	}
+	p.Key = key
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("Invalid limit: %s", value)
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+		p.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		c, err := decodeCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != p.Sort {
+			return nil, fmt.Errorf("Cursor does not match sort %s", p.Sort)
+		}
+		if c.LastID > 0 && len(c.Value) == 0 {
+			return nil, fmt.Errorf("Invalid cursor")
+		}
+		p.Cursor = c
+	}
+	return p, nil
+}
+
+// find loads a page of query's results from table into dest, a pointer to
+// a slice of models, along with the given associations. query is called
+// twice: to count all results and to load the page.
+func (p *page) find(query func() *gorm.DB, table string, dest interface{}, preloads ...string) (*pageResponse, error) {
+	resp := &pageResponse{}
+	if err := query().Count(&resp.Total).Error; err != nil {
+		return nil, err
+	}
+
+	// the model field sorted by, whose value the cursor carries
+	stmt := query().Statement
+	if err := stmt.Parse(dest); err != nil {
+		return nil, err
+	}
+	field := stmt.Schema.LookUpField(p.Key.Column)
+	if field == nil {
+		return nil, fmt.Errorf("no field for sort column %s of %s", p.Key.Column, table)
+	}
+
+	tx := query()
+	for _, preload := range preloads {
+		tx = tx.Preload(preload)
+	}
+	if p.Cursor != nil && p.Cursor.LastID > 0 {
+		// rows after the last one of the previous page
+		last := reflect.New(field.FieldType)
+		if err := json.Unmarshal(p.Cursor.Value, last.Interface()); err != nil {
+			return nil, fmt.Errorf("error decoding cursor value: %w", err)
+		}
+		cmp := ">"
+		if p.Key.Desc {
+			cmp = "<"
+		}
+		col := fmt.Sprintf("%s.%s", table, p.Key.Column)
+		tx = tx.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND %s.id %s ?))", col, cmp, col, table, cmp),
+			last.Elem().Interface(), last.Elem().Interface(), p.Cursor.LastID,
+		)
+	}
+
+	order := "ASC"
+	if p.Key.Desc {
+		order = "DESC"
+	}
+	tx = tx.Order(fmt.Sprintf("%s.%s %s, %s.id %s", table, p.Key.Column, order, table, order))
+
+	// one extra row tells whether there is a next page
+	if err := tx.Limit(p.Limit + 1).Find(dest).Error; err != nil {
+		return nil, err
+	}
+
+	items := reflect.ValueOf(dest).Elem()
+	if items.Len() > p.Limit {
+		items.Set(items.Slice(0, p.Limit))
+		next := &cursor{Sort: p.Sort}
+		// an empty page is followed by the first rows
+		if p.Limit > 0 {
+			last := items.Index(p.Limit - 1)
+			value, err := json.Marshal(last.FieldByName(field.Name).Interface())
+			if err != nil {
+				return nil, err
+			}
+			next.LastID = uint(last.FieldByName("ID").Uint())
+			next.Value = value
+		}
+		resp.NextCursor = next.encode()
+	}
+	resp.Items = items.Interface()
+	return resp, nil
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Permission is an action a role may be granted
+type Permission string
+
+// Permissions checked by routes
+const (
+	PermUpload           Permission = "upload"
+	PermDeleteAnyVideo   Permission = "delete_any_video"
+	PermManageVideos     Permission = "manage_videos"
+	PermDeleteAnyComment Permission = "delete_any_comment"
+	PermManageUsers      Permission = "manage_users"
+	PermManageCategories Permission = "manage_categories"
+	PermViewAuditLog     Permission = "view_audit_log"
+)
+
+// rolePermissions is the permission matrix. Any authenticated user may
+// comment, react and manage their own videos; everything else has to be
+// granted here.
+var rolePermissions = map[string][]Permission{
+	models.RoleViewer:   {},
+	models.RoleUploader: {PermUpload},
+	models.RoleModerator: {
+		PermUpload,
+		PermDeleteAnyVideo,
+		PermManageVideos,
+		PermDeleteAnyComment,
+		PermViewAuditLog,
+	},
+	models.RoleAdmin: {
+		PermUpload,
+		PermDeleteAnyVideo,
+		PermManageVideos,
+		PermDeleteAnyComment,
+		PermManageUsers,
+		PermManageCategories,
+		PermViewAuditLog,
+	},
+}
+
+// hasPermission reports whether role grants perm
+func hasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the role of the authenticated user making the request
+func roleFromContext(r *http.Request) string {
+	role, _ := r.Context().Value("role").(string)
+	return role
+}
+
+// can reports whether the authenticated user making the request has perm
+func can(r *http.Request, perm Permission) bool {
+	return hasPermission(roleFromContext(r), perm)
+}
+
+// MIDDLEWARE FOR AUTHENTICATION AND AUTHORIZATION
+// authorize authenticates the request and requires the caller's role to
+// grant every one of perms. With no perms any authenticated user passes.
+func (app *App) authorize(perms ...Permission) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tk, err := app.authenticate(r)
+			if err == errNoToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte("Token is not provided"))
+				return
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte("Authentication error"))
+				return
+			}
+
+			for _, perm := range perms {
+				if !hasPermission(tk.Role, perm) {
+					w.WriteHeader(http.StatusForbidden)
+					w.Write([]byte("You don't have permission to do this!"))
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), "userID", tk.UserID)
+			ctx = context.WithValue(ctx, "role", tk.Role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// protect wraps a handler so it requires an authenticated user with perms
+func (app *App) protect(handler http.HandlerFunc, perms ...Permission) http.Handler {
+	return app.authorize(perms...)(handler)
+}
+
+// HTTP handler for [PUT] /admin/user/id/role
+func (app *App) adminSetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	req := struct {
+		Role string `json:"role"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if _, ok := rolePermissions[req.Role]; !ok {
+		http.Error(w, fmt.Sprintf("Unknown role: %s", req.Role), http.StatusBadRequest)
+		return
+	}
+
+	user := &models.User{}
+	app.DataBase.Find(user, id)
+	if user.ID <= 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		log.Info("User not found")
+		return
+	}
+
+	log.Info(fmt.Sprintf("Changing role of user %d to %s", user.ID, req.Role))
+	res := app.DataBase.Model(user).Update("role", req.Role)
+	if res.Error != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(res.Error)
+		return
+	}
+
+	user.Password = ""
+	json.NewEncoder(w).Encode(user)
+}
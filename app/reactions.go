@@ -0,0 +1,276 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reactions of a user to a video
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+	ReactionNone    = "none"
+)
+
+const jobReconcileReactions = "reconcile_reactions"
+
+// reactionResponse is the reaction of the user to a video along with the
+// video's counters
+type reactionResponse struct {
+	Reaction string `json:"reaction"`
+	Likes    int    `json:"likes"`
+	Dislikes int    `json:"dislikes"`
+}
+
+// setReaction sets the reaction of user uid to a video. The likes row and
+// the video's counters change in one transaction, counters by increments
+// of what was actually changed so concurrent requests can't double count.
+func (app *App) setReaction(videoID, uid uint, reaction string) error {
+	return app.DataBase.Transaction(func(tx *gorm.DB) error {
+		var likes, dislikes int
+
+		if reaction == ReactionNone {
+			for _, isDislike := range []bool{false, true} {
+				res := tx.
+					Where("uid = ? AND v_id = ? AND is_dislike = ?", uid, videoID, isDislike).
+					Delete(&models.Like{})
+				if res.Error != nil {
+					return res.Error
+				}
+				if isDislike {
+					dislikes -= int(res.RowsAffected)
+				} else {
+					likes -= int(res.RowsAffected)
+				}
+			}
+		} else {
+			isDislike := reaction == ReactionDislike
+			// the unique (uid, v_id) index keeps a second reaction out
+			res := tx.
+				Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.Like{UID: uid, VID: videoID, IsDislike: isDislike})
+			if res.Error != nil {
+				return res.Error
+			}
+			changed := res.RowsAffected > 0
+			if !changed {
+				// switch an existing reaction to the other one
+				res := tx.
+					Model(&models.Like{}).
+					Where("uid = ? AND v_id = ? AND is_dislike = ?", uid, videoID, !isDislike).
+					UpdateColumn("is_dislike", isDislike)
+				if res.Error != nil {
+					return res.Error
+				}
+				if res.RowsAffected > 0 {
+					changed = true
+					if isDislike {
+						likes--
+					} else {
+						dislikes--
+					}
+				}
+			}
+			if changed {
+				if isDislike {
+					dislikes++
+				} else {
+					likes++
+				}
+			}
+		}
+
+		if likes == 0 && dislikes == 0 {
+			return nil
+		}
+		res := tx.
+			Model(&models.Video{}).
+			Where("id = ?", videoID).
+			UpdateColumns(map[string]interface{}{
+				"likes":    gorm.Expr("likes + ?", likes),
+				"dislikes": gorm.Expr("dislikes + ?", dislikes),
+			})
+		return res.Error
+	})
+}
+
+// returns the reaction of user uid to a video
+func (app *App) getReaction(videoID, uid uint) (string, error) {
+	like := &models.Like{}
+	res := app.DataBase.Where("uid = ? AND v_id = ?", uid, videoID).Limit(1).Find(like)
+	switch {
+	case res.Error != nil:
+		return "", res.Error
+	case like.ID <= 0:
+		return ReactionNone, nil
+	case like.IsDislike:
+		return ReactionDislike, nil
+	default:
+		return ReactionLike, nil
+	}
+}
+
+func (app *App) writeReactionResponse(w http.ResponseWriter, video *models.Video, uid uint) {
+	reaction, err := app.getReaction(video.ID, uid)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&reactionResponse{
+		Reaction: reaction,
+		Likes:    video.Likes,
+		Dislikes: video.Dislikes,
+	})
+}
+
+// HTTP handler for [GET] /api/video/id/reaction
+func (app *App) apiGetReactionHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+
+	video := &models.Video{}
+	app.DataBase.Find(video, mux.Vars(r)["id"])
+	if video.ID <= 0 {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+	app.writeReactionResponse(w, video, uid)
+}
+
+// HTTP handler for [PUT] /api/video/id/reaction: sets the reaction of the
+// user to like, dislike or none
+func (app *App) apiSetReactionHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+
+	req := struct {
+		Reaction string `json:"reaction"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	switch req.Reaction {
+	case ReactionLike, ReactionDislike, ReactionNone:
+	default:
+		http.Error(w, "Reaction must be like, dislike or none", http.StatusBadRequest)
+		return
+	}
+
+	video := &models.Video{}
+	app.DataBase.Find(video, mux.Vars(r)["id"])
+	if video.ID <= 0 || video.Status != models.VideoReady {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return
+	}
+
+	if err := app.setReaction(video.ID, uid, req.Reaction); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	// counters as changed by everyone
+	app.DataBase.Find(video, video.ID)
+	app.writeReactionResponse(w, video, uid)
+}
+
+// enqueues a reconciliation of the reaction counters every reconcile
+// interval, unless one is still waiting, until ctx is cancelled
+func (app *App) scheduleReconcileReactions(ctx context.Context) {
+	interval := time.Duration(app.Config.Jobs.ReconcileInterval) * time.Second
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var pending int64
+		res := app.DataBase.
+			Model(&models.Job{}).
+			Where("type = ? AND state IN ?", jobReconcileReactions, []string{models.JobQueued, models.JobRunning}).
+			Count(&pending)
+		if res.Error != nil {
+			log.WithError(res.Error).Error("error checking reconciliation jobs")
+		} else if pending == 0 {
+			if _, err := app.Jobs.Enqueue(jobReconcileReactions, 0, struct{}{}); err != nil {
+				log.WithError(err).Error("error enqueuing reconciliation job")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// job handler for jobReconcileReactions: recomputes the like and dislike
+// counters of videos from the likes table, and the reply counts, like
+// counts and scores of comments from their replies and the comment_likes
+// table, correcting any drift
+func (app *App) reconcileReactionsJob(ctx context.Context, job *models.Job) error {
+	count := "(SELECT COUNT(*) FROM likes WHERE likes.v_id = videos.id AND likes.is_dislike = ?)"
+	res := app.DataBase.WithContext(ctx).Exec(
+		"UPDATE videos SET likes = "+count+", dislikes = "+count+" "+
+			"WHERE likes <> "+count+" OR dislikes <> "+count,
+		false, true, false, true,
+	)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		log.WithField("videos", res.RowsAffected).Warn("reconciled reaction counters")
+	}
+
+	res = app.DataBase.WithContext(ctx).Exec(reconcileCommentsQuery(app.Config.Database.Driver))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		log.WithField("comments", res.RowsAffected).Warn("reconciled comment counters")
+	}
+	return nil
+}
+
+// reconcileCommentsQuery returns the statement setting the reply count,
+// like count and score of comments that are off. The replies counted are
+// the listed ones, deleted ones only while they have replies themselves.
+// MySQL can't update comments from a subquery on comments, but from a
+// derived table joined.
+func reconcileCommentsQuery(driver string) string {
+	visible := "(r.deleted_at IS NULL OR EXISTS " +
+		"(SELECT 1 FROM comments AS rr WHERE rr.reply_to = r.id))"
+
+	if driver == "mysql" {
+		replies := "COALESCE(replies.n, 0)"
+		likes := "COALESCE(comment_likes.n, 0)"
+		return "UPDATE comments " +
+			"LEFT JOIN (SELECT r.reply_to, COUNT(*) AS n FROM comments AS r " +
+			"WHERE r.reply_to IS NOT NULL AND " + visible + " GROUP BY r.reply_to) AS replies " +
+			"ON replies.reply_to = comments.id " +
+			"LEFT JOIN (SELECT comment_id, COUNT(*) AS n FROM comment_likes GROUP BY comment_id) AS comment_likes " +
+			"ON comment_likes.comment_id = comments.id " +
+			"SET comments.reply_count = " + replies + ", comments.like_count = " + likes + ", " +
+			"comments.score = " + replies + " + " + likes + " " +
+			"WHERE comments.reply_count <> " + replies + " OR comments.like_count <> " + likes + " " +
+			"OR comments.score <> " + replies + " + " + likes
+	}
+
+	replies := "(SELECT COUNT(*) FROM comments AS r WHERE r.reply_to = comments.id AND " + visible + ")"
+	likes := "(SELECT COUNT(*) FROM comment_likes WHERE comment_likes.comment_id = comments.id)"
+	return "UPDATE comments SET reply_count = " + replies + ", like_count = " + likes + ", " +
+		"score = " + replies + " + " + likes + " " +
+		"WHERE reply_count <> " + replies + " OR like_count <> " + likes + " " +
+		"OR score <> " + replies + " + " + likes
+}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prologic/tube/models"
+)
+
+func TestSetReaction(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	viewer := newTestUser(t, app, "viewer")
+	video := newTestVideo(t, app, owner.ID)
+
+	tests := []struct {
+		reaction        string
+		likes, dislikes int
+	}{
+		{ReactionLike, 1, 0},
+		{ReactionLike, 1, 0},
+		{ReactionDislike, 0, 1},
+		{ReactionNone, 0, 0},
+		{ReactionNone, 0, 0},
+		{ReactionDislike, 0, 1},
+	}
+	for _, test := range tests {
+		resp := &reactionResponse{}
+		r := newTestRequest("PUT", "/", fmt.Sprintf(`{"reaction": %q}`, test.reaction), viewer.ID, id(video.ID))
+		serve(t, app.apiSetReactionHandler, r, 200, resp)
+		if resp.Reaction != test.reaction || resp.Likes != test.likes || resp.Dislikes != test.dislikes {
+			t.Errorf("%s: got %+v, want %d likes and %d dislikes", test.reaction, resp, test.likes, test.dislikes)
+		}
+	}
+
+	r := newTestRequest("PUT", "/", `{"reaction": "love"}`, viewer.ID, id(video.ID))
+	serve(t, app.apiSetReactionHandler, r, 400, nil)
+}
+
+func TestSetReactionConcurrently(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	video := newTestVideo(t, app, owner.ID)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		user := newTestUser(t, app, fmt.Sprintf("viewer%d", i))
+		for j := 0; j < 3; j++ {
+			wg.Add(1)
+			go func(uid uint) {
+				defer wg.Done()
+				if err := app.setReaction(video.ID, uid, ReactionLike); err != nil {
+					t.Error(err)
+				}
+			}(user.ID)
+		}
+	}
+	wg.Wait()
+
+	app.DataBase.Find(video, video.ID)
+	if video.Likes != 10 {
+		t.Errorf("got %d likes, want 10", video.Likes)
+	}
+}
+
+func TestReconcileReactionsJob(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	viewer := newTestUser(t, app, "viewer")
+	video := newTestVideo(t, app, owner.ID)
+	if err := app.setReaction(video.ID, viewer.ID, ReactionDislike); err != nil {
+		t.Fatal(err)
+	}
+	app.DataBase.Model(video).UpdateColumns(map[string]interface{}{"likes": 7, "dislikes": 0})
+
+	if err := app.reconcileReactionsJob(context.Background(), &models.Job{}); err != nil {
+		t.Fatal(err)
+	}
+	app.DataBase.Find(video, video.ID)
+	if video.Likes != 0 || video.Dislikes != 1 {
+		t.Errorf("got %d likes and %d dislikes, want 0 and 1", video.Likes, video.Dislikes)
+	}
+}
+
+func TestReconcileCommentCounters(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	viewer := newTestUser(t, app, "viewer")
+	video := newTestVideo(t, app, owner.ID)
+	comment := newTestComment(t, app, viewer.ID, video.ID, 0, "comment")
+	reply := newTestComment(t, app, owner.ID, video.ID, comment.ID, "reply")
+	newTestComment(t, app, viewer.ID, video.ID, reply.ID, "nested reply")
+	leaf := newTestComment(t, app, owner.ID, video.ID, comment.ID, "leaf")
+	if err := app.setCommentLike(comment.ID, owner.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	// deleted replies count while they have replies themselves
+	serve(t, app.apiDeleteCommentHandler, newTestRequest("DELETE", "/", "", owner.ID, id(reply.ID)), 200, nil)
+	serve(t, app.apiDeleteCommentHandler, newTestRequest("DELETE", "/", "", owner.ID, id(leaf.ID)), 200, nil)
+
+	counters := map[string]interface{}{"reply_count": 5, "like_count": 3, "score": 0}
+	app.DataBase.Model(comment).UpdateColumns(counters)
+	app.DataBase.Model(reply).UpdateColumns(counters)
+
+	if err := app.reconcileReactionsJob(context.Background(), &models.Job{}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		comment               *models.Comment
+		replies, likes, score int
+	}{
+		{comment, 1, 1, 2},
+		{reply, 1, 0, 1},
+	}
+	for _, test := range tests {
+		app.DataBase.Find(test.comment, test.comment.ID)
+		c := test.comment
+		if c.ReplyCount != test.replies || c.LikeCount != test.likes || c.Score != test.score {
+			t.Errorf("comment %d has %d replies, %d likes and score %d, want %d, %d and %d",
+				c.ID, c.ReplyCount, c.LikeCount, c.Score, test.replies, test.likes, test.score)
+		}
+	}
+}
+
+func TestScheduleReconcileReactionsStops(t *testing.T) {
+	app := newTestApp(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.scheduleReconcileReactions(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduleReconcileReactions didn't return once cancelled")
+	}
+
+	var jobs int64
+	app.DataBase.Model(&models.Job{}).Where("type = ?", jobReconcileReactions).Count(&jobs)
+	if jobs != 1 {
+		t.Errorf("got %d reconciliation jobs, want the one enqueued on start", jobs)
+	}
+}
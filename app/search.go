@@ -0,0 +1,381 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/search"
+	log "github.com/sirupsen/logrus"
+)
+
+// opens the configured search index, building it from the database when
+// it is empty
+func (app *App) openSearch() error {
+	backend := app.Config.Search.Backend
+	if backend == "" {
+		backend = search.BackendBleve
+		if app.Config.Database.Driver == "mysql" {
+			backend = search.BackendMySQL
+		}
+	}
+	if backend == search.BackendMySQL && app.Config.Database.Driver != "mysql" {
+		return fmt.Errorf("search backend mysql requires a mysql database")
+	}
+
+	index, err := search.Open(backend, app.Config.Search.Path, app.DataBase)
+	if err != nil {
+		return fmt.Errorf("error opening search index: %w", err)
+	}
+	app.Search = index
+
+	count, err := index.DocCount()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		go app.reindexSearch()
+	}
+	return nil
+}
+
+// adds all ready videos, users and comments on ready videos to the search
+// index
+func (app *App) reindexSearch() {
+	videos := []models.Video{}
+	res := app.DataBase.
+		Preload("Categories").
+		Preload("User").
+		Where("status = ?", models.VideoReady).
+		Find(&videos)
+	if res.Error != nil {
+		log.WithError(res.Error).Error("error loading videos to index")
+		return
+	}
+	users := []models.User{}
+	if res := app.DataBase.Find(&users); res.Error != nil {
+		log.WithError(res.Error).Error("error loading users to index")
+		return
+	}
+	comments := []models.Comment{}
+	res = app.DataBase.
+		Where("deleted_at IS NULL").
+		Where("video_id IN (SELECT id FROM videos WHERE status = ?)", models.VideoReady).
+		Find(&comments)
+	if res.Error != nil {
+		log.WithError(res.Error).Error("error loading comments to index")
+		return
+	}
+	if len(videos)+len(users)+len(comments) == 0 {
+		return
+	}
+
+	log.Info(fmt.Sprintf("Indexing %d videos, %d users and %d comments for search", len(videos), len(users), len(comments)))
+	for i := range videos {
+		if err := app.Search.Index(&videos[i]); err != nil {
+			log.WithError(err).WithField("video", videos[i].ID).Error("error indexing video")
+		}
+	}
+	for i := range users {
+		if err := app.Search.IndexUser(&users[i]); err != nil {
+			log.WithError(err).WithField("user", users[i].ID).Error("error indexing user")
+		}
+	}
+	for i := range comments {
+		if err := app.Search.IndexComment(&comments[i]); err != nil {
+			log.WithError(err).WithField("comment", comments[i].ID).Error("error indexing comment")
+		}
+	}
+}
+
+// updates the search index after a video was changed. Only ready videos
+// are searchable. Failures are logged; the index catches up on next change.
+func (app *App) indexVideo(id uint) {
+	video := &models.Video{}
+	app.DataBase.
+		Preload("Categories").
+		Preload("User").
+		Find(video, id)
+	if video.ID <= 0 || video.Status != models.VideoReady {
+		app.unindexVideo(id)
+		return
+	}
+
+	if err := app.Search.Index(video); err != nil {
+		log.WithError(err).WithField("video", id).Error("error indexing video")
+	}
+}
+
+// removes a video from the search index
+func (app *App) unindexVideo(id uint) {
+	if err := app.Search.Delete(search.TypeVideo, id); err != nil {
+		log.WithError(err).WithField("video", id).Error("error removing video from index")
+	}
+}
+
+// updates the search index after a user was created or changed
+func (app *App) indexUser(id uint) {
+	user := &models.User{}
+	app.DataBase.Find(user, id)
+	if user.ID <= 0 {
+		app.unindexUser(id)
+		return
+	}
+
+	if err := app.Search.IndexUser(user); err != nil {
+		log.WithError(err).WithField("user", id).Error("error indexing user")
+	}
+}
+
+// removes a user from the search index
+func (app *App) unindexUser(id uint) {
+	if err := app.Search.Delete(search.TypeUser, id); err != nil {
+		log.WithError(err).WithField("user", id).Error("error removing user from index")
+	}
+}
+
+// updates the search index after a comment was created, edited or
+// deleted. Deleted comments aren't searchable.
+func (app *App) indexComment(id uint) {
+	comment := &models.Comment{}
+	app.DataBase.Find(comment, id)
+	if comment.ID <= 0 || comment.DeletedAt != nil {
+		app.unindexComment(id)
+		return
+	}
+
+	if err := app.Search.IndexComment(comment); err != nil {
+		log.WithError(err).WithField("comment", id).Error("error indexing comment")
+	}
+}
+
+// removes a comment from the search index
+func (app *App) unindexComment(id uint) {
+	if err := app.Search.Delete(search.TypeComment, id); err != nil {
+		log.WithError(err).WithField("comment", id).Error("error removing comment from index")
+	}
+}
+
+// HTTP handler for /v/search
+// Query parameters: q, type (video, user, comment), category, uploader,
+// video, min_duration, max_duration, after, before (RFC 3339 or
+// YYYY-MM-DD), sort, limit, cursor
+func (app *App) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := app.Search.Search(query)
+	if err != nil {
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	var items interface{}
+	switch query.Type {
+	case search.TypeUser:
+		items, err = app.searchUsers(result.IDs)
+	case search.TypeComment:
+		items, err = app.searchComments(result.IDs)
+	default:
+		items, err = app.searchVideos(result.IDs)
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	// search results can't be continued from the last id, so the cursor
+	// holds an offset
+	resp := &pageResponse{Items: items, Total: int64(result.Total)}
+	if next := query.Offset + query.Limit; next < result.Total {
+		resp.NextCursor = (&cursor{Sort: query.Sort, Offset: next}).encode()
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// loads the ready videos with ids, in the order of ids
+func (app *App) searchVideos(ids []uint) ([]models.Video, error) {
+	found := []models.Video{}
+	if len(ids) > 0 {
+		res := app.DataBase.
+			Preload("Categories").
+			Preload("Categories.Category").
+			Preload("User").
+			Where("status = ?", models.VideoReady).
+			Find(&found, ids)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+	}
+
+	byID := make(map[uint]models.Video, len(found))
+	for _, video := range found {
+		video.User.Password = ""
+		byID[video.ID] = video
+	}
+	videos := make([]models.Video, 0, len(found))
+	for _, id := range ids {
+		if video, ok := byID[id]; ok {
+			videos = append(videos, video)
+		}
+	}
+	return videos, nil
+}
+
+// loads the users with ids, in the order of ids
+func (app *App) searchUsers(ids []uint) ([]models.User, error) {
+	found := []models.User{}
+	if len(ids) > 0 {
+		if res := app.DataBase.Find(&found, ids); res.Error != nil {
+			return nil, res.Error
+		}
+	}
+
+	byID := make(map[uint]models.User, len(found))
+	for _, user := range found {
+		user.Password = ""
+		byID[user.ID] = user
+	}
+	users := make([]models.User, 0, len(found))
+	for _, id := range ids {
+		if user, ok := byID[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// loads the comments with ids that are still listed on ready videos, in
+// the order of ids
+func (app *App) searchComments(ids []uint) ([]models.Comment, error) {
+	found := []models.Comment{}
+	if len(ids) > 0 {
+		res := app.DataBase.
+			Where("deleted_at IS NULL").
+			Where("video_id IN (SELECT id FROM videos WHERE status = ?)", models.VideoReady).
+			Find(&found, ids)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+	}
+
+	byID := make(map[uint]models.Comment, len(found))
+	for _, comment := range found {
+		byID[comment.ID] = comment
+	}
+	comments := make([]models.Comment, 0, len(found))
+	for _, id := range ids {
+		if comment, ok := byID[id]; ok {
+			comments = append(comments, comment)
+		}
+	}
+	if err := app.loadCommentDetails(comments, 0); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func parseSearchQuery(params url.Values) (*search.Query, error) {
+	query := &search.Query{
+		Type:  params.Get("type"),
+		Text:  params.Get("q"),
+		Sort:  params.Get("sort"),
+		Limit: defaultPageSize,
+	}
+
+	if query.Type == "" {
+		query.Type = search.TypeVideo
+	}
+	if !search.ValidType(query.Type) {
+		return nil, fmt.Errorf("Invalid type: %s", query.Type)
+	}
+	if query.Sort == "" {
+		query.Sort = search.SortRelevance
+	}
+	if !search.ValidSort(query.Type, query.Sort) {
+		return nil, fmt.Errorf("Invalid sort: %s", query.Sort)
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("Invalid limit: %s", value)
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+		query.Limit = limit
+	}
+	if value := params.Get("cursor"); value != "" {
+		c, err := decodeCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != query.Sort || c.Offset < 0 {
+			return nil, fmt.Errorf("Cursor does not match sort %s", query.Sort)
+		}
+		query.Offset = c.Offset
+	}
+
+	uints := map[string]*uint{
+		"category": &query.Category,
+		"uploader": &query.UserID,
+		"video":    &query.VideoID,
+	}
+	for name, dst := range uints {
+		if value := params.Get(name); value != "" {
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s: %s", name, value)
+			}
+			*dst = uint(n)
+		}
+	}
+
+	ints := map[string]*int{
+		"min_duration": &query.MinDuration,
+		"max_duration": &query.MaxDuration,
+	}
+	for name, dst := range ints {
+		if value := params.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("Invalid %s: %s", name, value)
+			}
+			*dst = n
+		}
+	}
+
+	dates := map[string]*time.Time{
+		"after":  &query.After,
+		"before": &query.Before,
+	}
+	for name, dst := range dates {
+		if value := params.Get(name); value != "" {
+			t, err := parseDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s: %s", name, value)
+			}
+			*dst = t
+		}
+	}
+
+	return query, nil
+}
+
+// parses a RFC 3339 timestamp or a YYYY-MM-DD date
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
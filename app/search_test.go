@@ -0,0 +1,61 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prologic/tube/models"
+)
+
+func TestSearch(t *testing.T) {
+	app := newTestApp(t)
+	owner := &models.User{}
+	body := `{"name": "alice", "email": "alice@example.com", "password": "secret"}`
+	serve(t, app.apiCreateUserHandler, newTestRequest("POST", "/", body, 0, nil), 200, owner)
+	viewer := newTestUser(t, app, "bob")
+	app.indexUser(viewer.ID)
+
+	video := newTestVideo(t, app, owner.ID)
+	app.DataBase.Model(video).Update("title", "knitting socks")
+	app.indexVideo(video.ID)
+	newTestComment(t, app, viewer.ID, video.ID, 0, "lovely socks")
+	other := newTestComment(t, app, owner.ID, video.ID, 0, "thanks for the socks")
+
+	videos := &struct {
+		Items []models.Video `json:"items"`
+		Total int64          `json:"total"`
+	}{}
+	serve(t, app.searchHandler, newTestRequest("GET", "/?q=knitting", "", 0, nil), 200, videos)
+	if videos.Total != 1 || videos.Items[0].ID != video.ID || videos.Items[0].User.Password != "" {
+		t.Errorf("got videos %+v, want the video without its uploader's password", videos.Items)
+	}
+
+	users := &struct {
+		Items []models.User `json:"items"`
+	}{}
+	serve(t, app.searchHandler, newTestRequest("GET", "/?type=user&q=alice", "", 0, nil), 200, users)
+	if len(users.Items) != 1 || users.Items[0].ID != owner.ID || users.Items[0].Password != "" {
+		t.Errorf("got users %+v, want alice without password", users.Items)
+	}
+
+	comments := &commentPage{}
+	r := newTestRequest("GET", "/?type=comment&q=socks&sort=oldest", "", 0, nil)
+	serve(t, app.searchHandler, r, 200, comments)
+	if got := commentTexts(comments.Items); fmt.Sprint(got) != "[lovely socks thanks for the socks]" {
+		t.Errorf("got comments %v, want both", got)
+	}
+	if comments.Items[0].User.Name != "bob" || comments.Items[0].User.Password != "" {
+		t.Errorf("got comment %+v, want by bob without password", comments.Items[0])
+	}
+
+	// deleted comments aren't found
+	serve(t, app.apiDeleteCommentHandler, newTestRequest("DELETE", "/", "", owner.ID, id(other.ID)), 200, nil)
+	comments = &commentPage{}
+	serve(t, app.searchHandler, newTestRequest("GET", "/?type=comment&q=socks", "", 0, nil), 200, comments)
+	if got := commentTexts(comments.Items); fmt.Sprint(got) != "[lovely socks]" {
+		t.Errorf("got comments %v after deleting one, want [lovely socks]", got)
+	}
+
+	serve(t, app.searchHandler, newTestRequest("GET", "/?type=playlist", "", 0, nil), 400, nil)
+	serve(t, app.searchHandler, newTestRequest("GET", "/?type=user&sort=views", "", 0, nil), 400, nil)
+}
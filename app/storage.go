@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/storage"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// newStorage opens the configured storage backend
+func newStorage(cfg *StorageConfig, uploadPath string) (storage.Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		if cfg.Path == "" {
+			return storage.NewLocal(uploadPath)
+		}
+		return storage.NewLocal(cfg.Path)
+	case "s3":
+		return storage.NewS3(storage.S3Options{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			PathStyle: cfg.S3.PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Backend)
+	}
+}
+
+// migrateStorageKeys turns file paths below the upload path, which were
+// stored before media moved to a storage backend, into storage keys
+func (app *App) migrateStorageKeys() error {
+	prefix := filepath.ToSlash(filepath.Clean(app.Config.Server.UploadPath)) + "/"
+	updates := []struct {
+		model  interface{}
+		column string
+		where  string
+	}{
+		// library videos are served from the library path
+		{&models.Video{}, "url", "source_path = ''"},
+		{&models.Video{}, "thumbnail_url", ""},
+		{&models.Video{}, "hls_path", ""},
+		{&models.Rendition{}, "url", ""},
+	}
+	for _, u := range updates {
+		query := app.DataBase.Model(u.model).Where(u.column+" LIKE ?", prefix+"%")
+		if u.where != "" {
+			query = query.Where(u.where)
+		}
+		res := query.UpdateColumn(u.column, gorm.Expr(fmt.Sprintf("SUBSTR(%s, %d)", u.column, len(prefix)+1)))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			log.
+				WithField("column", u.column).
+				WithField("rows", res.RowsAffected).
+				Info("converted upload paths to storage keys")
+		}
+	}
+	return nil
+}
+
+// keeps the sizes of the videos processed before sizes were kept, until
+// ctx is cancelled
+func (app *App) backfillVideoSizes(ctx context.Context) {
+	videos := []*models.Video{}
+	res := app.DataBase.
+		Select("id", "url").
+		Where("status = ? AND size = 0 AND source_path = ''", models.VideoReady).
+		Find(&videos)
+	if res.Error != nil {
+		log.WithError(res.Error).Error("error loading videos without size")
+		return
+	}
+	for _, video := range videos {
+		if ctx.Err() != nil {
+			return
+		}
+		info, err := app.Storage.Stat(ctx, video.URL)
+		if err != nil {
+			log.WithError(err).WithField("video", video.ID).Warn("error reading video size")
+			continue
+		}
+		if res := app.DataBase.Model(video).UpdateColumn("size", info.Size); res.Error != nil {
+			log.WithError(res.Error).WithField("video", video.ID).Error("error keeping video size")
+		}
+	}
+}
+
+// stores a local file as key, removing the file
+func (app *App) storeFile(key, filename string) error {
+	if err := storage.PutFile(context.Background(), app.Storage, key, filename); err != nil {
+		return fmt.Errorf("error storing %s: %w", key, err)
+	}
+	return nil
+}
+
+// serves a stored object, supporting range requests. Clients are
+// redirected to the storage if it is set up to serve objects itself.
+func (app *App) serveObject(w http.ResponseWriter, r *http.Request, key string) {
+	if app.Config.Storage.Backend == "s3" && app.Config.Storage.S3.Redirect {
+		expiry := time.Duration(app.Config.Storage.S3.URLExpiry) * time.Second
+		url, err := app.Storage.SignedURL(key, expiry)
+		if err == nil {
+			http.Redirect(w, r, url, http.StatusFound)
+			return
+		}
+		if !errors.Is(err, storage.ErrNotSupported) {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Error(err)
+			return
+		}
+	}
+
+	info, err := app.Storage.Stat(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	reader := storage.NewReader(r.Context(), app.Storage, key, info.Size)
+	defer reader.Close()
+	http.ServeContent(w, r, path.Base(key), info.ModTime, reader)
+}
+
+// servedUpload reports whether key is served under /uploads/: videos and
+// their renditions and thumbnails stored before they had several sizes are
+// stored at the top level, thumbnails below models.ThumbnailsPrefix.
+// Everything else the upload path holds, like HLS segments (served by video)
+// and the temporary files of uploads and processing, isn't.
+func servedUpload(key string) bool {
+	base := path.Base(key)
+	if strings.HasPrefix(base, "tube-") || strings.HasPrefix(base, ".") {
+		return false
+	}
+	if strings.HasPrefix(key, models.ThumbnailsPrefix) {
+		return true
+	}
+	if strings.Contains(key, "/") {
+		return false
+	}
+	switch path.Ext(key) {
+	case ".mp4", ".jpg":
+		return true
+	}
+	return false
+}
+
+// HTTP handler for /uploads/key
+func (app *App) getUploadHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(path.Clean("/"+mux.Vars(r)["key"]), "/")
+	if !servedUpload(key) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	app.serveObject(w, r, key)
+}
+
+// deletes the stored files of a video. The file of a library video is
+// left alone, only its thumbnail is deleted.
+func (app *App) removeVideoFiles(video *models.Video) error {
+	ctx := context.Background()
+	if video.URL != "" && video.SourcePath == "" {
+		if err := app.Storage.Delete(ctx, video.URL); err != nil {
+			return err
+		}
+	}
+	if err := app.removeThumbnails(video); err != nil {
+		return err
+	}
+	app.removeRenditions(video)
+	if video.HLSPath != "" {
+		if err := app.Storage.DeletePrefix(ctx, video.HLSPath+"/"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
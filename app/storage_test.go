@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/storage"
+)
+
+func TestGetUploadHandler(t *testing.T) {
+	app := newTestApp(t)
+	store, err := storage.NewLocal(app.Config.Server.UploadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Storage = store
+
+	keys := []string{
+		"abc.mp4",
+		"abc#720p.mp4",
+		"abc.jpg",
+		"thumbnails/1/xyz/medium.webp",
+		"thumbnails/1/candidate-0.jpg",
+		"hls/abc/index.m3u8",
+		"tube-tus-abc.part",
+		"tube-upload-123.mp4",
+		"thumbnails/1/.tube-put-123",
+		"bitcask/000000000.data",
+	}
+	for _, key := range keys {
+		if err := store.Put(context.Background(), key, strings.NewReader(key), int64(len(key)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		key  string
+		code int
+	}{
+		{"abc.mp4", 200},
+		{"abc#720p.mp4", 200},
+		{"abc.jpg", 200},
+		{"thumbnails/1/xyz/medium.webp", 200},
+		{"thumbnails/1/candidate-0.jpg", 200},
+		{"hls/abc/index.m3u8", 404},
+		{"tube-tus-abc.part", 404},
+		{"tube-upload-123.mp4", 404},
+		{"thumbnails/1/.tube-put-123", 404},
+		{"bitcask/000000000.data", 404},
+		{"../thumbnails/1/candidate-0.jpg", 200},
+		{"thumbnails/../hls/abc/index.m3u8", 404},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r = mux.SetURLVars(r, map[string]string{"key": test.key})
+		w := httptest.NewRecorder()
+		app.getUploadHandler(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: got status %d, want %d", test.key, w.Code, test.code)
+		}
+	}
+}
+
+func TestBackfillVideoSizes(t *testing.T) {
+	app := newTestApp(t)
+	store, err := storage.NewLocal(app.Config.Server.UploadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Storage = store
+	user := newTestUser(t, app, "owner")
+	video := newTestVideo(t, app, user.ID)
+	if err := store.Put(context.Background(), video.URL, strings.NewReader("video"), 5, ""); err != nil {
+		t.Fatal(err)
+	}
+	missing := newTestVideo(t, app, user.ID)
+	app.DataBase.Model(missing).Update("url", "videos/missing.mp4")
+
+	app.backfillVideoSizes(context.Background())
+	for _, want := range []struct {
+		id   uint
+		size int64
+	}{{video.ID, 5}, {missing.ID, 0}} {
+		got := &models.Video{}
+		app.DataBase.Find(got, want.id)
+		if got.Size != want.size {
+			t.Errorf("got size %d of video %d, want %d", got.Size, want.id, want.size)
+		}
+	}
+}
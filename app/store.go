@@ -1,11 +1,45 @@
 package app
 
-// Store ...
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// View stores
+const (
+	StoreBitcask = "bitcask"
+	StoreSQL     = "sql"
+)
+
+// Store records video views until they are flushed to the videos. A viewer
+// is counted at most once per video within the store's window.
 type Store interface {
+	// RecordView counts a view of a video by viewer unless viewer was
+	// counted within the window, and reports whether it was counted
+	RecordView(videoID uint, viewer string) (bool, error)
+	// GetViews returns the views of a video not flushed yet
+	GetViews(videoID uint) (int64, error)
+	// IncViews adds n views of a video, e.g. ones that failed to flush
+	IncViews(videoID uint, n int64) error
+	// TakeViews returns the views not flushed yet by video and resets them.
+	// Views returned along with an error were taken all the same.
+	TakeViews() (map[uint]int64, error)
+	// Expire forgets viewers counted before the window
+	Expire() error
 	Close() error
-	Migrate(collection, id string) error
-	GetViews_(collection, id string) (int64, error)
-	IncView_(collection, id string) error
-	GetViews(id string) (int64, error)
-	IncViews(id string) error
+}
+
+// NewStore opens the view store named backend; a bitcask store is kept in
+// path, a SQL store in db
+func NewStore(backend, path string, db *gorm.DB, window time.Duration) (Store, error) {
+	switch backend {
+	case StoreBitcask:
+		return NewBitcaskStore(path, window)
+	case StoreSQL:
+		return NewSQLStore(db, window), nil
+	default:
+		return nil, fmt.Errorf("unknown view store: %s", backend)
+	}
 }
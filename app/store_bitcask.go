@@ -0,0 +1,172 @@
+package app
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prologic/bitcask"
+)
+
+// keys of the bitcask store: pending views as /views/<video id> and the
+// time viewers were counted (in nanoseconds) as /seen/<viewer>/<video id>,
+// values being big endian int64s
+const (
+	bitcaskViewsPrefix = "/views/"
+	bitcaskSeenPrefix  = "/seen/"
+)
+
+// BitcaskStore is a Store kept in a bitcask database on disk. It can only
+// be used by a single process.
+type BitcaskStore struct {
+	// serializes read-modify-write cycles
+	mu     sync.Mutex
+	db     *bitcask.Bitcask
+	window time.Duration
+}
+
+// NewBitcaskStore opens the bitcask database in path, creating it if needed
+func NewBitcaskStore(path string, window time.Duration) (*BitcaskStore, error) {
+	db, err := bitcask.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening view store %s: %w", path, err)
+	}
+	return &BitcaskStore{db: db, window: window}, nil
+}
+
+func (s *BitcaskStore) getInt(key string) (int64, error) {
+	value, err := s.db.Get([]byte(key))
+	if err == bitcask.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(value) != 8 {
+		return 0, fmt.Errorf("invalid value of %s", key)
+	}
+	return int64(binary.BigEndian.Uint64(value)), nil
+}
+
+func (s *BitcaskStore) putInt(key string, n int64) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(n))
+	return s.db.Put([]byte(key), value)
+}
+
+func viewsKey(videoID uint) string {
+	return fmt.Sprintf("%s%d", bitcaskViewsPrefix, videoID)
+}
+
+func (s *BitcaskStore) RecordView(videoID uint, viewer string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	seenKey := fmt.Sprintf("%s%s/%d", bitcaskSeenPrefix, viewer, videoID)
+	seen, err := s.getInt(seenKey)
+	if err != nil {
+		return false, err
+	}
+	if seen > 0 && now.Sub(time.Unix(0, seen)) < s.window {
+		return false, nil
+	}
+	if err := s.putInt(seenKey, now.UnixNano()); err != nil {
+		return false, err
+	}
+	return true, s.incViews(videoID, 1)
+}
+
+func (s *BitcaskStore) GetViews(videoID uint) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getInt(viewsKey(videoID))
+}
+
+func (s *BitcaskStore) IncViews(videoID uint, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.incViews(videoID, n)
+}
+
+func (s *BitcaskStore) incViews(videoID uint, n int64) error {
+	views, err := s.getInt(viewsKey(videoID))
+	if err != nil {
+		return err
+	}
+	return s.putInt(viewsKey(videoID), views+n)
+}
+
+func (s *BitcaskStore) TakeViews() (map[uint]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	err := s.db.Scan([]byte(bitcaskViewsPrefix), func(key []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	views := map[uint]int64{}
+	for _, key := range keys {
+		id, err := strconv.ParseUint(strings.TrimPrefix(key, bitcaskViewsPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		n, err := s.getInt(key)
+		if err != nil {
+			return views, err
+		}
+		if err := s.db.Delete([]byte(key)); err != nil {
+			return views, err
+		}
+		if n > 0 {
+			views[uint(id)] = n
+		}
+	}
+	return views, nil
+}
+
+func (s *BitcaskStore) Expire() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	err := s.db.Scan([]byte(bitcaskSeenPrefix), func(key []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	before := time.Now().Add(-s.window).UnixNano()
+	for _, key := range keys {
+		seen, err := s.getInt(key)
+		if err != nil {
+			return err
+		}
+		if seen >= before {
+			continue
+		}
+		if err := s.db.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BitcaskStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.db.Sync(); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBitcaskStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tube-views-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "views")
+
+	store, err := NewBitcaskStore(path, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	var seen int
+	err = store.db.Scan([]byte(bitcaskSeenPrefix), func(key []byte) error {
+		seen++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != 0 {
+		t.Errorf("%d viewers left after expiring, want 0", seen)
+	}
+
+	// views not flushed yet are kept across restarts
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err = NewBitcaskStore(path, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if views, _ := store.GetViews(2); views != 5 {
+		t.Errorf("got %d views of video 2 after reopening, want 5", views)
+	}
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"time"
+
+	"github.com/prologic/tube/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SQLStore is a Store kept in the view_counts and view_records tables of
+// the database, so it can be shared by several instances
+type SQLStore struct {
+	db     *gorm.DB
+	window time.Duration
+}
+
+// NewSQLStore returns a SQLStore in db
+func NewSQLStore(db *gorm.DB, window time.Duration) *SQLStore {
+	return &SQLStore{db: db, window: window}
+}
+
+func (s *SQLStore) RecordView(videoID uint, viewer string) (bool, error) {
+	now := time.Now()
+	counted := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// a viewer last counted before the window is counted again
+		res := tx.Model(&models.ViewRecord{}).
+			Where("viewer = ? AND video_id = ? AND viewed_at < ?", viewer, videoID, now.Add(-s.window)).
+			UpdateColumn("viewed_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			var seen int64
+			res := tx.Model(&models.ViewRecord{}).
+				Where("viewer = ? AND video_id = ?", viewer, videoID).
+				Count(&seen)
+			if res.Error != nil || seen > 0 {
+				return res.Error
+			}
+			record := &models.ViewRecord{Viewer: viewer, VideoID: videoID, ViewedAt: now}
+			if res := tx.Create(record); res.Error != nil {
+				return res.Error
+			}
+		}
+		counted = true
+		return s.incViews(tx, videoID, 1)
+	})
+	return counted && err == nil, err
+}
+
+func (s *SQLStore) GetViews(videoID uint) (int64, error) {
+	count := &models.ViewCount{}
+	res := s.db.Where("video_id = ?", videoID).Limit(1).Find(count)
+	return count.Views, res.Error
+}
+
+func (s *SQLStore) IncViews(videoID uint, n int64) error {
+	return s.incViews(s.db, videoID, n)
+}
+
+func (s *SQLStore) incViews(tx *gorm.DB, videoID uint, n int64) error {
+	// a single upsert, so that first views of a video recorded at once
+	// don't both try to create its count
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "video_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"views": gorm.Expr("views + ?", n)}),
+	}).Create(&models.ViewCount{VideoID: videoID, Views: n}).Error
+}
+
+func (s *SQLStore) TakeViews() (map[uint]int64, error) {
+	views := map[uint]int64{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		counts := []*models.ViewCount{}
+		if res := tx.Where("views > 0").Find(&counts); res.Error != nil {
+			return res.Error
+		}
+		// views recorded meanwhile are subtracted from, not lost
+		for _, count := range counts {
+			res := tx.Model(&models.ViewCount{}).
+				Where("video_id = ?", count.VideoID).
+				UpdateColumn("views", gorm.Expr("views - ?", count.Views))
+			if res.Error != nil {
+				return res.Error
+			}
+			views[count.VideoID] = count.Views
+		}
+		return tx.Where("views = 0").Delete(&models.ViewCount{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return views, nil
+}
+
+func (s *SQLStore) Expire() error {
+	res := s.db.Where("viewed_at < ?", time.Now().Add(-s.window)).Delete(&models.ViewRecord{})
+	return res.Error
+}
+
+// Close does nothing, the database is the app's
+func (s *SQLStore) Close() error {
+	return nil
+}
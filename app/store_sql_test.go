@@ -0,0 +1,40 @@
+package app
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSQLStore(t *testing.T) {
+	app := newTestApp(t)
+	store := NewSQLStore(app.DataBase, 50*time.Millisecond)
+	testStore(t, store)
+
+	var records int64
+	app.DataBase.Table("view_records").Count(&records)
+	if records != 0 {
+		t.Errorf("%d viewers left after expiring, want 0", records)
+	}
+}
+
+func TestSQLStoreFirstViews(t *testing.T) {
+	app := newTestApp(t)
+	store := NewSQLStore(app.DataBase, time.Minute)
+
+	// first views of a video at once all count
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.IncViews(1, 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if views, _ := store.GetViews(1); views != 10 {
+		t.Errorf("got %d views, want 10", views)
+	}
+}
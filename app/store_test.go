@@ -0,0 +1,57 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+// testStore records, takes and expires views in store, whose window must
+// be 50ms
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	record := func(videoID uint, viewer string, want bool) {
+		t.Helper()
+		counted, err := store.RecordView(videoID, viewer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counted != want {
+			t.Errorf("RecordView(%d, %s) = %v, want %v", videoID, viewer, counted, want)
+		}
+	}
+
+	record(1, "a", true)
+	record(1, "a", false)
+	record(1, "b", true)
+	record(2, "a", true)
+	if views, _ := store.GetViews(1); views != 2 {
+		t.Errorf("got %d views of video 1, want 2", views)
+	}
+
+	// counted again once the window has passed
+	time.Sleep(60 * time.Millisecond)
+	record(1, "a", true)
+
+	views, err := store.TakeViews()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views[1] != 3 || views[2] != 1 || len(views) != 2 {
+		t.Errorf("took %v, want 3 views of video 1 and 1 of video 2", views)
+	}
+	if views, _ := store.TakeViews(); len(views) != 0 {
+		t.Errorf("took %v again, want nothing", views)
+	}
+
+	if err := store.IncViews(2, 5); err != nil {
+		t.Fatal(err)
+	}
+	if views, _ := store.GetViews(2); views != 5 {
+		t.Errorf("got %d views of video 2, want 5", views)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := store.Expire(); err != nil {
+		t.Fatal(err)
+	}
+}
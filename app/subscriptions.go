@@ -0,0 +1,188 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// profileResponse is a user's profile along with their subscribers
+type profileResponse struct {
+	*models.User
+	Subscribers int64 `json:"subscribers"`
+	// whether the user making the request is subscribed, if authenticated
+	Subscribed bool `json:"subscribed"`
+}
+
+// subscriptionResponse is whether the user is subscribed to a channel along
+// with the channel's subscribers
+type subscriptionResponse struct {
+	Subscribed  bool  `json:"subscribed"`
+	Subscribers int64 `json:"subscribers"`
+}
+
+// returns the number of subscribers of a channel
+func (app *App) countSubscribers(channelID uint) (int64, error) {
+	var n int64
+	res := app.DataBase.
+		Model(&models.Subscription{}).
+		Where("channel_id = ?", channelID).
+		Count(&n)
+	return n, res.Error
+}
+
+// reports whether user uid is subscribed to a channel
+func (app *App) isSubscribed(uid, channelID uint) (bool, error) {
+	var n int64
+	res := app.DataBase.
+		Model(&models.Subscription{}).
+		Where("user_id = ? AND channel_id = ?", uid, channelID).
+		Count(&n)
+	return n > 0, res.Error
+}
+
+func (app *App) writeSubscriptionResponse(w http.ResponseWriter, uid, channelID uint) {
+	subscribed, err := app.isSubscribed(uid, channelID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	subscribers, err := app.countSubscribers(channelID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&subscriptionResponse{
+		Subscribed:  subscribed,
+		Subscribers: subscribers,
+	})
+}
+
+// HTTP handler for [PUT] /api/user/id/subscribe
+func (app *App) apiSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+
+	channel := &models.User{}
+	app.DataBase.Find(channel, mux.Vars(r)["id"])
+	if channel.ID <= 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if channel.ID == uid {
+		http.Error(w, "You can't subscribe to yourself", http.StatusBadRequest)
+		return
+	}
+
+	// the unique (user_id, channel_id) index makes subscribing twice a no-op
+	res := app.DataBase.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.Subscription{UserID: uid, ChannelID: channel.ID})
+	if res.Error != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(res.Error)
+		return
+	}
+
+	app.writeSubscriptionResponse(w, uid, channel.ID)
+}
+
+// HTTP handler for [DELETE] /api/user/id/subscribe
+func (app *App) apiUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+
+	channel := &models.User{}
+	app.DataBase.Find(channel, mux.Vars(r)["id"])
+	if channel.ID <= 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	res := app.DataBase.
+		Where("user_id = ? AND channel_id = ?", uid, channel.ID).
+		Delete(&models.Subscription{})
+	if res.Error != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(res.Error)
+		return
+	}
+
+	app.writeSubscriptionResponse(w, uid, channel.ID)
+}
+
+// HTTP handler for [GET] /api/user/id/subscriptions
+// Subscriptions are private: only the user and user managers can list them.
+// Query parameters: sort (newest, oldest), limit, cursor
+func (app *App) apiGetSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+
+	p, err := parsePage(r.URL.Query(), subscriptionSorts, "newest")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user := &models.User{}
+	app.DataBase.Find(user, mux.Vars(r)["id"])
+	if user.ID <= 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.ID != uid && !can(r, PermManageUsers) {
+		http.Error(w, "You are not allowed to see these subscriptions", http.StatusForbidden)
+		return
+	}
+
+	subscriptions := []models.Subscription{}
+	resp, err := p.find(func() *gorm.DB {
+		return app.DataBase.Model(&models.Subscription{}).
+			Where("subscriptions.user_id = ?", user.ID)
+	}, "subscriptions", &subscriptions, "Channel")
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	for i := range subscriptions {
+		subscriptions[i].Channel.Password = ""
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// HTTP handler for [GET] /api/feed/subscriptions: the videos of the
+// channels the user is subscribed to, newest first
+// Query parameters: limit, cursor
+func (app *App) apiSubscriptionFeedHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("userID").(uint)
+
+	p, err := parsePage(r.URL.Query(), feedSorts, "newest")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	videos := []models.Video{}
+	resp, err := p.find(func() *gorm.DB {
+		return app.DataBase.Model(&models.Video{}).
+			Where("videos.status = ?", models.VideoReady).
+			Where("videos.user_id IN (SELECT channel_id FROM subscriptions WHERE user_id = ?)", uid)
+	}, "videos", &videos, "Categories", "Categories.Category", "User")
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	for i := range videos {
+		videos[i].User.Password = ""
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prologic/tube/models"
+)
+
+func TestSubscriptions(t *testing.T) {
+	app := newTestApp(t)
+	alice := newTestUser(t, app, "alice")
+	bob := newTestUser(t, app, "bob")
+	carol := newTestUser(t, app, "carol")
+
+	resp := &subscriptionResponse{}
+	for i := 0; i < 2; i++ {
+		serve(t, app.apiSubscribeHandler, newTestRequest("PUT", "/", "", alice.ID, id(bob.ID)), 200, resp)
+	}
+	if !resp.Subscribed || resp.Subscribers != 1 {
+		t.Errorf("got %+v subscribing twice, want subscribed with 1 subscriber", resp)
+	}
+	serve(t, app.apiSubscribeHandler, newTestRequest("PUT", "/", "", alice.ID, id(alice.ID)), 400, nil)
+	serve(t, app.apiSubscribeHandler, newTestRequest("PUT", "/", "", alice.ID, id(carol.ID)), 200, resp)
+	serve(t, app.apiUnsubscribeHandler, newTestRequest("DELETE", "/", "", alice.ID, id(carol.ID)), 200, resp)
+	if resp.Subscribed || resp.Subscribers != 0 {
+		t.Errorf("got %+v unsubscribing, want unsubscribed with no subscribers", resp)
+	}
+
+	profile := &profileResponse{}
+	serve(t, app.getProfileHandler, newTestRequest("GET", "/", "", 0, id(bob.ID)), 200, profile)
+	if profile.Subscribers != 1 || profile.Subscribed || profile.Password != "" {
+		t.Errorf("got profile %+v, want 1 subscriber, not subscribed, no password", profile)
+	}
+
+	subscriptions := &struct {
+		Items []models.Subscription `json:"items"`
+		Total int64                 `json:"total"`
+	}{}
+	r := newTestRequest("GET", "/", "", alice.ID, id(alice.ID))
+	serve(t, app.apiGetSubscriptionsHandler, r, 200, subscriptions)
+	if subscriptions.Total != 1 || subscriptions.Items[0].Channel.Name != "bob" {
+		t.Errorf("got subscriptions %+v, want bob", subscriptions.Items)
+	}
+	serve(t, app.apiGetSubscriptionsHandler, newTestRequest("GET", "/", "", bob.ID, id(alice.ID)), 403, nil)
+}
+
+func TestSubscriptionFeed(t *testing.T) {
+	app := newTestApp(t)
+	alice := newTestUser(t, app, "alice")
+	bob := newTestUser(t, app, "bob")
+	carol := newTestUser(t, app, "carol")
+	serve(t, app.apiSubscribeHandler, newTestRequest("PUT", "/", "", alice.ID, id(bob.ID)), 200, nil)
+
+	start := time.Now()
+	for i, video := range []*models.Video{
+		{UserID: bob.ID, Title: "old", Status: models.VideoReady},
+		{UserID: carol.ID, Title: "not subscribed", Status: models.VideoReady},
+		{UserID: bob.ID, Title: "transcoding", Status: models.VideoTranscoding},
+		{UserID: bob.ID, Title: "new", Status: models.VideoReady},
+	} {
+		video.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		if err := app.DataBase.Create(video).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	feed := &struct {
+		Items []models.Video `json:"items"`
+	}{}
+	serve(t, app.apiSubscriptionFeedHandler, newTestRequest("GET", "/", "", alice.ID, nil), 200, feed)
+	titles := []string{}
+	for _, video := range feed.Items {
+		titles = append(titles, video.Title)
+	}
+	if fmt.Sprint(titles) != "[new old]" {
+		t.Errorf("got feed %v, want [new old]", titles)
+	}
+}
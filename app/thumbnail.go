@@ -0,0 +1,361 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	// formats of custom thumbnails
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/media"
+	"github.com/prologic/tube/models"
+	"github.com/prologic/tube/storage"
+	"github.com/prologic/tube/utils"
+	"github.com/renstrom/shortuuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// widths of the thumbnail sizes; smaller pictures aren't scaled up
+var thumbnailWidths = map[string]int{
+	"small":  320,
+	"medium": 640,
+	"large":  1280,
+}
+
+// largest custom thumbnail in pixels. A small file can hold a picture that
+// takes far more memory to decode, which is refused up front.
+const maxThumbnailPixels = 8192 * 8192
+
+// returns the ffmpeg filter scaling a picture down to width
+func thumbnailScale(width int) string {
+	return fmt.Sprintf("scale='min(%d,iw)':-2", width)
+}
+
+// returns the storage key prefix of all thumbnails of video
+func thumbnailPrefix(video *models.Video) string {
+	return fmt.Sprintf("%s%d/", models.ThumbnailsPrefix, video.ID)
+}
+
+// returns the storage key of thumbnail candidate i of video
+func thumbnailCandidateKey(video *models.Video, i int) string {
+	return fmt.Sprintf("%scandidate-%d.jpg", thumbnailPrefix(video), i)
+}
+
+// generateThumbnails takes thumbnail candidates from frames of the video
+// in filename and stores them for the owner to choose from. The best of
+// them becomes the video's thumbnail unless keep is set.
+func (app *App) generateThumbnails(ctx context.Context, video *models.Video, filename string, keep bool) error {
+	dir, err := ioutil.TempDir(
+		app.Config.Server.UploadPath,
+		fmt.Sprintf("tube-thumbnails-%d-*", video.ID),
+	)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var candidates []string
+	best, bestScore := "", -1.0
+	times := media.ThumbnailTimes(float64(video.Duration), app.Config.Thumbnailer.Candidates)
+	for _, t := range times {
+		candidate := filepath.Join(dir, fmt.Sprintf("candidate-%d.jpg", len(candidates)))
+		if err := utils.RunCmdContext(
+			ctx, app.Config.Thumbnailer.Timeout,
+			"ffmpeg", "-y", "-ss", fmt.Sprintf("%.3f", t), "-i", filename,
+			"-frames:v", "1", "-vf", thumbnailScale(thumbnailWidths["large"]),
+			"-q:v", "2", "-loglevel", "quiet",
+			candidate,
+		); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.WithError(err).WithField("video", video.ID).Warn("error taking thumbnail candidate")
+			continue
+		}
+		// there's no frame past the end of a video with a wrong duration
+		if !utils.FileExists(candidate) {
+			continue
+		}
+
+		score, err := scoreThumbnail(candidate)
+		if err != nil {
+			log.WithError(err).WithField("video", video.ID).Warn("error scoring thumbnail candidate")
+			continue
+		}
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+		candidates = append(candidates, candidate)
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no thumbnail candidate could be taken")
+	}
+
+	if !keep {
+		if err := app.setThumbnail(video, best); err != nil {
+			return err
+		}
+	}
+	for i, candidate := range candidates {
+		if err := app.storeFile(thumbnailCandidateKey(video, i), candidate); err != nil {
+			return err
+		}
+	}
+	video.ThumbnailCandidates = len(candidates)
+	res := app.DataBase.Model(video).UpdateColumn("thumbnail_candidates", len(candidates))
+	return res.Error
+}
+
+// scores the picture in filename as a thumbnail
+func scoreThumbnail(filename string) (float64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return media.ScoreThumbnail(f)
+}
+
+// setThumbnail makes the picture in filename the thumbnail of video,
+// storing it in every size as JPEG and WebP and removing the previous one
+func (app *App) setThumbnail(video *models.Video, filename string) error {
+	dir, err := ioutil.TempDir(
+		app.Config.Server.UploadPath,
+		fmt.Sprintf("tube-thumbnail-%d-*", video.ID),
+	)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// a new key each time, so cached thumbnails never go stale
+	keyDir := thumbnailPrefix(video) + shortuuid.New()
+	keys := map[string]string{}
+	for _, size := range models.ThumbnailSizes {
+		for _, ext := range []string{"jpg", "webp"} {
+			out := filepath.Join(dir, size+"."+ext)
+			args := []string{
+				"-y", "-i", filename,
+				"-frames:v", "1", "-vf", thumbnailScale(thumbnailWidths[size]),
+			}
+			if ext == "webp" {
+				args = append(args, "-c:v", "libwebp", "-quality", "80")
+			} else {
+				args = append(args, "-q:v", "3")
+			}
+			args = append(args, "-loglevel", "quiet", out)
+			if err := utils.RunCmd(app.Config.Thumbnailer.Timeout, "ffmpeg", args...); err != nil {
+				return fmt.Errorf("error generating %s thumbnail: %w", size, err)
+			}
+			keys[models.ThumbnailKey(keyDir, size, ext)] = out
+		}
+	}
+	for key, out := range keys {
+		if err := app.storeFile(key, out); err != nil {
+			return err
+		}
+	}
+
+	old := video.ThumbnailURL
+	video.ThumbnailURL = models.ThumbnailKey(keyDir, "medium", "jpg")
+	res := app.DataBase.Model(video).Update("thumbnail_url", video.ThumbnailURL)
+	if res.Error != nil {
+		return res.Error
+	}
+	if old != "" {
+		if err := app.removeThumbnail(old); err != nil {
+			log.WithError(err).WithField("video", video.ID).Warn("error removing previous thumbnail")
+		}
+	}
+	return nil
+}
+
+// deletes the stored thumbnail with key, in all its sizes
+func (app *App) removeThumbnail(key string) error {
+	if strings.HasPrefix(key, models.ThumbnailsPrefix) {
+		return app.Storage.DeletePrefix(context.Background(), path.Dir(key)+"/")
+	}
+	return app.Storage.Delete(context.Background(), key)
+}
+
+// deletes the thumbnail of video and its candidates
+func (app *App) removeThumbnails(video *models.Video) error {
+	if video.ThumbnailURL != "" {
+		if err := app.removeThumbnail(video.ThumbnailURL); err != nil {
+			return err
+		}
+	}
+	return app.Storage.DeletePrefix(context.Background(), thumbnailPrefix(video))
+}
+
+// thumbnailResponse is the thumbnail of a video along with the candidates
+// its owner can choose from
+type thumbnailResponse struct {
+	Thumbnail  string             `json:"thumbnail"`
+	Thumbnails *models.Thumbnails `json:"thumbnails,omitempty"`
+	Candidates []string           `json:"candidates"`
+}
+
+func (app *App) writeThumbnailResponse(w http.ResponseWriter, video *models.Video) {
+	resp := &thumbnailResponse{
+		Thumbnail:  video.Thumbnail,
+		Thumbnails: video.Thumbnails,
+		Candidates: make([]string, video.ThumbnailCandidates),
+	}
+	for i := range resp.Candidates {
+		resp.Candidates[i] = models.UploadsPath + thumbnailCandidateKey(video, i)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// finds the video of a thumbnail request, which only the video's owner may
+// make. Writes the error response if the video can't be used.
+func (app *App) findThumbnailVideo(w http.ResponseWriter, r *http.Request, change bool) *models.Video {
+	uid := r.Context().Value("userID").(uint)
+
+	video := &models.Video{}
+	app.DataBase.Find(video, mux.Vars(r)["id"])
+	if video.ID <= 0 {
+		http.Error(w, "Video not found", http.StatusNotFound)
+		return nil
+	}
+	if video.UserID != uid {
+		http.Error(w, "You are not the owner of this video", http.StatusForbidden)
+		log.Error("Thumbnail change not permitted")
+		return nil
+	}
+	// processing sets the thumbnail itself
+	if change && video.Status != models.VideoReady {
+		http.Error(w, "Video is still processing", http.StatusConflict)
+		return nil
+	}
+	return video
+}
+
+// HTTP handler for [GET] /api/video/id/thumbnail
+func (app *App) apiGetThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	video := app.findThumbnailVideo(w, r, false)
+	if video == nil {
+		return
+	}
+	app.writeThumbnailResponse(w, video)
+}
+
+// HTTP handler for [PUT] /api/video/id/thumbnail: makes one of the
+// candidates the thumbnail
+func (app *App) apiSetThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	video := app.findThumbnailVideo(w, r, true)
+	if video == nil {
+		return
+	}
+
+	req := struct {
+		Candidate int `json:"candidate"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if req.Candidate < 0 || req.Candidate >= video.ThumbnailCandidates {
+		http.Error(w, "No such thumbnail candidate", http.StatusBadRequest)
+		return
+	}
+
+	// candidates are stored, setThumbnail needs a local file
+	reader, err := app.Storage.Get(r.Context(), thumbnailCandidateKey(video, req.Candidate), 0, -1)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "No such thumbnail candidate", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	defer reader.Close()
+
+	app.setThumbnailFrom(w, video, reader)
+}
+
+// HTTP handler for [POST] /api/video/id/thumbnail: uploads a custom
+// thumbnail as the form file "thumbnail"
+func (app *App) apiUploadThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	video := app.findThumbnailVideo(w, r, true)
+	if video == nil {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxThumbnailSize+1<<20)
+	if err := r.ParseMultipartForm(maxThumbnailSize); err != nil {
+		http.Error(w, "Thumbnail too large or invalid", http.StatusBadRequest)
+		return
+	}
+	file, _, err := r.FormFile("thumbnail")
+	if err != nil {
+		http.Error(w, "No thumbnail provided", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		http.Error(w, "Thumbnail must be a JPEG, PNG or GIF picture", http.StatusBadRequest)
+		return
+	}
+	if int64(config.Width)*int64(config.Height) > maxThumbnailPixels {
+		http.Error(w, "Thumbnail has too many pixels", http.StatusBadRequest)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	app.setThumbnailFrom(w, video, file)
+}
+
+// makes the picture read from r the thumbnail of video and writes the
+// response of a thumbnail change
+func (app *App) setThumbnailFrom(w http.ResponseWriter, video *models.Video, r io.Reader) {
+	tmp, err := ioutil.TempFile(
+		app.Config.Server.UploadPath,
+		fmt.Sprintf("tube-thumbnail-%d-*", video.ID),
+	)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = app.setThumbnail(video, tmp.Name())
+	}
+	if err != nil {
+		http.Error(w, "Error setting thumbnail", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	log.WithField("video", video.ID).Info("thumbnail changed")
+	app.writeThumbnailResponse(w, video)
+}
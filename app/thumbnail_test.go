@@ -0,0 +1,51 @@
+package app
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+// newThumbnailRequest uploads picture as the thumbnail of video videoID
+func newThumbnailRequest(t *testing.T, uid, videoID uint, picture []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("thumbnail", "thumbnail.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(picture)
+	form.Close()
+
+	r := newTestRequest("POST", "/", body.String(), uid, id(videoID))
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestUploadThumbnailLimits(t *testing.T) {
+	app := newTestApp(t)
+	owner := newTestUser(t, app, "owner")
+	video := newTestVideo(t, app, owner.ID)
+
+	tests := []struct {
+		name    string
+		picture []byte
+	}{
+		{"not a picture", []byte("not a picture")},
+		// a GIF header claiming 65535x65535 pixels, which would take 16GB
+		{"too many pixels", []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newThumbnailRequest(t, owner.ID, video.ID, test.picture)
+			serve(t, app.apiUploadThumbnailHandler, r, 400, nil)
+		})
+	}
+
+	app.DataBase.Find(video, video.ID)
+	if video.ThumbnailURL != "" {
+		t.Errorf("got thumbnail %q after refused uploads", video.ThumbnailURL)
+	}
+}
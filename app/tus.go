@@ -0,0 +1,407 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prologic/tube/models"
+	"github.com/renstrom/shortuuid"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// tus protocol version and extensions implemented by the upload endpoint
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,expiration,termination"
+)
+
+// interval at which expired uploads are deleted
+const tusExpireInterval = 15 * time.Minute
+
+// tusHeaders are the tus request and response headers, allowed and exposed
+// for CORS
+var tusHeaders = []string{
+	"Tus-Resumable",
+	"Tus-Version",
+	"Tus-Extension",
+	"Tus-Max-Size",
+	"Upload-Length",
+	"Upload-Offset",
+	"Upload-Metadata",
+	"Upload-Expires",
+	"Location",
+}
+
+// uploadLocks keeps a PATCH from running while another one appends to the
+// same upload
+type uploadLocks struct {
+	sync.Mutex
+	busy map[string]bool
+}
+
+// returns false if the upload is locked already
+func (l *uploadLocks) lock(id string) bool {
+	l.Lock()
+	defer l.Unlock()
+	if l.busy == nil {
+		l.busy = make(map[string]bool)
+	}
+	if l.busy[id] {
+		return false
+	}
+	l.busy[id] = true
+	return true
+}
+
+func (l *uploadLocks) unlock(id string) {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.busy, id)
+}
+
+// returns the file an upload's data is appended to
+func (app *App) uploadFile(upload *models.Upload) string {
+	return filepath.Join(app.Config.Server.UploadPath, fmt.Sprintf("tube-tus-%s.part", upload.ID))
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated
+// pairs of a key and its base64 encoded value
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, " ", 2)
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata value of %s", parts[0])
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
+
+// middleware checking the protocol version of tus requests and adding the
+// Tus-Resumable header to responses
+func tusResumable(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// loads the upload of the request if it belongs to the current user
+func (app *App) findUpload(w http.ResponseWriter, r *http.Request) *models.Upload {
+	upload := &models.Upload{}
+	app.DataBase.Where("id = ?", mux.Vars(r)["id"]).Find(upload)
+	if upload.ID == "" || upload.UserID != r.Context().Value("userID").(uint) ||
+		(upload.VideoID == 0 && upload.ExpiresAt.Before(time.Now())) {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil
+	}
+	return upload
+}
+
+// HTTP handler for [POST] /api/upload/
+// Creates an upload of Upload-Length bytes. Upload-Metadata may give the
+// filename, title, description and categoryIds (a JSON array) of the video.
+func (app *App) apiCreateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(app.Config.Tus.MaxSize, 10))
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if length > app.Config.Tus.MaxSize {
+		http.Error(w, "Upload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	metadata := r.Header.Get("Upload-Metadata")
+	if _, err := parseTusMetadata(metadata); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload := &models.Upload{
+		ID:        shortuuid.New(),
+		UserID:    r.Context().Value("userID").(uint),
+		Length:    length,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(time.Duration(app.Config.Tus.Expiry) * time.Second),
+	}
+	f, err := os.OpenFile(app.uploadFile(upload), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+	f.Close()
+	if res := app.DataBase.Create(upload); res.Error != nil {
+		os.Remove(app.uploadFile(upload))
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		log.Error(res.Error)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/upload/%s", upload.ID))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	log.Info(fmt.Sprintf("New resumable upload: Id=%s; Length: %d", upload.ID, upload.Length))
+
+	// creation-with-upload: the body holds the first chunk
+	if r.Header.Get("Content-Type") == "application/offset+octet-stream" {
+		app.lockAndAppend(w, r, upload, http.StatusCreated)
+		return
+	}
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HTTP handler for [OPTIONS] /api/upload/ and /api/upload/id
+// tus discovery of the supported version, extensions and maximum size.
+// Clients ask before uploading, without credentials or Tus-Resumable.
+func (app *App) apiUploadOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(app.Config.Tus.MaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HTTP handler for [HEAD] /api/upload/id
+func (app *App) apiGetUploadOffsetHandler(w http.ResponseWriter, r *http.Request) {
+	upload := app.findUpload(w, r)
+	if upload == nil {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.Metadata)
+	}
+	if upload.VideoID == 0 {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HTTP handler for [PATCH] /api/upload/id
+// Appends the body to the upload at Upload-Offset. The video is created
+// once all data has arrived.
+func (app *App) apiPatchUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Invalid Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	upload := app.findUpload(w, r)
+	if upload == nil {
+		return
+	}
+	if offset != upload.Offset {
+		http.Error(w, "Upload-Offset doesn't match", http.StatusConflict)
+		return
+	}
+	app.lockAndAppend(w, r, upload, http.StatusNoContent)
+}
+
+// appends the request body to an upload and answers with status, unless
+// another request is appending to it already
+func (app *App) lockAndAppend(w http.ResponseWriter, r *http.Request, upload *models.Upload, status int) {
+	if !app.uploadLocks.lock(upload.ID) {
+		http.Error(w, "Upload is locked by another request", http.StatusLocked)
+		return
+	}
+	defer app.uploadLocks.unlock(upload.ID)
+
+	// reload, a request that held the lock may have moved the offset
+	offset := upload.Offset
+	app.DataBase.Where("id = ?", upload.ID).Find(upload)
+	if upload.Offset != offset {
+		http.Error(w, "Upload-Offset doesn't match", http.StatusConflict)
+		return
+	}
+
+	if err := app.appendUpload(r, upload); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error(err)
+		return
+	}
+
+	if upload.Offset == upload.Length && upload.VideoID == 0 {
+		if err := app.completeUpload(upload); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Error(err)
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if upload.VideoID == 0 {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(status)
+}
+
+// writes the request body at the upload's offset. Whatever arrived before
+// the connection dropped is kept, so the client can resume from there.
+func (app *App) appendUpload(r *http.Request, upload *models.Upload) error {
+	f, err := os.OpenFile(app.uploadFile(upload), os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// drop anything written past the recorded offset by a crashed request
+	if err := f.Truncate(upload.Offset); err != nil {
+		return err
+	}
+	if _, err := f.Seek(upload.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	n, copyErr := io.Copy(f, io.LimitReader(r.Body, upload.Length-upload.Offset))
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	upload.Offset += n
+	upload.ExpiresAt = time.Now().Add(time.Duration(app.Config.Tus.Expiry) * time.Second)
+	res := app.DataBase.Model(upload).Updates(map[string]interface{}{
+		"offset":     upload.Offset,
+		"expires_at": upload.ExpiresAt,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if copyErr != nil {
+		log.WithError(copyErr).WithField("upload", upload.ID).Warn("upload interrupted")
+	}
+	return nil
+}
+
+// creates the video of a complete upload and hands the file over to
+// jobProcessVideo
+func (app *App) completeUpload(upload *models.Upload) error {
+	metadata, _ := parseTusMetadata(upload.Metadata)
+
+	source := filepath.Join(
+		app.Config.Server.UploadPath,
+		fmt.Sprintf("tube-upload-%s%s", upload.ID, filepath.Ext(filepath.Base(metadata["filename"]))),
+	)
+	if err := os.Rename(app.uploadFile(upload), source); err != nil {
+		return err
+	}
+
+	vid := &models.Video{
+		UserID:      upload.UserID,
+		Title:       metadata["title"],
+		Description: metadata["description"],
+	}
+	if vid.Title == "" {
+		name := filepath.Base(metadata["filename"])
+		vid.Title = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	catIds := make([]uint, 0)
+	json.Unmarshal([]byte(metadata["categoryIds"]), &catIds)
+
+	// the upload only points at its video once the video exists
+	err := app.createVideo(vid, catIds, source, func(tx *gorm.DB) error {
+		return tx.Model(upload).Update("video_id", vid.ID).Error
+	})
+	if err != nil {
+		os.Rename(source, app.uploadFile(upload))
+		return err
+	}
+
+	upload.VideoID = vid.ID
+	log.Info(fmt.Sprintf("New upload: Id=%d; Title: \"%s\"", vid.ID, vid.Title))
+	return nil
+}
+
+// HTTP handler for [DELETE] /api/upload/id
+func (app *App) apiDeleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	upload := app.findUpload(w, r)
+	if upload == nil {
+		return
+	}
+	if !app.uploadLocks.lock(upload.ID) {
+		http.Error(w, "Upload is locked by another request", http.StatusLocked)
+		return
+	}
+	defer app.uploadLocks.unlock(upload.ID)
+
+	app.removeUpload(upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletes an upload and its data, unless it became a video
+func (app *App) removeUpload(upload *models.Upload) {
+	if upload.VideoID == 0 {
+		if err := os.Remove(app.uploadFile(upload)); err != nil && !os.IsNotExist(err) {
+			log.Error(err)
+		}
+	}
+	if res := app.DataBase.Delete(upload); res.Error != nil {
+		log.Error(res.Error)
+	}
+}
+
+// deletes expired uploads until ctx is cancelled. Completed uploads are
+// kept as long so that clients can still query their offset.
+func (app *App) expireUploads(ctx context.Context) {
+	ticker := time.NewTicker(tusExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		uploads := []*models.Upload{}
+		res := app.DataBase.Where("expires_at < ?", time.Now()).Find(&uploads)
+		if res.Error != nil {
+			log.WithError(res.Error).Error("error loading expired uploads")
+		}
+		for _, upload := range uploads {
+			if !app.uploadLocks.lock(upload.ID) {
+				continue
+			}
+			app.removeUpload(upload)
+			app.uploadLocks.unlock(upload.ID)
+			log.WithField("upload", upload.ID).Info("upload expired")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
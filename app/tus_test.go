@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prologic/tube/models"
+	"gorm.io/gorm"
+)
+
+func newTusRequest(method, target, body string, uid uint, vars map[string]string) *http.Request {
+	r := newTestRequest(method, target, body, uid, vars)
+	r.Header.Set("Tus-Resumable", tusVersion)
+	if method == "PATCH" || body != "" {
+		r.Header.Set("Content-Type", "application/offset+octet-stream")
+	}
+	return r
+}
+
+func TestUploadOptions(t *testing.T) {
+	app := newTestApp(t)
+	if err := os.MkdirAll(app.Config.Server.UploadPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	router, err := NewApp(app.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// discovery needs neither credentials nor Tus-Resumable
+	for _, target := range []string{"/api/upload/", "/api/upload/abc"} {
+		w := httptest.NewRecorder()
+		router.Router.ServeHTTP(w, httptest.NewRequest("OPTIONS", target, nil))
+		if w.Code != http.StatusNoContent || w.Header().Get("Tus-Version") != tusVersion {
+			t.Errorf("OPTIONS %s: got status %d and Tus-Version %q, want 204 and %s",
+				target, w.Code, w.Header().Get("Tus-Version"), tusVersion)
+		}
+	}
+
+	// CORS preflights are answered as before
+	r := httptest.NewRequest("OPTIONS", "/api/upload/abc", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", "PATCH")
+	r.Header.Set("Access-Control-Request-Headers", "Upload-Offset")
+	w := httptest.NewRecorder()
+	router.Router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Headers") != "Upload-Offset" {
+		t.Errorf("got status %d and headers %v for a preflight, want 200 allowing Upload-Offset", w.Code, w.Header())
+	}
+}
+
+func TestUpload(t *testing.T) {
+	app := newTestApp(t)
+	if err := os.MkdirAll(app.Config.Server.UploadPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	user := newTestUser(t, app, "uploader")
+	category := &models.Category{Title: "Music"}
+	if err := app.DataBase.Create(category).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := fmt.Sprintf("filename %s,categoryIds %s",
+		base64.StdEncoding.EncodeToString([]byte("My Video.mp4")),
+		base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("[%d, 4242]", category.ID))),
+	)
+	r := newTusRequest("POST", "/", "0123", user.ID, nil)
+	r.Header.Set("Upload-Length", "10")
+	r.Header.Set("Upload-Metadata", metadata)
+	w := httptest.NewRecorder()
+	tusResumable(app.apiCreateUploadHandler)(w, r)
+	if w.Code != http.StatusCreated || w.Header().Get("Upload-Offset") != "4" {
+		t.Fatalf("got status %d and offset %q creating, want 201 and 4", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	id := strings.TrimPrefix(w.Header().Get("Location"), "/api/upload/")
+
+	r = newTusRequest("PATCH", "/", "456789", user.ID, map[string]string{"id": id})
+	r.Header.Set("Upload-Offset", "2")
+	w = httptest.NewRecorder()
+	tusResumable(app.apiPatchUploadHandler)(w, r)
+	if w.Code != http.StatusConflict {
+		t.Errorf("got status %d patching at the wrong offset, want 409", w.Code)
+	}
+
+	r.Header.Set("Upload-Offset", "4")
+	w = httptest.NewRecorder()
+	tusResumable(app.apiPatchUploadHandler)(w, r)
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "10" {
+		t.Fatalf("got status %d and offset %q, want 204 and 10: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body)
+	}
+
+	upload := &models.Upload{}
+	app.DataBase.Where("id = ?", id).Find(upload)
+	video := &models.Video{}
+	app.DataBase.Preload("Categories").Find(video, upload.VideoID)
+	if video.ID == 0 || video.Title != "My Video" || len(video.Categories) != 1 {
+		t.Fatalf("got video %+v, want My Video in a single category", video)
+	}
+	var jobs int64
+	app.DataBase.Model(&models.Job{}).Where("video_id = ? AND type = ?", video.ID, jobProcessVideo).Count(&jobs)
+	if jobs != 1 {
+		t.Errorf("got %d processing jobs, want 1", jobs)
+	}
+}
+
+func TestCreateVideoRollsBack(t *testing.T) {
+	app := newTestApp(t)
+	user := newTestUser(t, app, "uploader")
+
+	failure := errors.New("failure")
+	vid := &models.Video{UserID: user.ID, Title: "video"}
+	err := app.createVideo(vid, nil, "source.mp4", func(tx *gorm.DB) error {
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("got %v, want the error of then", err)
+	}
+
+	var videos, jobs int64
+	app.DataBase.Model(&models.Video{}).Count(&videos)
+	app.DataBase.Model(&models.Job{}).Count(&jobs)
+	if videos != 0 || jobs != 0 {
+		t.Errorf("got %d videos and %d jobs after a failure, want none", videos, jobs)
+	}
+}
+
+func TestExpireUploadsStops(t *testing.T) {
+	app := newTestApp(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.expireUploads(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expireUploads didn't return once cancelled")
+	}
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prologic/tube/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// opens the configured view store
+func (app *App) openViews() error {
+	if app.Config.Views.FlushInterval <= 0 {
+		return fmt.Errorf("invalid views flush_interval: %d", app.Config.Views.FlushInterval)
+	}
+	store, err := NewStore(
+		app.Config.Views.Store,
+		app.Config.Server.StorePath,
+		app.DataBase,
+		time.Duration(app.Config.Views.Window)*time.Second,
+	)
+	if err != nil {
+		return err
+	}
+	app.Views = store
+	return nil
+}
+
+// reports whether userAgent is a crawler's; requests without one are taken
+// as made by a script
+func (app *App) isCrawler(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+	userAgent = strings.ToLower(userAgent)
+	for _, crawler := range app.Config.Views.Crawlers {
+		if crawler != "" && strings.Contains(userAgent, strings.ToLower(crawler)) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the address of the client making the request
+func (app *App) clientAddr(r *http.Request) string {
+	if app.Config.Views.TrustProxy {
+		// the proxy appends the address it was connected from, anything
+		// before it comes from the client
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			addrs := strings.Split(values[len(values)-1], ",")
+			if addr := strings.TrimSpace(addrs[len(addrs)-1]); addr != "" {
+				return addr
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// returns who is making the request, the authenticated user or else the
+// client's address, hashed so stores don't keep addresses
+func (app *App) viewerID(r *http.Request) string {
+	viewer := "addr:" + app.clientAddr(r)
+	if tk, err := app.authenticate(r); err == nil {
+		viewer = fmt.Sprintf("user:%d", tk.UserID)
+	}
+	sum := sha256.Sum256([]byte(viewer))
+	return hex.EncodeToString(sum[:16])
+}
+
+// counts a view of video unless the request is made by a crawler or a
+// viewer counted recently
+func (app *App) recordView(r *http.Request, video *models.Video) {
+	if r.Method != http.MethodGet || video.Status != models.VideoReady {
+		return
+	}
+	if app.isCrawler(r.UserAgent()) {
+		return
+	}
+	if _, err := app.Views.RecordView(video.ID, app.viewerID(r)); err != nil {
+		log.WithError(err).WithField("video", video.ID).Warn("error recording view")
+	}
+}
+
+// adds the views recorded meanwhile to the videos every flush interval
+// until ctx is cancelled
+func (app *App) flushViews(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(app.Config.Views.FlushInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.flushViewCounts()
+		}
+	}
+}
+
+func (app *App) flushViewCounts() {
+	if err := app.Views.Expire(); err != nil {
+		log.WithError(err).Error("error expiring viewers")
+	}
+
+	views, err := app.Views.TakeViews()
+	if err != nil {
+		log.WithError(err).Error("error taking views")
+	}
+	for id, n := range views {
+		res := app.DataBase.
+			Model(&models.Video{}).
+			Where("id = ?", id).
+			UpdateColumn("views", gorm.Expr("views + ?", n))
+		if res.Error != nil {
+			log.WithError(res.Error).WithField("video", id).Error("error flushing views")
+			// tried again with the next flush
+			if err := app.Views.IncViews(id, n); err != nil {
+				log.WithError(err).WithField("video", id).Error("error keeping views")
+			}
+			continue
+		}
+		app.indexVideo(id)
+	}
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOpenViewsFlushInterval(t *testing.T) {
+	app := newTestApp(t)
+	app.Config.Views.Store = StoreSQL
+	app.Config.Views.FlushInterval = 0
+	if err := app.openViews(); err == nil {
+		t.Error("opened views flushed every 0s, want an error")
+	}
+}
+
+func TestFlushViewsStops(t *testing.T) {
+	app := newTestApp(t)
+	app.Views = NewSQLStore(app.DataBase, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.flushViews(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("flushViews didn't return once cancelled")
+	}
+}
@@ -33,8 +33,8 @@ export class AccountComponent implements OnInit {
         });
         this.vidService
             .getUserVideos(this.user.id)
-            .subscribe(vids => {
-                this.myVideos = vids;
+            .subscribe(page => {
+                this.myVideos = page.items;
             });
     }
 
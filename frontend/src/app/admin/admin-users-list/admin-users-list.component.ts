@@ -1,5 +1,5 @@
 import { Component, OnInit } from '@angular/core';
-import { User } from '../../models';
+import { Page, User } from '../../models';
 import { AdminService } from './../../services';
 
 @Component({
@@ -9,7 +9,7 @@ import { AdminService } from './../../services';
 export class AdminUsersListComponent implements OnInit {
 
     users: User[] = [];
-    pages: number = 1;
+    cursors: string[] = [''];  // cursors[n] loads page n
     currentPage: number = 0;
     total: number;
     pageSize: number = 10;
@@ -18,21 +18,25 @@ export class AdminUsersListComponent implements OnInit {
     { }
 
     ngOnInit(): void {
-        this.adminService
-            .getUsers(0, this.pageSize)
-            .subscribe(resp => { 
-                this.users = resp.users; 
-                this.total = resp.total;
-                this.pages = Math.ceil(resp.total / this.pageSize);
-            });
+        this.switchPage(0);
     }
 
-    switchPage(page: number): void {
-        const limit = this.pageSize;
-        this.currentPage = page;
-        this.adminService
-            .getUsers(page*limit, limit)
-            .subscribe(resp => { this.users = resp.users; });
+    // cursors only lead forward, so pages not visited yet are walked to
+    async switchPage(page: number) {
+        let resp: Page<User>;
+        let p = Math.min(page, this.cursors.length - 1);
+        for (;; p++) {
+            resp = await this.adminService
+                .getUsers(this.cursors[p], this.pageSize)
+                .toPromise();
+            if (resp.nextCursor) {
+                this.cursors[p + 1] = resp.nextCursor;
+            }
+            if (p >= page || !resp.nextCursor) break;
+        }
+        this.currentPage = p;
+        this.users = resp.items;
+        this.total = resp.total;
     }
 
     async deleteUser(id: number) {
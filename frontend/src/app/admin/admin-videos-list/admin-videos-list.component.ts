@@ -1,5 +1,5 @@
 import { Component, OnInit } from '@angular/core';
-import { User, Video } from 'src/app/models';
+import { Page, Video } from 'src/app/models';
 import { AdminService } from 'src/app/services';
 
 @Component({
@@ -8,7 +8,7 @@ import { AdminService } from 'src/app/services';
 })
 export class AdminVideosListComponent implements OnInit {
     videos: Video[] = [];
-    pages: number = 1;
+    cursors: string[] = [''];  // cursors[n] loads page n
     currentPage: number = 0;
     total: number;
     pageSize: number = 10;
@@ -17,23 +17,25 @@ export class AdminVideosListComponent implements OnInit {
     { }
 
     ngOnInit(): void {
-        this.adminService
-            .getVideos(0, this.pageSize)
-            .subscribe(resp => { 
-                console.log("Resp: ", resp);
-                
-                this.videos = resp.videos; 
-                this.total = resp.total;
-                this.pages = Math.ceil(resp.total / this.pageSize);
-            });
+        this.switchPage(0);
     }
 
-    switchPage(page: number): void {
-        const limit = this.pageSize;
-        this.currentPage = page;
-        this.adminService
-            .getUsers(page*limit, limit)
-            .subscribe(resp => { this.videos = resp.videos; });
+    // cursors only lead forward, so pages not visited yet are walked to
+    async switchPage(page: number) {
+        let resp: Page<Video>;
+        let p = Math.min(page, this.cursors.length - 1);
+        for (;; p++) {
+            resp = await this.adminService
+                .getVideos(this.cursors[p], this.pageSize)
+                .toPromise();
+            if (resp.nextCursor) {
+                this.cursors[p + 1] = resp.nextCursor;
+            }
+            if (p >= page || !resp.nextCursor) break;
+        }
+        this.currentPage = p;
+        this.videos = resp.items;
+        this.total = resp.total;
     }
 
     async deleteVideo(id: number) {
@@ -11,6 +11,8 @@ import { VideoComponent } from './video/video.component';
 import { UserProfileComponent } from './user-profile/user-profile.component';
 import { BestVideosComponent } from './best-videos/best-videos.component';
 import { VideoEditComponent } from './video/video-edit/video-edit.component';
+import { SearchComponent } from './search/search.component';
+import { SubscriptionsComponent } from './subscriptions/subscriptions.component';
 
 
 const routes: Routes = [
@@ -19,6 +21,8 @@ const routes: Routes = [
     { path: 'upload', component: UploadComponent, canActivate: [AuthGuard] },
     { path: 'account', component: AccountComponent, canActivate: [AuthGuard] },
     { path: 'best', component: BestVideosComponent },
+    { path: 'search', component: SearchComponent },
+    { path: 'subscriptions', component: SubscriptionsComponent, canActivate: [AuthGuard] },
     { path: 'login', component: LoginComponent },
     { path: 'signup', component: SignupComponent },
     { path: 'v/:id', component: VideoComponent },
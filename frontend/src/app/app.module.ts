@@ -31,6 +31,7 @@ import { AdminUsersChartComponent } from './admin/admin-users-chart/admin-users-
 import { BestVideosComponent } from './best-videos/best-videos.component';
 import { NgSelectModule } from '@ng-select/ng-select';
 import { VideoEditComponent } from './video/video-edit/video-edit.component';
+import { SubscriptionsComponent } from './subscriptions/subscriptions.component';
 
 
 @NgModule({
@@ -53,7 +54,8 @@ import { VideoEditComponent } from './video/video-edit/video-edit.component';
         AdminVideosListComponent,
         AdminUsersChartComponent,
         BestVideosComponent,
-        VideoEditComponent
+        VideoEditComponent,
+        SubscriptionsComponent
     ],
     imports: [
         BrowserModule,
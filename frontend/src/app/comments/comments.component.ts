@@ -10,6 +10,7 @@ import { Comment, User } from '../models';
 export class CommentsComponent implements OnInit {
     @Input() videoId: number;
     @Input() userId: number;
+    @Input() ownerId: number; // owner of the video
 
     newComment: Comment = new Comment();
 
@@ -21,6 +22,19 @@ export class CommentsComponent implements OnInit {
             .toPromise();
     }
 
+    loadMore() {
+        this.commentsService
+            .list(this.videoId, true)
+            .toPromise();
+    }
+
+    sortBy(sort: string) {
+        this.commentsService.sort = sort;
+        this.commentsService
+            .list(this.videoId)
+            .toPromise();
+    }
+
     submitComment() {
         this.commentsService
             .create(this.newComment.text, this.videoId)
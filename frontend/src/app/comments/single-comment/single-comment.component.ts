@@ -11,27 +11,77 @@ export class SingleCommentComponent {
 
     @Input() comment: Comment;
     @Input() userId: number; // current user id
+    @Input() ownerId: number; // owner of the video
     repliesShown: boolean = false;
+    editing: boolean = false;
+    editText: string;
 
     constructor(private commentsService: CommentsService) { }
 
     toggleReplies() {
         this.repliesShown = !this.repliesShown;
         if (this.repliesShown && this.comment.replies.length < this.comment.replyCount) {
-            this.commentsService.get(this.comment.id).subscribe(comm => {                
-                this.comment.replies = [...comm.replies];
-                this.comment.replyCount = comm.replyCount;
-            })
+            this.commentsService.replies(this.comment).toPromise();
         }
     }
 
+    moreReplies() {
+        this.commentsService.replies(this.comment, true).toPromise();
+    }
+
     reply() {
         this.commentsService.replyTo = this.comment;
     }
 
+    get isOwner(): boolean {
+        return this.userId === this.ownerId;
+    }
+
+    toggleLike() {
+        this.commentsService.like(this.comment.id, !this.comment.liked).subscribe(
+            updated => Object.assign(this.comment, {
+                likes: updated.likes,
+                score: updated.score,
+                liked: updated.liked,
+            })
+        );
+    }
+
+    toggleHeart() {
+        this.commentsService.heart(this.comment.id, !this.comment.hearted).subscribe(
+            updated => this.comment.hearted = updated.hearted
+        );
+    }
+
+    togglePin() {
+        this.commentsService.pin(this.comment, !this.comment.pinned).toPromise();
+    }
+
+    edit() {
+        this.editText = this.comment.text;
+        this.editing = true;
+    }
+
+    saveEdit() {
+        this.commentsService.edit(this.comment.id, this.editText).subscribe(
+            edited => {
+                Object.assign(this.comment, {
+                    text: edited.text,
+                    editedAt: edited.editedAt,
+                });
+                this.editing = false;
+            }
+        );
+    }
+
     deleteComm() {
         if (confirm(`Are you sure to delete comment "${this.comment.text}"?`)) {
-            this.commentsService.delete(this.comment.id).toPromise();
+            this.commentsService.delete(this.comment.id).subscribe(
+                deleted => Object.assign(this.comment, {
+                    text: deleted.text,
+                    deletedAt: deleted.deletedAt,
+                })
+            );
         }
     }
 
@@ -2,7 +2,7 @@ import { Injectable } from '@angular/core';
 import { HttpRequest, HttpHandler, HttpEvent, HttpInterceptor } from '@angular/common/http';
 import { Observable, throwError } from 'rxjs';
 import { AuthService, NotificationService } from '../services';
-import { catchError } from 'rxjs/operators';
+import { catchError, switchMap } from 'rxjs/operators';
 
 @Injectable()
 export class ErrorInterceptor implements HttpInterceptor {
@@ -13,6 +13,20 @@ export class ErrorInterceptor implements HttpInterceptor {
 
     intercept(request: HttpRequest<any>, next: HttpHandler): Observable<HttpEvent<any>> {
         return next.handle(request).pipe(catchError(err => {
+            // access tokens are short lived: try to refresh once and retry
+            if (err.status === 401 && !request.url.includes('/auth/') &&
+                this.authenticationService.currentUserValue?.refreshToken) {
+                return this.authenticationService.refresh().pipe(
+                    switchMap(user => next.handle(request.clone({
+                        setHeaders: { 'Authorization': `${user.token}` }
+                    }))),
+                    catchError(() => {
+                        this.authenticationService.logout();
+                        this.notifService.error("Not authorized!");
+                        return throwError(err.statusText);
+                    })
+                );
+            }
             if (err.status === 401) {
                 // auto logout if 401 response returned from api
                 this.authenticationService.logout();
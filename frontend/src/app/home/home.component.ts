@@ -14,8 +14,8 @@ export class HomeComponent implements OnInit {
     constructor(public vidService: VideoService) { }
 
     ngOnInit(): void {
-        this.vidService.list().subscribe((vids) => {
-            this.videos = vids
+        this.vidService.list().subscribe(page => {
+            this.videos = page.items;
         });
     }
 
@@ -9,7 +9,26 @@ export class Comment {
     replyCount: number = 0;
     replies: Comment[] = [];
     text: string;
+    likes: number = 0;
+    // likes plus replies
+    score: number = 0;
+    hearted: boolean = false;
+    pinned: boolean = false;
+    // whether the current user liked it
+    liked: boolean = false;
     createdAt: Date;
+    editedAt?: Date;
+    deletedAt?: Date;
+    // cursor of the next page of replies, if any
+    repliesCursor?: string;
+
+    get isDeleted(): boolean {
+        return !!this.deletedAt;
+    }
+
+    get isEdited(): boolean {
+        return !!this.editedAt;
+    }
 
     constructor (base: any = undefined) {
         if (base) {
@@ -20,7 +39,18 @@ export class Comment {
             this.replyTo = base['replyTo'];
             this.replyCount = base['replyCount'];
             this.text = base['text'];
+            this.likes = base['likes'];
+            this.score = base['score'];
+            this.hearted = base['hearted'];
+            this.pinned = base['pinned'];
+            this.liked = base['liked'];
             this.createdAt = new Date(base['createdAt']);
+            if (base['editedAt']) {
+                this.editedAt = new Date(base['editedAt']);
+            }
+            if (base['deletedAt']) {
+                this.deletedAt = new Date(base['deletedAt']);
+            }
     
             if (base['replies']) {
                 this.replies = base['replies'].map(r => new Comment(r));
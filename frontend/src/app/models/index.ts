@@ -2,4 +2,5 @@ export * from './user';
 export * from './user-stats';
 export * from './video';
 export * from './comment';
-export * from './category';
\ No newline at end of file
+export * from './category';
+export * from './page';
\ No newline at end of file
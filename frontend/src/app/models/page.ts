@@ -0,0 +1,12 @@
+// One page of a paginated list. Pass nextCursor back to get the next page.
+export class Page<T> {
+    items: T[];
+    nextCursor?: string;
+    total: number;
+
+    constructor(base: any, mapItem: (item: any) => T) {
+        this.items = (base['items'] || []).map(mapItem);
+        this.nextCursor = base['nextCursor'];
+        this.total = base['total'];
+    }
+}
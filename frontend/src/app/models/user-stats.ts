@@ -5,7 +5,7 @@ export class UserStats {
     password: string;
     email: string;
     token?: string;
-    isAdmin: string;
+    role: string;
     createdAt: Date;
     totalViews: number;
     numVideos: number;
@@ -15,7 +15,7 @@ export class UserStats {
         this.name = base['name'];
         this.password = base['password'];
         this.email = base['email'];
-        this.isAdmin = base['isAdmin'];
+        this.role = base['role'];
         this.createdAt = base['createdAt'];
         this.totalViews = base['totalViews'];
         this.numVideos = base['numVideos'];
@@ -5,15 +5,21 @@ export class User {
     password: string;
     email: string;
     token?: string;
-    isAdmin: string;
+    refreshToken?: string;
+    role: string;
     createdAt: Date;
+    // set on profiles
+    subscribers?: number;
+    subscribed?: boolean;
 
     constructor(base: any) {
         this.id = base['id'];
         this.name = base['name'];
         this.password = base['password'];
         this.email = base['email'];
-        this.isAdmin = base['isAdmin'];
+        this.role = base['role'];
         this.createdAt = base['createdAt'];
+        this.subscribers = base['subscribers'];
+        this.subscribed = base['subscribed'];
     }
 }
@@ -13,6 +13,8 @@ export class Video {
     dislikes: number;
     url: string;
     thumbnail: string;
+    status: string;
+    statusError: string;
     categories: Category[] = [];
     createdAt: Date;
     categoryIds: number[];
@@ -29,9 +31,15 @@ export class Video {
         this.dislikes =     base['dislikes'];
         this.url =          base['url'];
         this.thumbnail =    base['thumbnail'];
+        this.status =       base['status'];
+        this.statusError =  base['statusError'];
         this.createdAt =    new Date(base['createdAt']);
         if (base['categories']) {
             this.categories = base['categories'].map(c => new Category(c.category));
         }
     }
+
+    public get isReady(): boolean {
+        return this.status === 'ready';
+    }
 }
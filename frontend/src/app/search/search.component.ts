@@ -1,15 +1,89 @@
 import { Component, OnInit } from '@angular/core';
+import { ActivatedRoute, Router } from '@angular/router';
+import { Category, Video } from '../models';
+import { VideoService } from '../services';
 
 @Component({
-  selector: 'app-search',
-  templateUrl: './search.component.html',
-  styleUrls: ['./search.component.scss']
+    selector: 'app-search',
+    templateUrl: './search.component.html',
+    styleUrls: ['./search.component.scss']
 })
 export class SearchComponent implements OnInit {
 
-  constructor() { }
+    readonly pageSize = 20;
 
-  ngOnInit(): void {
-  }
+    query: string = '';
+    category: string = '';
+    sort: string = 'relevance';
+    minDuration: number;
+    maxDuration: number;
+    after: string = '';
+    before: string = '';
+
+    categories: Category[] = [];
+    videos: Video[] = [];
+    total: number = 0;
+    nextCursor: string;
+    loading: boolean = false;
+
+    constructor(
+        public vidService: VideoService,
+        private route: ActivatedRoute,
+        private router: Router
+    ) { }
+
+    ngOnInit(): void {
+        this.vidService.getAllCategories()
+            .subscribe(cats => this.categories = cats);
+
+        this.route.queryParamMap.subscribe(params => {
+            this.query = params.get('q') || '';
+            this.category = params.get('category') || '';
+            this.sort = params.get('sort') || 'relevance';
+            this.minDuration = +params.get('min_duration') || undefined;
+            this.maxDuration = +params.get('max_duration') || undefined;
+            this.after = params.get('after') || '';
+            this.before = params.get('before') || '';
+            this.load(true);
+        });
+    }
+
+    submit() {
+        this.router.navigate(['/search'], { queryParams: this.params() });
+    }
+
+    loadMore() {
+        this.load(false);
+    }
+
+    private load(reset: boolean) {
+        if (reset) {
+            this.videos = [];
+            this.nextCursor = undefined;
+        }
+        const params = { ...this.params(), limit: String(this.pageSize) };
+        if (this.nextCursor) {
+            params.cursor = this.nextCursor;
+        }
+
+        this.loading = true;
+        this.vidService.search(params).subscribe(page => {
+            this.videos = [...this.videos, ...page.items];
+            this.total = page.total;
+            this.nextCursor = page.nextCursor;
+            this.loading = false;
+        }, () => this.loading = false);
+    }
+
+    private params() {
+        const params: { [param: string]: string } = { sort: this.sort };
+        if (this.query) params.q = this.query;
+        if (this.category) params.category = this.category;
+        if (this.minDuration) params.min_duration = String(this.minDuration);
+        if (this.maxDuration) params.max_duration = String(this.maxDuration);
+        if (this.after) params.after = this.after;
+        if (this.before) params.before = this.before;
+        return params;
+    }
 
 }
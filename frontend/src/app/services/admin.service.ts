@@ -1,7 +1,7 @@
 import { Injectable } from '@angular/core';
 import { HttpClient } from '@angular/common/http';
 import { map } from 'rxjs/operators';
-import { User, UserStats, Video } from '../models';
+import { Page, User, UserStats, Video } from '../models';
 
 @Injectable({ providedIn: 'root' })
 export class AdminService {
@@ -10,13 +10,10 @@ export class AdminService {
 
     constructor(private http: HttpClient) {}
 
-    public getUsers (offset: number = 0, limit: number = 10) {
+    public getUsers (cursor: string = '', limit: number = 10) {
         return this.http
-            .get<any>(`${this.BASE_URL}/user/?offset=${offset}&limit=${limit}`)
-            .pipe(map(resp => {
-                resp.users = resp.users.map(usr => new User(usr));
-                return resp;
-            }));
+            .get<any>(`${this.BASE_URL}/user`, { params: { cursor, limit: String(limit) } })
+            .pipe(map(resp => new Page(resp, usr => new User(usr))));
     }
 
     public deleteUser(id: number) {
@@ -25,13 +22,10 @@ export class AdminService {
             .pipe();
     }
 
-    public getVideos(offset: number = 0, limit: number = 10) {
+    public getVideos(cursor: string = '', limit: number = 10) {
         return this.http
-            .get<any>(`${this.BASE_URL}/video/?offset=${offset}&limit=${limit}`)
-            .pipe(map(resp => {
-                resp.videos = resp.videos.map(vid => new Video(vid));
-                return resp;
-            }));
+            .get<any>(`${this.BASE_URL}/video`, { params: { cursor, limit: String(limit) } })
+            .pipe(map(resp => new Page(resp, vid => new Video(vid))));
     }
 
     public deleteVideo(id: number) {
@@ -27,20 +27,36 @@ export class AuthService {
 
     public login(data : { name: string, password: string }) {
         return this.http.post<any>(`http://localhost:8000/auth/login`, data)
-            .pipe(map(resp => {
-                const user = resp.user;
-                if (user) {
-                    user.token = resp.token;
-                    localStorage.setItem('currentUser', JSON.stringify(user));
-                    this.currentUserSubject.next(user);
-                    return user;
-                }
-            }));
+            .pipe(map(resp => this.storeTokens(resp)));
+    }
+
+    // exchange the refresh token for a new token pair
+    public refresh() {
+        const user = this.currentUserValue;
+        return this.http.post<any>(`http://localhost:8000/auth/refresh`, { refreshToken: user?.refreshToken })
+            .pipe(map(resp => this.storeTokens(resp)));
     }
 
     public logout() {
+        const user = this.currentUserValue;
+        if (user?.refreshToken) {
+            // revoke the refresh token server side, nothing to do on failure
+            this.http.post(`http://localhost:8000/auth/logout`, { refreshToken: user.refreshToken })
+                .subscribe({ error: () => {} });
+        }
         // remove user from local storage to log user out
         localStorage.removeItem('currentUser');
         this.currentUserSubject.next(null);
     }
-}
\ No newline at end of file
+
+    private storeTokens(resp: any) {
+        const user = resp.user;
+        if (user) {
+            user.token = resp.token;
+            user.refreshToken = resp.refreshToken;
+            localStorage.setItem('currentUser', JSON.stringify(user));
+            this.currentUserSubject.next(user);
+            return user;
+        }
+    }
+}
@@ -1,7 +1,7 @@
 import { HttpClient } from "@angular/common/http";
 import { Injectable } from "@angular/core";
 import { map } from "rxjs/operators";
-import { Comment } from "../models";
+import { Comment, Page } from "../models";
 import { AuthService } from "./auth.service";
 
 @Injectable({ providedIn: 'root' })
@@ -9,6 +9,9 @@ export class CommentsService {
     private BASE_URL: string = 'http://localhost:8000';
     public replyTo: Comment;
     public comments: Comment[] = [];
+    public nextCursor: string;
+    // sort of the comments: oldest, newest or top (likes plus replies)
+    public sort: string = 'oldest';
 
     constructor(
         private http: HttpClient, 
@@ -43,12 +46,22 @@ export class CommentsService {
             );
     }
 
-    public list(videoId: number) {
-        this.comments = [];
-        return this.http.get<any>(this.BASE_URL + '/api/video/' + videoId + '/comments')
+    // loads the first page of comments, or the next one with more = true
+    public list(videoId: number, more: boolean = false) {
+        if (!more) {
+            this.comments = [];
+            this.nextCursor = undefined;
+        }
+        const params: { [param: string]: string } = { sort: this.sort };
+        if (this.nextCursor) {
+            params.cursor = this.nextCursor;
+        }
+        return this.http.get<any>(this.BASE_URL + '/api/video/' + videoId + '/comments', { params })
             .pipe(
                 map(resp => {
-                    this.comments = resp.map(comm => new Comment(comm));
+                    const page = new Page(resp, comm => new Comment(comm));
+                    this.comments = [...this.comments, ...page.items];
+                    this.nextCursor = page.nextCursor;
                     return this.comments;
                 })
             )
@@ -61,15 +74,70 @@ export class CommentsService {
             );
     }
 
-    public delete(commId: number) {
-        return this.http.delete<any>(this.BASE_URL + '/api/comment/' + commId)
+    // loads the first page of replies to comm, or the next one with
+    // more = true
+    public replies(comm: Comment, more: boolean = false) {
+        if (!more) {
+            comm.replies = [];
+            comm.repliesCursor = undefined;
+        }
+        const params = comm.repliesCursor ? { cursor: comm.repliesCursor } : {};
+        return this.http.get<any>(this.BASE_URL + '/api/comment/' + comm.id + '/replies', { params })
             .pipe(
                 map(resp => {
-                    this.comments = this.comments.filter(comm => comm.id !== commId);
-                    return new Comment(resp)
+                    const page = new Page(resp, reply => new Comment(reply));
+                    comm.replies = [...comm.replies, ...page.items];
+                    comm.repliesCursor = page.nextCursor;
+                    comm.replyCount = page.total;
+                    return comm.replies;
                 })
             );
     }
 
+    public edit(commId: number, text: string) {
+        return this.http.put<any>(this.BASE_URL + '/api/comment/' + commId, { text })
+            .pipe(
+                map(resp => new Comment(resp))
+            );
+    }
+
+    public like(commId: number, liked: boolean) {
+        return this.http.put<any>(this.BASE_URL + '/api/comment/' + commId + '/like', { liked })
+            .pipe(
+                map(resp => new Comment(resp))
+            );
+    }
+
+    // hearts a comment, for the owner of the video
+    public heart(commId: number, hearted: boolean) {
+        return this.http.put<any>(this.BASE_URL + '/api/comment/' + commId + '/heart', { hearted })
+            .pipe(
+                map(resp => new Comment(resp))
+            );
+    }
+
+    // pins a comment to the top, for the owner of the video
+    public pin(comm: Comment, pinned: boolean) {
+        return this.http.put<any>(this.BASE_URL + '/api/comment/' + comm.id + '/pin', { pinned })
+            .pipe(
+                map(resp => {
+                    const updated = new Comment(resp);
+                    this.comments.forEach(c => c.pinned = false);
+                    comm.pinned = updated.pinned;
+                    if (comm.pinned) {
+                        this.comments = [comm, ...this.comments.filter(c => c !== comm)];
+                    }
+                    return updated;
+                })
+            );
+    }
+
+    public delete(commId: number) {
+        return this.http.delete<any>(this.BASE_URL + '/api/comment/' + commId)
+            .pipe(
+                map(resp => new Comment(resp))
+            );
+    }
+
 }
 
@@ -1,7 +1,7 @@
 import { HttpClient } from "@angular/common/http";
 import { Injectable } from "@angular/core";
 import { map } from "rxjs/operators";
-import { User } from "../models";
+import { Page, User } from "../models";
 
 @Injectable({ providedIn: 'root' })
 export class UserService {
@@ -20,5 +20,19 @@ export class UserService {
             .pipe(map(resp => new User(resp)));
     }
 
+    // subscribes to or unsubscribes from the videos of a user, responds
+    // with subscribed and the user's subscribers
+    public subscribe(id: number, subscribed: boolean) {
+        const url = `${this.BASE_URL}/api/user/${id}/subscribe`;
+        return (subscribed ? this.http.put<any>(url, {}) : this.http.delete<any>(url))
+            .pipe();
+    }
+
+    // params: sort (newest, oldest), limit, cursor
+    public subscriptions(id: number, params: { [param: string]: string } = {}) {
+        return this.http.get<any>(`${this.BASE_URL}/api/user/${id}/subscriptions`, { params })
+            .pipe(map(resp => new Page(resp, sub => new User(sub['channel']))));
+    }
+
 }
 
@@ -1,7 +1,7 @@
 import { HttpClient } from "@angular/common/http";
 import { Injectable } from "@angular/core";
 import { map } from "rxjs/operators";
-import { Video, Category } from "../models";
+import { Video, Category, Page } from "../models";
 
 @Injectable({ providedIn: 'root' })
 export class VideoService {
@@ -24,16 +24,19 @@ export class VideoService {
         return this.http.delete(this.BASE_URL + '/api/video/' + id).pipe();
     }
 
-    public list() {
+    // params: category, sort (newest, views, likes, duration), limit, cursor
+    public list(params: { [param: string]: string } = {}) {
         return this.http
-            .get<any>(this.BASE_URL + `/v/list`)
-            .pipe(map(resp => resp.map(vid => new Video(vid))));
+            .get<any>(this.BASE_URL + `/v/list`, { params })
+            .pipe(map(resp => new Page(resp, vid => new Video(vid))));
     }
 
-    public filter(options: any) {
+    // params: q, category, uploader, min_duration, max_duration,
+    // after, before, sort, limit, cursor
+    public search(params: { [param: string]: string }) {
         return this.http
-            .get<any>(this.BASE_URL + `/v/filter`, options)
-            .pipe();
+            .get<any>(this.BASE_URL + `/v/search`, { params })
+            .pipe(map(resp => new Page(resp, vid => new Video(vid))));
     }
 
     public getInfo(id: number) {
@@ -41,41 +44,30 @@ export class VideoService {
             .pipe(map(resp => new Video(resp)))
     }
 
-    // liked or disliked or none
-    public likeInfo(id: number) {
+    // like, dislike or none, with the video's likes and dislikes
+    public reaction(id: number) {
         return this.http
-            .get<any>(this.BASE_URL + `/api/like/` + id)
+            .get<any>(`${this.BASE_URL}/api/video/${id}/reaction`)
             .pipe()
     }
 
-    public like(id: number) {
+    public react(id: number, reaction: 'like' | 'dislike' | 'none') {
         return this.http
-            .post<any>(this.BASE_URL + `/api/like/` + id, {})
+            .put<any>(`${this.BASE_URL}/api/video/${id}/reaction`, { reaction })
             .pipe()
     }
 
-    public removeLike(id: number) {
+    // videos of the users subscribed to, newest first; params: limit, cursor
+    public subscriptionFeed(params: { [param: string]: string } = {}) {
         return this.http
-            .delete<any>(this.BASE_URL + `/api/like/` + id)
-            .pipe()
-    }
-
-    public dislike(id: number) {
-        return this.http
-            .post<any>(this.BASE_URL + `/api/dislike/` + id, {})
-            .pipe()
+            .get<any>(`${this.BASE_URL}/api/feed/subscriptions`, { params })
+            .pipe(map(resp => new Page(resp, vid => new Video(vid))));
     }
 
-    public removeDislike(id: number) {
-        return this.http
-            .delete<any>(this.BASE_URL + `/api/dislike/` + id)
-            .pipe()
-    }
-
-    public getUserVideos(id: number) {
-        return this.http.get<any>(`${this.BASE_URL}/user/${id}/video`)
+    public getUserVideos(id: number, params: { [param: string]: string } = {}) {
+        return this.http.get<any>(`${this.BASE_URL}/user/${id}/video`, { params })
             .pipe(
-                map(resp => resp.map(vid => new Video(vid)))
+                map(resp => new Page(resp, vid => new Video(vid)))
             );
     }
 
@@ -87,9 +79,9 @@ export class VideoService {
     }
 
     public getVideosInCategory(cat_id: number) {
-        return this.http.get<any>(`${this.BASE_URL}/v/list?category=${cat_id}`)
+        return this.list({ category: String(cat_id) })
             .pipe(
-                map(resp => resp.map(vid => new Video(vid)))
+                map(page => page.items)
             );
     }
 
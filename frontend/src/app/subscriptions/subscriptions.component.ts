@@ -0,0 +1,37 @@
+import { Component, OnInit } from '@angular/core';
+import { User, Video } from '../models';
+import { AuthService, UserService, VideoService } from '../services';
+
+@Component({
+    selector: 'subscriptions',
+    templateUrl: './subscriptions.component.html',
+    styleUrls: ['./subscriptions.component.scss']
+})
+export class SubscriptionsComponent implements OnInit {
+
+    videos: Video[] = [];
+    nextCursor: string;
+    channels: User[] = [];
+
+    constructor(
+        public vidService: VideoService,
+        private userService: UserService,
+        private auth: AuthService
+    ) { }
+
+    ngOnInit(): void {
+        this.userService
+            .subscriptions(this.auth.currentUserValue.id, { limit: '100' })
+            .subscribe(page => this.channels = page.items);
+        this.loadMore();
+    }
+
+    loadMore() {
+        const params = this.nextCursor ? { cursor: this.nextCursor } : {};
+        this.vidService.subscriptionFeed(params).subscribe(page => {
+            this.videos = [...this.videos, ...page.items];
+            this.nextCursor = page.nextCursor;
+        });
+    }
+
+}
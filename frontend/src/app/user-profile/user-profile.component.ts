@@ -2,7 +2,7 @@ import { Component, OnInit } from '@angular/core';
 import { FormControl, FormGroup, Validators } from '@angular/forms';
 import { ActivatedRoute } from '@angular/router';
 import { User, Video } from '../models';
-import { UserService, VideoService } from '../services';
+import { AuthService, UserService, VideoService } from '../services';
 
 @Component({
   selector: 'user-profile',
@@ -21,6 +21,7 @@ export class UserProfileComponent implements OnInit {
     constructor(
         private userService: UserService,
         public vidService: VideoService,
+        public auth: AuthService,
         private route: ActivatedRoute
     ) { }
 
@@ -30,8 +31,19 @@ export class UserProfileComponent implements OnInit {
             console.log(id);
             
             this.user = await this.userService.get(id).toPromise();
-            this.videos = await this.vidService.getUserVideos(this.user.id).toPromise();
+            this.videos = (await this.vidService.getUserVideos(this.user.id).toPromise()).items;
         })
     }
 
+    get canSubscribe(): boolean {
+        return this.auth.isAuthorized && this.auth.currentUserValue.id !== this.user.id;
+    }
+
+    toggleSubscription() {
+        this.userService.subscribe(this.user.id, !this.user.subscribed).subscribe(resp => {
+            this.user.subscribed = resp.subscribed;
+            this.user.subscribers = resp.subscribers;
+        });
+    }
+
 }
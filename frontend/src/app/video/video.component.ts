@@ -49,50 +49,33 @@ export class VideoComponent implements OnInit {
                 }
             });
         if (this.auth.isAuthorized) {
-            this.videoService.likeInfo(this.id)
+            this.videoService.reaction(this.id)
                 .subscribe(resp => {
-                    this.isLiked = resp.liked;
-                    this.isDisliked = resp.disliked;
+                    this.isLiked = resp.reaction === 'like';
+                    this.isDisliked = resp.reaction === 'dislike';
                 });
         }
     }
 
     toggleLike() {
-        if (!this.auth.isAuthorized) {
-            return;
-        }
-        if (this.isLiked) {
-            this.videoService.removeLike(this.video.id).toPromise();
-            this.isLiked = false;
-            this.video.likes--;
-        } else {
-            this.videoService.like(this.video.id).toPromise();
-            this.video.likes++;
-            this.isLiked = true;
-            if (this.isDisliked) {
-                this.video.dislikes--;
-                this.isDisliked = false;
-            }
-        }
+        this.react(this.isLiked ? 'none' : 'like');
     }
 
     toggleDislike() {
+        this.react(this.isDisliked ? 'none' : 'dislike');
+    }
+
+    private react(reaction: 'like' | 'dislike' | 'none') {
         if (!this.auth.isAuthorized) {
             return;
         }
-        if (this.isDisliked) {
-            this.videoService.removeDislike(this.video.id).toPromise();
-            this.isDisliked = false;
-            this.video.dislikes--;
-        } else {
-            this.videoService.dislike(this.video.id).toPromise();
-            this.video.dislikes++
-            this.isDisliked = true;
-            if (this.isLiked) {
-                this.video.likes--;
-                this.isLiked = false;
-            }
-        }
+        this.videoService.react(this.video.id, reaction)
+            .subscribe(resp => {
+                this.isLiked = resp.reaction === 'like';
+                this.isDisliked = resp.reaction === 'dislike';
+                this.video.likes = resp.likes;
+                this.video.dislikes = resp.dislikes;
+            });
     }
 
 }
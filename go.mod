@@ -4,6 +4,7 @@ go 1.14
 
 require (
 	github.com/GeertJohan/go.rice v1.0.0
+	github.com/blevesearch/bleve/v2 v2.0.5
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/dhowden/tag v0.0.0-20190519100835-db0c67e351b1
 	github.com/dustin/go-humanize v1.0.0
@@ -22,6 +23,7 @@ require (
 	golang.org/x/crypto v0.0.0-20201208171446-5f87f3452ae9
 	gopkg.in/yaml.v2 v2.2.4 // indirect
 	gorm.io/driver/mysql v1.0.3
+	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.20.8
     gopkg.in/guregu/null.v3 v3.5.0 
 )
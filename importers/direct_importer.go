@@ -0,0 +1,82 @@
+package importers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// videoExtensions are accepted for links served as application/octet-stream
+var videoExtensions = map[string]bool{
+	".mp4":  true,
+	".m4v":  true,
+	".mov":  true,
+	".mkv":  true,
+	".webm": true,
+	".avi":  true,
+}
+
+// DirectImporter imports links pointing straight at a media file. The link
+// is accepted if the server says it is a video.
+type DirectImporter struct {
+	Client *http.Client
+}
+
+// NewDirectImporter returns a DirectImporter whose requests only reach
+// public addresses, so that links to the local network or the metadata
+// service of cloud providers can't be imported.
+func NewDirectImporter() *DirectImporter {
+	return &DirectImporter{Client: NewPublicClient(30 * time.Second)}
+}
+
+func (i *DirectImporter) GetVideoInfo(url string) (videoInfo VideoInfo, err error) {
+	res, err := i.Client.Head(url)
+	if err == nil && res.StatusCode == http.StatusMethodNotAllowed {
+		// some servers only answer GET; ask for as little as possible
+		res.Body.Close()
+		var req *http.Request
+		req, err = http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return
+		}
+		req.Header.Set("Range", "bytes=0-0")
+		res, err = i.Client.Do(req)
+	}
+	if err != nil {
+		err = fmt.Errorf("error requesting %s: %w", url, err)
+		return
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		err = fmt.Errorf("error requesting %s: %s", url, res.Status)
+		return
+	}
+
+	// redirects are followed, download from where they ended
+	finalURL := res.Request.URL
+	name := path.Base(finalURL.Path)
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil {
+		if filename := params["filename"]; filename != "" {
+			name = path.Base(filename)
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(mediaType, "video/"):
+	case mediaType == "application/octet-stream" && videoExtensions[strings.ToLower(path.Ext(name))]:
+	default:
+		err = ErrUnsupportedVideoURL
+		return
+	}
+
+	videoInfo.ID = name
+	videoInfo.Title = strings.TrimSuffix(name, path.Ext(name))
+	videoInfo.VideoURL = finalURL.String()
+
+	return
+}
@@ -1,8 +1,8 @@
 package importers
 
 import (
+	"context"
 	"errors"
-	"strings"
 )
 
 var (
@@ -22,12 +22,8 @@ type Importer interface {
 	GetVideoInfo(url string) (VideoInfo, error)
 }
 
-func NewImporter(url string) (Importer, error) {
-	if strings.Contains(url, "youtube.com") || strings.HasPrefix(strings.ToLower(url), "youtube:") {
-		return &YoutubeImporter{}, nil
-	} else if strings.Contains(url, "vimeo.com") || strings.HasPrefix(strings.ToLower(url), "vimeo:") {
-		return &VimeoImporter{}, nil
-	} else {
-		return nil, ErrUnsupportedVideoURL
-	}
+// Downloader is implemented by importers that download videos themselves
+// instead of leaving it to the caller through VideoInfo.VideoURL.
+type Downloader interface {
+	Download(ctx context.Context, info VideoInfo, filename string) error
 }
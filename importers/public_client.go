@@ -0,0 +1,147 @@
+package importers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrPrivateAddress is returned for requests to addresses that aren't
+	// public, which links given to import must not reach
+	ErrPrivateAddress = errors.New("error: address is not public")
+)
+
+// privateNetworks are the networks not reachable from the internet besides
+// loopback, link-local and multicast ones, which net.IP tells itself
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"10.0.0.0/8",     // RFC 1918
+	"100.64.0.0/10",  // carrier-grade NAT
+	"172.16.0.0/12",  // RFC 1918
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // RFC 1918
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved, and broadcast
+	"fc00::/7",       // unique local
+	"64:ff9b:1::/48", // local-use NAT64
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// IsPublicIP reports whether ip is a public unicast address. Loopback,
+// private network and link-local addresses (among which the metadata
+// service of cloud providers, 169.254.169.254) aren't.
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupIP resolves host names, replaced by tests
+var lookupIP = net.LookupIP
+
+// CheckPublicURL returns ErrPrivateAddress unless the host of an http or
+// https URL only resolves to public addresses. It is checked before
+// handing URLs to importers that connect by themselves (e.g. yt-dlp),
+// which the dialer of NewPublicClient can't guard. Other URLs (e.g.
+// youtube:id shorthands) are left to their importer.
+func CheckPublicURL(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+
+	host := u.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		ips, err = lookupIP(host)
+		if err != nil {
+			return fmt.Errorf("error resolving %s: %w", host, err)
+		}
+	}
+	for _, ip := range ips {
+		if !IsPublicIP(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to addresses that aren't public. It runs
+// once the host name is resolved, for every address tried, so a name
+// resolving to a private address is caught too.
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// checkRedirect follows up to 10 redirects to http and https URLs. The
+// addresses redirected to are checked when connecting to them; literal
+// ones are refused here already.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to unsupported scheme: %s", req.URL.Scheme)
+	}
+	if ip := net.ParseIP(req.URL.Hostname()); ip != nil && !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	return nil
+}
+
+// NewPublicClient returns a client that only connects to public addresses,
+// including after redirects, for fetching links given to import. It has
+// connection timeouts; timeout bounds whole requests unless 0. Proxies
+// aren't used, the addresses they'd connect to couldn't be checked.
+func NewPublicClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:       timeout,
+		CheckRedirect: checkRedirect,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				Control:   dialControl,
+			}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+		},
+	}
+}
@@ -0,0 +1,127 @@
+package importers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.32.0.1", true},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+	}
+	for _, test := range tests {
+		if got := IsPublicIP(net.ParseIP(test.ip)); got != test.public {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", test.ip, got, test.public)
+		}
+	}
+}
+
+func TestPublicClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+	}))
+	defer srv.Close()
+
+	// the test server listens on loopback
+	_, err := NewDirectImporter().GetVideoInfo(srv.URL + "/video.mp4")
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("got %v requesting a loopback address, want ErrPrivateAddress", err)
+	}
+	_, err = NewDirectImporter().GetVideoInfo("http://localhost:1/video.mp4")
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("got %v requesting localhost, want ErrPrivateAddress", err)
+	}
+}
+
+func TestPublicClientRedirects(t *testing.T) {
+	client := NewPublicClient(0)
+	via := []*http.Request{httptest.NewRequest("GET", "https://example.com/video", nil)}
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.org/video.mp4", true},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://[::1]:8000/video.mp4", false},
+		{"http://10.0.0.1/video.mp4", false},
+		{"file:///etc/passwd", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		if err := client.CheckRedirect(req, via); (err == nil) != test.ok {
+			t.Errorf("redirect to %s: got %v, want allowed %v", test.url, err, test.ok)
+		}
+	}
+}
+
+func TestDirectImporter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/watch":
+			http.Redirect(w, r, "/files/clip.webm", http.StatusFound)
+		case "/files/clip.webm":
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case "/get-only":
+			if r.Method != http.MethodGet || r.Header.Get("Range") != "bytes=0-0" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Header().Set("Content-Disposition", `attachment; filename="My Video.mp4"`)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	// the test server isn't public
+	importer := &DirectImporter{Client: srv.Client()}
+
+	info, err := importer.GetVideoInfo(srv.URL + "/watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.VideoURL != srv.URL+"/files/clip.webm" || info.Title != "clip" {
+		t.Errorf("got %+v, want clip from the redirect target", info)
+	}
+
+	info, err = importer.GetVideoInfo(srv.URL + "/get-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "My Video.mp4" || info.Title != "My Video" {
+		t.Errorf("got %+v, want the name of the Content-Disposition", info)
+	}
+
+	if _, err := importer.GetVideoInfo(srv.URL + "/page"); err != ErrUnsupportedVideoURL {
+		t.Errorf("got %v for a page, want ErrUnsupportedVideoURL", err)
+	}
+	if _, err := importer.GetVideoInfo(srv.URL + "/missing"); err == nil {
+		t.Error("got no error for a missing file")
+	}
+}
@@ -0,0 +1,91 @@
+package importers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// entry is an importer along with the rules selecting it
+type entry struct {
+	name     string
+	priority int
+	match    []*regexp.Regexp
+	importer Importer
+}
+
+// Registry selects the importers for an URL. Importers whose match rules
+// (regular expressions) match the URL are tried by decreasing priority.
+type Registry struct {
+	entries []*entry
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds an importer used for URLs matching any of patterns.
+func (r *Registry) Register(name string, priority int, patterns []string, importer Importer) error {
+	e := &entry{name: name, priority: priority, importer: importer}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid match rule %q of importer %s: %w", pattern, name, err)
+		}
+		e.match = append(e.match, re)
+	}
+	r.entries = append(r.entries, e)
+	sort.SliceStable(r.entries, func(i, j int) bool {
+		return r.entries[i].priority > r.entries[j].priority
+	})
+	return nil
+}
+
+// Supports reports whether any importer matches url.
+func (r *Registry) Supports(url string) bool {
+	return len(r.lookup(url)) > 0
+}
+
+// GetVideoInfo resolves url with the first matching importer that succeeds
+// and returns it along with the video info. URLs of hosts that aren't
+// public are refused before any importer runs, and an importer finding
+// that url leads to one (e.g. by redirecting) ends the search: the next
+// importers would be led there too.
+func (r *Registry) GetVideoInfo(url string) (Importer, VideoInfo, error) {
+	entries := r.lookup(url)
+	if len(entries) == 0 {
+		return nil, VideoInfo{}, ErrUnsupportedVideoURL
+	}
+	if err := CheckPublicURL(url); err != nil {
+		return nil, VideoInfo{}, err
+	}
+
+	var errs []string
+	for _, e := range entries {
+		info, err := e.importer.GetVideoInfo(url)
+		if err == nil {
+			return e.importer, info, nil
+		}
+		if errors.Is(err, ErrPrivateAddress) {
+			return nil, VideoInfo{}, fmt.Errorf("%s: %w", e.name, err)
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", e.name, err))
+	}
+	return nil, VideoInfo{}, fmt.Errorf("no importer could resolve %s (%s)", url, strings.Join(errs, "; "))
+}
+
+func (r *Registry) lookup(url string) []*entry {
+	var entries []*entry
+	for _, e := range r.entries {
+		for _, re := range e.match {
+			if re.MatchString(url) {
+				entries = append(entries, e)
+				break
+			}
+		}
+	}
+	return entries
+}
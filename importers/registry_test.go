@@ -0,0 +1,69 @@
+package importers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// fakeImporter answers GetVideoInfo with err, counting its calls
+type fakeImporter struct {
+	err   error
+	calls int
+}
+
+func (i *fakeImporter) GetVideoInfo(url string) (VideoInfo, error) {
+	i.calls++
+	return VideoInfo{VideoURL: url}, i.err
+}
+
+func TestRegistryFallback(t *testing.T) {
+	defer func(lookup func(string) ([]net.IP, error)) { lookupIP = lookup }(lookupIP)
+	lookupIP = func(host string) ([]net.IP, error) {
+		switch host {
+		case "public.example":
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		case "internal.example":
+			return []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("10.0.0.1")}, nil
+		}
+		return nil, fmt.Errorf("no such host: %s", host)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		// error of the first importer
+		err error
+		// whether the fallback importer is tried
+		fallback bool
+		private  bool
+	}{
+		{"resolved", "https://public.example/video.mp4", nil, false, false},
+		{"not a video", "https://public.example/page", ErrUnsupportedVideoURL, true, false},
+		// e.g. redirected to the local network
+		{"led to a private address", "https://public.example/redirect", fmt.Errorf("error requesting: %w", ErrPrivateAddress), false, true},
+		{"private address", "http://169.254.169.254/latest/", nil, false, true},
+		{"resolving to a private address", "https://internal.example/video.mp4", nil, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first := &fakeImporter{err: test.err}
+			fallback := &fakeImporter{}
+			registry := NewRegistry()
+			registry.Register("first", 20, []string{`^https?://`}, first)
+			registry.Register("fallback", 10, []string{`^https?://`}, fallback)
+
+			_, _, err := registry.GetVideoInfo(test.url)
+			if errors.Is(err, ErrPrivateAddress) != test.private {
+				t.Errorf("got error %v, want ErrPrivateAddress: %v", err, test.private)
+			}
+			if tried := fallback.calls > 0; tried != test.fallback {
+				t.Errorf("fallback tried: %v, want %v", tried, test.fallback)
+			}
+			if test.private && test.err == nil && first.calls > 0 {
+				t.Error("importer run for a private address")
+			}
+		})
+	}
+}
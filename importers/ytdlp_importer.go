@@ -0,0 +1,140 @@
+package importers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prologic/tube/utils"
+)
+
+// YtDlpImporter resolves and downloads videos with the yt-dlp command,
+// which supports most video hosting sites.
+type YtDlpImporter struct {
+	// path or name of the yt-dlp binary
+	Binary string
+	// yt-dlp format selection, e.g. bestvideo+bestaudio/best
+	Format string
+	// seconds a yt-dlp run may take, 0 for no limit
+	Timeout int
+	// MaxSize in bytes of the downloaded video, 0 for no limit
+	MaxSize int64
+	// Proxy yt-dlp connects through (its --proxy), if set. yt-dlp follows
+	// redirects and resolves hosts itself; a proxy refusing private
+	// addresses keeps it from reaching them.
+	Proxy string
+}
+
+// ytDlpInfo is the part of yt-dlp's --dump-single-json output we use
+type ytDlpInfo struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Thumbnail   string `json:"thumbnail"`
+	WebpageURL  string `json:"webpage_url"`
+}
+
+// args returns the arguments of a yt-dlp run for url, or ErrPrivateAddress
+// if url leads to an address that isn't public
+func (i *YtDlpImporter) args(url string, args ...string) ([]string, error) {
+	if err := CheckPublicURL(url); err != nil {
+		return nil, err
+	}
+	if i.Proxy != "" {
+		args = append(args, "--proxy", i.Proxy)
+	}
+	return append(args, url), nil
+}
+
+func (i *YtDlpImporter) GetVideoInfo(url string) (videoInfo VideoInfo, err error) {
+	url = expandShorthand(url)
+
+	args, err := i.args(url, "--dump-single-json", "--no-playlist", "--no-warnings")
+	if err != nil {
+		return
+	}
+	out, err := utils.RunCmdOutput(i.Timeout, i.Binary, args...)
+	if err != nil {
+		err = fmt.Errorf("error retrieving video info: %w", err)
+		return
+	}
+
+	info := &ytDlpInfo{}
+	if err = json.Unmarshal(out, info); err != nil {
+		err = fmt.Errorf("error decoding video info: %w", err)
+		return
+	}
+
+	videoInfo.ID = info.ID
+	videoInfo.Title = info.Title
+	videoInfo.Description = info.Description
+	videoInfo.ThumbnailURL = info.Thumbnail
+	// yt-dlp downloads from the page, stream URLs are short lived
+	videoInfo.VideoURL = info.WebpageURL
+	if videoInfo.VideoURL == "" {
+		videoInfo.VideoURL = url
+	}
+
+	return
+}
+
+// Download runs yt-dlp, which resumes a previous partial download of
+// filename. Videos over MaxSize fail with utils.ErrTooLarge.
+func (i *YtDlpImporter) Download(ctx context.Context, info VideoInfo, filename string) error {
+	args := []string{
+		"--no-playlist", "--no-warnings", "--no-progress",
+		"--merge-output-format", "mp4",
+		"--output", filename,
+	}
+	if i.Format != "" {
+		args = append(args, "--format", i.Format)
+	}
+	if i.MaxSize > 0 {
+		args = append(args, "--max-filesize", strconv.FormatInt(i.MaxSize, 10))
+	}
+	// the page yt-dlp reported is checked again, it may differ from the
+	// URL given
+	args, err := i.args(info.VideoURL, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := utils.RunCmdContext(ctx, i.Timeout, i.Binary, args...); err != nil {
+		return fmt.Errorf("yt-dlp failed: %w", err)
+	}
+
+	// yt-dlp skips formats over --max-filesize without failing, and the
+	// limit applies to each format merged rather than to the result
+	stat, err := os.Stat(filename)
+	if os.IsNotExist(err) && i.MaxSize > 0 {
+		return utils.ErrTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	if i.MaxSize > 0 && stat.Size() > i.MaxSize {
+		os.Remove(filename)
+		return utils.ErrTooLarge
+	}
+	return nil
+}
+
+// expandShorthand turns provider:id URLs (e.g. youtube:Hks6Nq7g6P4) into
+// the video's page URL
+func expandShorthand(url string) string {
+	parts := strings.SplitN(url, ":", 2)
+	if len(parts) != 2 {
+		return url
+	}
+	id := strings.TrimSpace(parts[1])
+	switch strings.ToLower(parts[0]) {
+	case "youtube":
+		return "https://www.youtube.com/watch?v=" + id
+	case "vimeo":
+		return "https://vimeo.com/" + id
+	}
+	return url
+}
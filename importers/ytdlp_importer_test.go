@@ -0,0 +1,110 @@
+package importers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prologic/tube/utils"
+)
+
+// fakeYtDlp writes a yt-dlp stand-in to dir that records its arguments to
+// dir/args and downloads size bytes, or nothing if size < 0
+func fakeYtDlp(t *testing.T, dir string, size int) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell")
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$@" > "%s"
+while [ $# -gt 0 ]; do
+	if [ "$1" = --output ]; then out=$2; fi
+	shift
+done
+if [ %d -ge 0 ]; then head -c %d /dev/zero > "$out"; fi
+`, filepath.Join(dir, "args"), size, size)
+	binary := filepath.Join(dir, "yt-dlp")
+	if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return binary
+}
+
+func TestYtDlpDownload(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		size    int
+		err     error
+	}{
+		{"no limit", 0, 100, nil},
+		{"within limit", 100, 100, nil},
+		{"over limit", 100, 101, utils.ErrTooLarge},
+		// yt-dlp skips the video
+		{"skipped", 100, -1, utils.ErrTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tube-ytdlp-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			importer := &YtDlpImporter{Binary: fakeYtDlp(t, dir, test.size), MaxSize: test.maxSize}
+			filename := filepath.Join(dir, "video.mp4")
+			err = importer.Download(context.Background(), VideoInfo{VideoURL: "https://93.184.216.34/v"}, filename)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if err != nil && utils.FileExists(filename) {
+				t.Error("too large video left on disk")
+			}
+
+			args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			limit := fmt.Sprintf("--max-filesize %d", test.maxSize)
+			if got := strings.Contains(string(args), limit); got != (test.maxSize > 0) {
+				t.Errorf("got arguments %q, want %q only with a limit", args, limit)
+			}
+		})
+	}
+}
+
+func TestYtDlpPrivateAddress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tube-ytdlp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	importer := &YtDlpImporter{Binary: fakeYtDlp(t, dir, 100), Proxy: "http://proxy.example:3128"}
+	filename := filepath.Join(dir, "video.mp4")
+	err = importer.Download(context.Background(), VideoInfo{VideoURL: "http://169.254.169.254/latest/"}, filename)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Fatalf("got error %v, want ErrPrivateAddress", err)
+	}
+	if utils.FileExists(filepath.Join(dir, "args")) {
+		t.Fatal("yt-dlp run for a private address")
+	}
+
+	err = importer.Download(context.Background(), VideoInfo{VideoURL: "https://93.184.216.34/v"}, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "--proxy http://proxy.example:3128") {
+		t.Errorf("got arguments %q, want the proxy", args)
+	}
+}
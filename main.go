@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/prologic/tube/app"
 	log "github.com/sirupsen/logrus"
@@ -18,6 +19,7 @@ var (
 func init() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] [file]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options] migrate up|down [n]|status\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
@@ -45,6 +47,15 @@ func main() {
 	if err != nil && !os.IsNotExist(err) {
 		log.Fatal(err)
 	}
+	cfg.ReadEnv()
+
+	if flag.Arg(0) == "migrate" {
+		if err := migrate(cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	instance, err := app.NewApp(cfg)
 	if err != nil {
 		log.Fatal(err)
@@ -56,3 +67,57 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// migrate runs the `migrate` command against the configured database
+func migrate(cfg *app.Config, args []string) error {
+	if len(args) < 1 {
+		flag.Usage()
+		return fmt.Errorf("missing migrate command")
+	}
+
+	db, err := app.ConnectDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	migrator, err := app.NewMigrator(db, cfg.Database.Driver)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", n)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		n, err := migrator.Down(steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migration(s)\n", n)
+	case "status":
+		status, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, st := range status {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", st.Version, st.Name, applied)
+		}
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+	return nil
+}
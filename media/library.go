@@ -41,7 +41,7 @@ func (lib *Library) AddPath(p *Path) error {
 			return errors.New("media: duplicate library prefix")
 		}
 	}
-	if err := os.MkdirAll(p.Path, 07550); err != nil {
+	if err := os.MkdirAll(p.Path, 0755); err != nil {
 		return fmt.Errorf("error creating library path %s: %w", p.Path, err)
 	}
 	lib.Paths[p.Path] = p
@@ -55,11 +55,11 @@ func (lib *Library) Import(p *Path) error {
 		return err
 	}
 	for _, info := range files {
-		if strings.ContainsAny(info.Name(), "#") {
+		if info.IsDir() || strings.ContainsAny(info.Name(), "#") {
 			// ignore resized videos e.g: #240p.mp4
 			continue
 		}
-		err = lib.Add(path.Join(p.Path, info.Name()))
+		_, err = lib.Add(path.Join(p.Path, info.Name()))
 		if err != nil {
 			// Ignore files that can't be parsed
 			continue
@@ -68,51 +68,48 @@ func (lib *Library) Import(p *Path) error {
 	return nil
 }
 
-// Add adds a single video from a given file path.
-func (lib *Library) Add(fp string) error {
+// Add adds (or re-reads) a single video from a given file path.
+func (lib *Library) Add(fp string) (*Video, error) {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 	fp = filepath.ToSlash(fp)
 	d := path.Dir(fp)
 	p, ok := lib.Paths[d]
 	if !ok {
-		return errors.New("media: path not found")
+		return nil, errors.New("media: path not found")
 	}
 	n := path.Base(fp)
+	if !IsVideoFile(n) {
+		return nil, errors.New("media: not a video file")
+	}
 	v, err := ParseVideo(p, n)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	lib.Videos[v.ID] = v
 	log.Println("Added:", v.Path)
-	return nil
+	return v, nil
 }
 
-// Remove removes a single video from a given file path.
-func (lib *Library) Remove(fp string) {
+// Remove removes a single video from a given file path and returns it, or
+// nil if it wasn't in the library.
+func (lib *Library) Remove(fp string) *Video {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 	fp = filepath.ToSlash(fp)
 	d := path.Dir(fp)
 	p, ok := lib.Paths[d]
 	if !ok {
-		return
-	}
-	n := path.Base(fp)
-	// ID is name without extension
-	idx := strings.LastIndex(n, ".")
-	if idx == -1 {
-		idx = len(n)
-	}
-	id := n[:idx]
-	if len(p.Prefix) > 0 {
-		id = path.Join(p.Prefix, id)
+		return nil
 	}
+	id := p.VideoID(path.Base(fp))
 	v, ok := lib.Videos[id]
-	if ok {
-		delete(lib.Videos, id)
-		log.Println("Removed:", v.Path)
+	if !ok {
+		return nil
 	}
+	delete(lib.Videos, id)
+	log.Println("Removed:", v.Path)
+	return v
 }
 
 // Playlist returns a sorted Playlist of all videos.
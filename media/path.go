@@ -1,7 +1,25 @@
 package media
 
+import (
+	"path"
+	"strings"
+)
+
 // Path represents a media library path.
 type Path struct {
 	Path   string
 	Prefix string
 }
+
+// VideoID returns the ID of the video file name in p: the name without
+// extension, prepended with the prefix if there's one.
+func (p *Path) VideoID(name string) string {
+	idx := strings.LastIndex(name, ".")
+	if idx == -1 {
+		idx = len(name)
+	}
+	if len(p.Prefix) > 0 {
+		return path.Join(p.Prefix, name[:idx])
+	}
+	return name[:idx]
+}
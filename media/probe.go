@@ -0,0 +1,210 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prologic/tube/utils"
+)
+
+// ProbeInfo is the media information of a file, as read by ffprobe
+type ProbeInfo struct {
+	// Duration in seconds
+	Duration float64
+	// Width and Height of the picture as displayed, i.e. with Rotation
+	// applied
+	Width  int
+	Height int
+	// VideoCodec and AudioCodec are ffmpeg codec names, e.g. h264 and aac;
+	// empty if the file has no such stream
+	VideoCodec string
+	AudioCodec string
+	// VideoProfile and AudioProfile are the ffmpeg names of the codec
+	// profiles, e.g. High and LC, and VideoLevel the H.264 level times 10
+	VideoProfile string
+	AudioProfile string
+	VideoLevel   int
+	// Bitrate in bits/s, of all streams
+	Bitrate int64
+	// FrameRate in frames/s
+	FrameRate     float64
+	AudioChannels int
+	// Rotation in degrees clockwise (0, 90, 180 or 270) players must rotate
+	// the picture by
+	Rotation int
+}
+
+// ffprobeOutput is the part of ffprobe's JSON output we use
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Profile      string            `json:"profile"`
+		Level        int               `json:"level"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		Channels     int               `json:"channels"`
+		Duration     string            `json:"duration"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			SideDataType string  `json:"side_data_type"`
+			Rotation     float64 `json:"rotation"`
+		} `json:"side_data_list"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// Probe reads the media information of filename with ffprobe, which may
+// run for timeout seconds
+func Probe(timeout int, filename string) (*ProbeInfo, error) {
+	out, err := utils.RunCmdOutput(
+		timeout,
+		"ffprobe", "-v", "error",
+		"-print_format", "json",
+		"-show_format", "-show_streams",
+		"--", filename,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error probing %s: %w", filename, err)
+	}
+	return parseProbe(out)
+}
+
+func parseProbe(data []byte) (*ProbeInfo, error) {
+	out := &ffprobeOutput{}
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, fmt.Errorf("error decoding ffprobe output: %w", err)
+	}
+
+	info := &ProbeInfo{}
+	info.Duration, _ = strconv.ParseFloat(out.Format.Duration, 64)
+	info.Bitrate, _ = strconv.ParseInt(out.Format.BitRate, 10, 64)
+
+	for _, stream := range out.Streams {
+		switch stream.CodecType {
+		case "video":
+			// cover art is a video stream too
+			if info.VideoCodec != "" || stream.Disposition.AttachedPic == 1 {
+				continue
+			}
+			info.VideoCodec = stream.CodecName
+			// the stream's duration, if the container reports none
+			if info.Duration == 0 {
+				info.Duration, _ = strconv.ParseFloat(stream.Duration, 64)
+			}
+			info.VideoProfile = stream.Profile
+			info.VideoLevel = stream.Level
+			info.Width = stream.Width
+			info.Height = stream.Height
+			info.FrameRate = parseFrameRate(stream.AvgFrameRate)
+			if info.FrameRate == 0 {
+				info.FrameRate = parseFrameRate(stream.RFrameRate)
+			}
+
+			// older ffmpeg versions report a rotate tag, newer ones a
+			// display matrix rotated the other way
+			if rotate, ok := stream.Tags["rotate"]; ok {
+				degrees, _ := strconv.Atoi(rotate)
+				info.Rotation = normalizeRotation(degrees)
+			} else {
+				for _, sd := range stream.SideDataList {
+					if sd.SideDataType == "Display Matrix" {
+						info.Rotation = normalizeRotation(-int(sd.Rotation))
+					}
+				}
+			}
+		case "audio":
+			if info.AudioCodec != "" {
+				continue
+			}
+			info.AudioCodec = stream.CodecName
+			info.AudioProfile = stream.Profile
+			info.AudioChannels = stream.Channels
+		}
+	}
+	if info.VideoCodec == "" {
+		return nil, fmt.Errorf("no video stream found")
+	}
+
+	if info.Rotation == 90 || info.Rotation == 270 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+	return info, nil
+}
+
+// profile_idc of the H.264 profiles, by ffmpeg profile name
+var h264Profiles = map[string]int{
+	"Baseline":              66,
+	"Constrained Baseline":  66,
+	"Main":                  77,
+	"Extended":              88,
+	"High":                  100,
+	"High 10":               110,
+	"High 4:2:2":            122,
+	"High 4:4:4 Predictive": 244,
+}
+
+// object types of the AAC profiles, by ffmpeg profile name
+var aacProfiles = map[string]int{
+	"LC":       2,
+	"HE-AAC":   5,
+	"HE-AACv2": 29,
+}
+
+// Codecs returns the RFC 6381 codecs of the streams, e.g.
+// avc1.64001f,mp4a.40.2 as listed in HLS playlists. It is empty unless all
+// streams are H.264 or AAC with known profiles.
+func (i *ProbeInfo) Codecs() string {
+	profile, ok := h264Profiles[i.VideoProfile]
+	if i.VideoCodec != "h264" || !ok || i.VideoLevel <= 0 {
+		return ""
+	}
+	// the constraint flags encoders usually set for Constrained Baseline
+	constraints := 0
+	if i.VideoProfile == "Constrained Baseline" {
+		constraints = 0xe0
+	}
+	codecs := fmt.Sprintf("avc1.%02x%02x%02x", profile, constraints, i.VideoLevel)
+
+	if i.AudioCodec == "" {
+		return codecs
+	}
+	objectType, ok := aacProfiles[i.AudioProfile]
+	if i.AudioCodec != "aac" || !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s,mp4a.40.%d", codecs, objectType)
+}
+
+// parses a rational frame rate such as 30000/1001
+func parseFrameRate(rate string) float64 {
+	parts := strings.SplitN(rate, "/", 2)
+	num, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0
+	}
+	if len(parts) == 1 {
+		return num
+	}
+	den, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+// returns degrees as one of 0, 90, 180 or 270
+func normalizeRotation(degrees int) int {
+	degrees = ((degrees % 360) + 360) % 360
+	return (degrees + 45) / 90 * 90 % 360
+}
@@ -0,0 +1,90 @@
+package media
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseProbe(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    ProbeInfo
+		err     bool
+	}{
+		{"landscape.json", ProbeInfo{
+			Duration: 12.352, Width: 1920, Height: 1080,
+			VideoCodec: "h264", AudioCodec: "aac", VideoProfile: "High", AudioProfile: "LC", VideoLevel: 40,
+			Bitrate: 4000000, FrameRate: 30000.0 / 1001, AudioChannels: 2,
+		}, false},
+		// the picture is shown rotated, taller than wide
+		{"rotate_tag.json", ProbeInfo{
+			Duration: 5, Width: 720, Height: 1280,
+			VideoCodec: "h264", VideoProfile: "Baseline", VideoLevel: 31,
+			Bitrate: 1500000, FrameRate: 30, Rotation: 90,
+		}, false},
+		{"display_matrix.json", ProbeInfo{
+			Duration: 3.5, Width: 1080, Height: 1920,
+			VideoCodec: "hevc", AudioCodec: "aac", VideoProfile: "Main", AudioProfile: "HE-AAC", VideoLevel: 123,
+			Bitrate: 20000000, FrameRate: 60, AudioChannels: 1, Rotation: 90,
+		}, false},
+		{"cover_art.json", ProbeInfo{
+			Duration: 60, Width: 640, Height: 360,
+			VideoCodec: "vp9", AudioCodec: "opus", VideoProfile: "Profile 0", VideoLevel: -99,
+			Bitrate: 500000, FrameRate: 25, AudioChannels: 2,
+		}, false},
+		{"stream_duration.json", ProbeInfo{
+			Duration: 8, Width: 720, Height: 576,
+			VideoCodec: "h264", VideoProfile: "Main", VideoLevel: 30, FrameRate: 25,
+		}, false},
+		// the duration is unknown rather than an error
+		{"no_duration.json", ProbeInfo{
+			Width: 1280, Height: 720,
+			VideoCodec: "h264", VideoProfile: "High", VideoLevel: 31, FrameRate: 25,
+		}, false},
+		{"no_video.json", ProbeInfo{}, true},
+	}
+	for _, test := range tests {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", test.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := parseProbe(data)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: got %+v, want an error", test.fixture, info)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.fixture, err)
+			continue
+		}
+		if *info != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.fixture, *info, test.want)
+		}
+	}
+
+	if _, err := parseProbe([]byte("not json")); err == nil {
+		t.Error("parsed output that isn't JSON")
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	tests := []struct {
+		info ProbeInfo
+		want string
+	}{
+		{ProbeInfo{VideoCodec: "h264", VideoProfile: "High", VideoLevel: 31, AudioCodec: "aac", AudioProfile: "LC"}, "avc1.64001f,mp4a.40.2"},
+		{ProbeInfo{VideoCodec: "h264", VideoProfile: "Main", VideoLevel: 40, AudioCodec: "aac", AudioProfile: "HE-AAC"}, "avc1.4d0028,mp4a.40.5"},
+		{ProbeInfo{VideoCodec: "h264", VideoProfile: "Constrained Baseline", VideoLevel: 30}, "avc1.42e01e"},
+		{ProbeInfo{VideoCodec: "h264", VideoProfile: "High", VideoLevel: -99}, ""},
+		{ProbeInfo{VideoCodec: "hevc", VideoProfile: "Main", VideoLevel: 120}, ""},
+		{ProbeInfo{VideoCodec: "h264", VideoProfile: "High", VideoLevel: 31, AudioCodec: "opus"}, ""},
+	}
+	for _, test := range tests {
+		if got := test.info.Codecs(); got != test.want {
+			t.Errorf("Codecs() of %+v = %q, want %q", test.info, got, test.want)
+		}
+	}
+}
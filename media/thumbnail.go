@@ -0,0 +1,93 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	// decoders of the pictures that can be scored
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// width pictures are sampled down to before scoring, so large frames
+	// don't cost more and sharpness is comparable between sizes
+	scoreWidth = 320
+	// mean luminance below or above which a picture is taken as mostly
+	// black or white, e.g. a fade or a title card
+	minBrightness = 40
+	maxBrightness = 215
+)
+
+// ThumbnailTimes returns the n timestamps, in seconds, to take thumbnail
+// candidates of a video of duration at: spread evenly, leaving out the
+// start and the end which often are black or credits
+func ThumbnailTimes(duration float64, n int) []float64 {
+	if duration <= 0 || n <= 1 {
+		return []float64{duration / 2}
+	}
+	times := make([]float64, n)
+	for i := range times {
+		times[i] = duration * float64(i+1) / float64(n+1)
+	}
+	return times
+}
+
+// ScoreThumbnail rates how good a picture is as a thumbnail, higher being
+// better. The score is the picture's sharpness, the variance of its
+// Laplacian, reduced for pictures that are mostly black or white.
+func ScoreThumbnail(r io.Reader) (float64, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding picture: %w", err)
+	}
+	return scoreImage(img), nil
+}
+
+func scoreImage(img image.Image) float64 {
+	bounds := img.Bounds()
+	step := bounds.Dx() / scoreWidth
+	if step < 1 {
+		step = 1
+	}
+	width := bounds.Dx() / step
+	height := bounds.Dy() / step
+	if width < 3 || height < 3 {
+		return 0
+	}
+
+	// luminance of the sampled pixels, 0-255
+	luma := make([]float64, width*height)
+	var sum float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x*step, bounds.Min.Y+y*step).RGBA()
+			l := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+			luma[y*width+x] = l
+			sum += l
+		}
+	}
+	mean := sum / float64(len(luma))
+
+	// variance of the 4-neighbour Laplacian
+	var lsum, lsq float64
+	n := 0
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*width + x
+			lap := luma[i-width] + luma[i+width] + luma[i-1] + luma[i+1] - 4*luma[i]
+			lsum += lap
+			lsq += lap * lap
+			n++
+		}
+	}
+	lmean := lsum / float64(n)
+	score := lsq/float64(n) - lmean*lmean
+
+	if mean < minBrightness || mean > maxBrightness {
+		score *= 0.1
+	}
+	return score
+}
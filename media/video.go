@@ -29,6 +29,22 @@ type Video struct {
 	Views int64
 }
 
+// videoExtensions are the extensions of files ParseVideo can read
+var videoExtensions = map[string]bool{
+	".mp4": true,
+	".m4v": true,
+	".mov": true,
+}
+
+// IsVideoFile reports whether name looks like a video file the library
+// can import. Hidden files (e.g. ._name.mp4 written by macOS) are skipped.
+func IsVideoFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	return videoExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
 // ParseVideo parses a video file's metadata and returns a Video.
 func ParseVideo(p *Path, name string) (*Video, error) {
 	pth := path.Join(p.Path, name)
@@ -44,16 +60,7 @@ func ParseVideo(p *Path, name string) (*Video, error) {
 	size := info.Size()
 	timestamp := info.ModTime()
 	modified := timestamp.Format("2006-01-02 03:04 PM")
-	// ID is name without extension
-	idx := strings.LastIndex(name, ".")
-	if idx == -1 {
-		idx = len(name)
-	}
-	id := name[:idx]
-	if len(p.Prefix) > 0 {
-		// if there's a prefix prepend it to the ID
-		id = path.Join(p.Prefix, name[:idx])
-	}
+	id := p.VideoID(name)
 	m, err := tag.ReadFrom(f)
 	if err != nil {
 		return nil, err
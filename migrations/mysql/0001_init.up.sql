@@ -0,0 +1,98 @@
+-- Initial schema. Tables are only created when missing so databases set up
+-- from the old db.sql can adopt migrations without losing data; the
+-- migrator brings their existing tables up to this schema first.
+
+CREATE TABLE IF NOT EXISTS `users` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `name` varchar(50) NOT NULL,
+    `email` varchar(50) NOT NULL,
+    `password` varchar(255) NOT NULL,
+    `is_admin` boolean NOT NULL DEFAULT 0,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    UNIQUE KEY `idx_users_email` (`email`),
+    KEY `idx_users_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `categories` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `title` varchar(255) NOT NULL,
+    UNIQUE KEY `idx_categories_title` (`title`)
+);
+
+CREATE TABLE IF NOT EXISTS `videos` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `user_id` int NOT NULL,
+    `title` varchar(255) NOT NULL,
+    `description` text NOT NULL,
+    `duration` int NOT NULL DEFAULT 0,
+    `views` int NOT NULL DEFAULT 0,
+    `likes` int NOT NULL DEFAULT 0,
+    `dislikes` int NOT NULL DEFAULT 0,
+    `url` varchar(511) NOT NULL,
+    `thumbnail_url` varchar(511) NOT NULL DEFAULT '',
+    `hls` boolean NOT NULL DEFAULT 0,
+    `hls_path` varchar(511) NOT NULL DEFAULT '',
+    `status` varchar(20) NOT NULL DEFAULT 'ready',
+    `status_error` text NOT NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    KEY `idx_videos_deleted_at` (`deleted_at`),
+    CONSTRAINT `fk_videos_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `renditions` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `video_id` int NOT NULL,
+    `quality` varchar(20) NOT NULL,
+    `size` varchar(20) NOT NULL,
+    `url` varchar(511) NOT NULL,
+    CONSTRAINT `fk_rend_video_id` FOREIGN KEY (`video_id`) REFERENCES `videos` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `likes` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `uid` int NOT NULL,
+    `v_id` int NOT NULL,
+    `is_dislike` boolean NOT NULL DEFAULT 0,
+    CONSTRAINT `fk_video_id` FOREIGN KEY (`v_id`) REFERENCES `videos` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `comments` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `video_id` int NOT NULL,
+    `user_id` int NOT NULL,
+    `reply_to` int NULL,
+    `text` text NOT NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    KEY `idx_comments_deleted_at` (`deleted_at`),
+    CONSTRAINT `fk_comm_video_id` FOREIGN KEY (`video_id`) REFERENCES `videos` (`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_comm_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_comm_repl_comm` FOREIGN KEY (`reply_to`) REFERENCES `comments` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `video_categories` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `v_id` int NOT NULL,
+    `c_id` int NOT NULL,
+    CONSTRAINT `fk_video_categories_video_id` FOREIGN KEY (`v_id`) REFERENCES `videos` (`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_video_categories_categ_id` FOREIGN KEY (`c_id`) REFERENCES `categories` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `jobs` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `type` varchar(50) NOT NULL,
+    `payload` text NOT NULL,
+    `state` varchar(20) NOT NULL DEFAULT 'queued',
+    `attempts` int NOT NULL DEFAULT 0,
+    `max_attempts` int NOT NULL DEFAULT 3,
+    `last_error` text NOT NULL,
+    `run_at` datetime(3) NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    KEY `idx_jobs_state` (`state`)
+);
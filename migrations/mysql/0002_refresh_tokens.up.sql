@@ -0,0 +1,11 @@
+CREATE TABLE `refresh_tokens` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `user_id` int NOT NULL,
+    `token_hash` varchar(64) NOT NULL,
+    `expires_at` datetime(3) NOT NULL,
+    `revoked_at` datetime(3) NULL,
+    `created_at` datetime(3) NULL,
+    UNIQUE KEY `idx_refresh_tokens_token_hash` (`token_hash`),
+    KEY `idx_refresh_tokens_user_id` (`user_id`),
+    CONSTRAINT `fk_refresh_tokens_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
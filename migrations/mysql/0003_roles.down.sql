@@ -0,0 +1,3 @@
+ALTER TABLE `users` ADD COLUMN `is_admin` boolean NOT NULL DEFAULT 0;
+UPDATE `users` SET `is_admin` = 1 WHERE `role` = 'admin';
+ALTER TABLE `users` DROP COLUMN `role`;
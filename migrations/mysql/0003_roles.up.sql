@@ -0,0 +1,3 @@
+ALTER TABLE `users` ADD COLUMN `role` varchar(32) NOT NULL DEFAULT 'uploader';
+UPDATE `users` SET `role` = 'admin' WHERE `is_admin` = 1;
+ALTER TABLE `users` DROP COLUMN `is_admin`;
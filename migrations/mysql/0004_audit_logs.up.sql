@@ -0,0 +1,11 @@
+CREATE TABLE `audit_logs` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `actor_id` int NOT NULL,
+    `action` varchar(50) NOT NULL,
+    `target_type` varchar(50) NOT NULL,
+    `target_id` int NOT NULL,
+    `detail` text NOT NULL,
+    `created_at` datetime(3) NULL,
+    KEY `idx_audit_logs_actor_id` (`actor_id`),
+    KEY `idx_audit_logs_target` (`target_type`, `target_id`)
+);
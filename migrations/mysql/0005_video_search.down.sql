@@ -0,0 +1 @@
+ALTER TABLE `videos` DROP INDEX `idx_videos_search`;
@@ -0,0 +1 @@
+ALTER TABLE `videos` ADD FULLTEXT INDEX `idx_videos_search` (`title`, `description`);
@@ -0,0 +1,5 @@
+ALTER TABLE `videos`
+    DROP KEY `idx_videos_source_path`,
+    DROP COLUMN `source_path`,
+    DROP COLUMN `source_size`,
+    DROP COLUMN `source_mod_time`;
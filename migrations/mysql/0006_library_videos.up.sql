@@ -0,0 +1,5 @@
+ALTER TABLE `videos`
+    ADD COLUMN `source_path` varchar(511) NOT NULL DEFAULT '',
+    ADD COLUMN `source_size` bigint NOT NULL DEFAULT 0,
+    ADD COLUMN `source_mod_time` datetime(3) NULL,
+    ADD KEY `idx_videos_source_path` (`source_path`);
@@ -0,0 +1,4 @@
+ALTER TABLE `jobs`
+    DROP KEY `idx_jobs_video_id`,
+    DROP COLUMN `video_id`,
+    DROP COLUMN `progress`;
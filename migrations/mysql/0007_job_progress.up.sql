@@ -0,0 +1,4 @@
+ALTER TABLE `jobs`
+    ADD COLUMN `video_id` int NOT NULL DEFAULT 0,
+    ADD COLUMN `progress` int NOT NULL DEFAULT 0,
+    ADD KEY `idx_jobs_video_id` (`video_id`);
@@ -0,0 +1,13 @@
+CREATE TABLE `uploads` (
+    `id` varchar(32) NOT NULL PRIMARY KEY,
+    `user_id` int NOT NULL,
+    `length` bigint NOT NULL,
+    `offset` bigint NOT NULL DEFAULT 0,
+    `metadata` text NOT NULL,
+    `video_id` int NOT NULL DEFAULT 0,
+    `expires_at` datetime(3) NOT NULL,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    KEY `idx_uploads_user_id` (`user_id`),
+    KEY `idx_uploads_expires_at` (`expires_at`)
+);
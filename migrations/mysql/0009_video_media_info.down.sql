@@ -0,0 +1,9 @@
+ALTER TABLE `videos`
+    DROP COLUMN `width`,
+    DROP COLUMN `height`,
+    DROP COLUMN `video_codec`,
+    DROP COLUMN `audio_codec`,
+    DROP COLUMN `bitrate`,
+    DROP COLUMN `frame_rate`,
+    DROP COLUMN `audio_channels`,
+    DROP COLUMN `rotation`;
@@ -0,0 +1,9 @@
+ALTER TABLE `videos`
+    ADD COLUMN `width` int NOT NULL DEFAULT 0,
+    ADD COLUMN `height` int NOT NULL DEFAULT 0,
+    ADD COLUMN `video_codec` varchar(50) NOT NULL DEFAULT '',
+    ADD COLUMN `audio_codec` varchar(50) NOT NULL DEFAULT '',
+    ADD COLUMN `bitrate` bigint NOT NULL DEFAULT 0,
+    ADD COLUMN `frame_rate` double NOT NULL DEFAULT 0,
+    ADD COLUMN `audio_channels` int NOT NULL DEFAULT 0,
+    ADD COLUMN `rotation` int NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE `videos`
+    ADD COLUMN `thumbnail_candidates` int NOT NULL DEFAULT 0;
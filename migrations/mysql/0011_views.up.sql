@@ -0,0 +1,11 @@
+CREATE TABLE `view_counts` (
+    `video_id` int NOT NULL PRIMARY KEY,
+    `views` bigint NOT NULL DEFAULT 0
+);
+CREATE TABLE `view_records` (
+    `viewer` varchar(64) NOT NULL,
+    `video_id` int NOT NULL,
+    `viewed_at` datetime(3) NOT NULL,
+    PRIMARY KEY (`viewer`, `video_id`),
+    KEY `idx_view_records_viewed_at` (`viewed_at`)
+);
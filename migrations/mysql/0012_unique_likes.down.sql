@@ -0,0 +1 @@
+ALTER TABLE `likes` DROP INDEX `idx_likes_uid_v_id`;
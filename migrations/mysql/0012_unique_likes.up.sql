@@ -0,0 +1,4 @@
+-- keep the first reaction of users who reacted more than once
+DELETE `l1` FROM `likes` `l1`
+    JOIN `likes` `l2` ON `l1`.`uid` = `l2`.`uid` AND `l1`.`v_id` = `l2`.`v_id` AND `l1`.`id` > `l2`.`id`;
+ALTER TABLE `likes` ADD UNIQUE KEY `idx_likes_uid_v_id` (`uid`, `v_id`);
@@ -0,0 +1,4 @@
+ALTER TABLE `comments`
+    DROP INDEX `idx_comments_video_id_reply_to`,
+    DROP COLUMN `reply_count`,
+    DROP COLUMN `edited_at`;
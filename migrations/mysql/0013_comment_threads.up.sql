@@ -0,0 +1,14 @@
+ALTER TABLE `comments`
+    ADD COLUMN `reply_count` int NOT NULL DEFAULT 0,
+    ADD COLUMN `edited_at` datetime(3) NULL,
+    ADD KEY `idx_comments_video_id_reply_to` (`video_id`, `reply_to`);
+-- count the replies that are listed, deleted ones only while they have
+-- replies themselves
+UPDATE `comments` `c`
+    JOIN (
+        SELECT `r`.`reply_to`, COUNT(*) AS `n` FROM `comments` `r`
+        WHERE `r`.`reply_to` IS NOT NULL AND (`r`.`deleted_at` IS NULL OR EXISTS
+            (SELECT 1 FROM `comments` `rr` WHERE `rr`.`reply_to` = `r`.`id`))
+        GROUP BY `r`.`reply_to`
+    ) `counts` ON `counts`.`reply_to` = `c`.`id`
+    SET `c`.`reply_count` = `counts`.`n`;
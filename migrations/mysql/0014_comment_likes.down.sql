@@ -0,0 +1,6 @@
+ALTER TABLE `comments`
+    DROP COLUMN `like_count`,
+    DROP COLUMN `score`,
+    DROP COLUMN `hearted`,
+    DROP COLUMN `pinned`;
+DROP TABLE IF EXISTS `comment_likes`;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `comment_likes` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `comment_id` int NOT NULL,
+    `user_id` int NOT NULL,
+    `created_at` datetime(3) NULL,
+    UNIQUE KEY `idx_comment_likes_comment_id_user_id` (`comment_id`, `user_id`),
+    CONSTRAINT `fk_comment_likes_comment_id` FOREIGN KEY (`comment_id`) REFERENCES `comments` (`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_comment_likes_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+ALTER TABLE `comments`
+    ADD COLUMN `like_count` int NOT NULL DEFAULT 0,
+    ADD COLUMN `score` int NOT NULL DEFAULT 0,
+    ADD COLUMN `hearted` boolean NOT NULL DEFAULT 0,
+    ADD COLUMN `pinned` boolean NOT NULL DEFAULT 0;
+UPDATE `comments` SET `score` = `reply_count`;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `subscriptions` (
+    `id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    `user_id` int NOT NULL,
+    `channel_id` int NOT NULL,
+    `created_at` datetime(3) NULL,
+    UNIQUE KEY `idx_subscriptions_user_id_channel_id` (`user_id`, `channel_id`),
+    KEY `idx_subscriptions_channel_id` (`channel_id`),
+    CONSTRAINT `fk_subscriptions_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE,
+    CONSTRAINT `fk_subscriptions_channel_id` FOREIGN KEY (`channel_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE `comments`
+    DROP KEY `idx_comments_pinned_video_id`,
+    DROP COLUMN `pinned_video_id`;
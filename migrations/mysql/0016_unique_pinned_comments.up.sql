@@ -0,0 +1,14 @@
+-- keep one pinned comment per video, the newest
+UPDATE `comments` `c`
+    JOIN (
+        SELECT `video_id`, MAX(`id`) AS `id` FROM `comments`
+        WHERE `pinned` GROUP BY `video_id`
+    ) `kept` ON `kept`.`video_id` = `c`.`video_id`
+    SET `c`.`pinned` = 0
+    WHERE `c`.`pinned` AND `c`.`id` <> `kept`.`id`;
+-- MySQL has no partial indexes: the column is NULL, which isn't unique,
+-- unless the comment is pinned. It is virtual, a stored one couldn't be
+-- based on video_id and its cascading foreign key.
+ALTER TABLE `comments`
+    ADD COLUMN `pinned_video_id` int AS (IF(`pinned`, `video_id`, NULL)) VIRTUAL,
+    ADD UNIQUE KEY `idx_comments_pinned_video_id` (`pinned_video_id`);
@@ -0,0 +1 @@
+ALTER TABLE `comments` DROP INDEX `idx_comments_search`;
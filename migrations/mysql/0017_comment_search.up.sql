@@ -0,0 +1 @@
+ALTER TABLE `comments` ADD FULLTEXT INDEX `idx_comments_search` (`text`);
@@ -0,0 +1,4 @@
+ALTER TABLE `videos`
+    ADD COLUMN `size` bigint NOT NULL DEFAULT 0;
+-- library videos are the files themselves
+UPDATE `videos` SET `size` = `source_size` WHERE `source_path` <> '';
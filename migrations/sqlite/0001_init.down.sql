@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS video_categories;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS renditions;
+DROP TABLE IF EXISTS videos;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
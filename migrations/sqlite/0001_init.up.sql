@@ -0,0 +1,88 @@
+-- Initial schema.
+
+CREATE TABLE IF NOT EXISTS users (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    name varchar(50) NOT NULL,
+    email varchar(50) NOT NULL,
+    password varchar(255) NOT NULL,
+    is_admin boolean NOT NULL DEFAULT 0,
+    created_at datetime NULL,
+    updated_at datetime NULL,
+    deleted_at datetime NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    title varchar(255) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_title ON categories (title);
+
+CREATE TABLE IF NOT EXISTS videos (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title varchar(255) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    duration integer NOT NULL DEFAULT 0,
+    views integer NOT NULL DEFAULT 0,
+    likes integer NOT NULL DEFAULT 0,
+    dislikes integer NOT NULL DEFAULT 0,
+    url varchar(511) NOT NULL,
+    thumbnail_url varchar(511) NOT NULL DEFAULT '',
+    hls boolean NOT NULL DEFAULT 0,
+    hls_path varchar(511) NOT NULL DEFAULT '',
+    status varchar(20) NOT NULL DEFAULT 'ready',
+    status_error text NOT NULL DEFAULT '',
+    created_at datetime NULL,
+    updated_at datetime NULL,
+    deleted_at datetime NULL
+);
+CREATE INDEX IF NOT EXISTS idx_videos_deleted_at ON videos (deleted_at);
+
+CREATE TABLE IF NOT EXISTS renditions (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    video_id integer NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    quality varchar(20) NOT NULL,
+    size varchar(20) NOT NULL,
+    url varchar(511) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS likes (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    uid integer NOT NULL,
+    v_id integer NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    is_dislike boolean NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    video_id integer NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    reply_to integer NULL REFERENCES comments (id) ON DELETE CASCADE,
+    text text NOT NULL,
+    created_at datetime NULL,
+    updated_at datetime NULL,
+    deleted_at datetime NULL
+);
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments (deleted_at);
+
+CREATE TABLE IF NOT EXISTS video_categories (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    v_id integer NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    c_id integer NOT NULL REFERENCES categories (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    type varchar(50) NOT NULL,
+    payload text NOT NULL DEFAULT '',
+    state varchar(20) NOT NULL DEFAULT 'queued',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL DEFAULT 3,
+    last_error text NOT NULL DEFAULT '',
+    run_at datetime NULL,
+    created_at datetime NULL,
+    updated_at datetime NULL
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs (state);
@@ -0,0 +1,19 @@
+UPDATE users SET is_admin = (role = 'admin');
+-- SQLite before 3.35 can't drop columns, so the table is rebuilt without
+-- role.
+CREATE TABLE users_new (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    name varchar(50) NOT NULL,
+    email varchar(50) NOT NULL,
+    password varchar(255) NOT NULL,
+    is_admin boolean NOT NULL DEFAULT 0,
+    created_at datetime NULL,
+    updated_at datetime NULL,
+    deleted_at datetime NULL
+);
+INSERT INTO users_new (id, name, email, password, is_admin, created_at, updated_at, deleted_at)
+    SELECT id, name, email, password, is_admin, created_at, updated_at, deleted_at FROM users;
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
@@ -0,0 +1,3 @@
+-- is_admin is left in place unused, SQLite before 3.35 can't drop columns.
+ALTER TABLE users ADD COLUMN role varchar(32) NOT NULL DEFAULT 'uploader';
+UPDATE users SET role = 'admin' WHERE is_admin = 1;
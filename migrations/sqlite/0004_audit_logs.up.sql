@@ -0,0 +1,11 @@
+CREATE TABLE audit_logs (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    actor_id integer NOT NULL,
+    action varchar(50) NOT NULL,
+    target_type varchar(50) NOT NULL,
+    target_id integer NOT NULL,
+    detail text NOT NULL,
+    created_at datetime NULL
+);
+CREATE INDEX idx_audit_logs_actor_id ON audit_logs (actor_id);
+CREATE INDEX idx_audit_logs_target ON audit_logs (target_type, target_id);
@@ -0,0 +1,26 @@
+-- SQLite before 3.35 can't drop columns, so the table is rebuilt without
+-- them.
+CREATE TABLE videos_new (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title varchar(255) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    duration integer NOT NULL DEFAULT 0,
+    views integer NOT NULL DEFAULT 0,
+    likes integer NOT NULL DEFAULT 0,
+    dislikes integer NOT NULL DEFAULT 0,
+    url varchar(511) NOT NULL,
+    thumbnail_url varchar(511) NOT NULL DEFAULT '',
+    hls boolean NOT NULL DEFAULT 0,
+    hls_path varchar(511) NOT NULL DEFAULT '',
+    status varchar(20) NOT NULL DEFAULT 'ready',
+    status_error text NOT NULL DEFAULT '',
+    created_at datetime NULL,
+    updated_at datetime NULL,
+    deleted_at datetime NULL
+);
+INSERT INTO videos_new (id, user_id, title, description, duration, views, likes, dislikes, url, thumbnail_url, hls, hls_path, status, status_error, created_at, updated_at, deleted_at)
+    SELECT id, user_id, title, description, duration, views, likes, dislikes, url, thumbnail_url, hls, hls_path, status, status_error, created_at, updated_at, deleted_at FROM videos;
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+CREATE INDEX idx_videos_deleted_at ON videos (deleted_at);
@@ -0,0 +1,4 @@
+ALTER TABLE videos ADD COLUMN source_path varchar(511) NOT NULL DEFAULT '';
+ALTER TABLE videos ADD COLUMN source_size bigint NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN source_mod_time datetime NULL;
+CREATE INDEX idx_videos_source_path ON videos (source_path);
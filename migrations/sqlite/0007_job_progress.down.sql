@@ -0,0 +1,19 @@
+-- SQLite before 3.35 can't drop columns, so the table is rebuilt without
+-- them.
+CREATE TABLE jobs_new (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    type varchar(50) NOT NULL,
+    payload text NOT NULL DEFAULT '',
+    state varchar(20) NOT NULL DEFAULT 'queued',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL DEFAULT 3,
+    last_error text NOT NULL DEFAULT '',
+    run_at datetime NULL,
+    created_at datetime NULL,
+    updated_at datetime NULL
+);
+INSERT INTO jobs_new (id, type, payload, state, attempts, max_attempts, last_error, run_at, created_at, updated_at)
+    SELECT id, type, payload, state, attempts, max_attempts, last_error, run_at, created_at, updated_at FROM jobs;
+DROP TABLE jobs;
+ALTER TABLE jobs_new RENAME TO jobs;
+CREATE INDEX idx_jobs_state ON jobs (state);
@@ -0,0 +1,3 @@
+ALTER TABLE jobs ADD COLUMN video_id integer NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN progress integer NOT NULL DEFAULT 0;
+CREATE INDEX idx_jobs_video_id ON jobs (video_id);
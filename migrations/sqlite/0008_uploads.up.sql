@@ -0,0 +1,13 @@
+CREATE TABLE uploads (
+    id varchar(32) NOT NULL PRIMARY KEY,
+    user_id integer NOT NULL,
+    length bigint NOT NULL,
+    "offset" bigint NOT NULL DEFAULT 0,
+    metadata text NOT NULL,
+    video_id integer NOT NULL DEFAULT 0,
+    expires_at datetime NOT NULL,
+    created_at datetime NULL,
+    updated_at datetime NULL
+);
+CREATE INDEX idx_uploads_user_id ON uploads (user_id);
+CREATE INDEX idx_uploads_expires_at ON uploads (expires_at);
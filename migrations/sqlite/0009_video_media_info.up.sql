@@ -0,0 +1,8 @@
+ALTER TABLE videos ADD COLUMN width integer NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN height integer NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN video_codec varchar(50) NOT NULL DEFAULT '';
+ALTER TABLE videos ADD COLUMN audio_codec varchar(50) NOT NULL DEFAULT '';
+ALTER TABLE videos ADD COLUMN bitrate bigint NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN frame_rate real NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN audio_channels integer NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN rotation integer NOT NULL DEFAULT 0;
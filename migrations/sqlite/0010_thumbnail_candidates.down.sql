@@ -0,0 +1,38 @@
+-- SQLite before 3.35 can't drop columns, so the table is rebuilt without
+-- them.
+CREATE TABLE videos_new (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title varchar(255) NOT NULL,
+    description text NOT NULL DEFAULT '',
+    duration integer NOT NULL DEFAULT 0,
+    views integer NOT NULL DEFAULT 0,
+    likes integer NOT NULL DEFAULT 0,
+    dislikes integer NOT NULL DEFAULT 0,
+    url varchar(511) NOT NULL,
+    thumbnail_url varchar(511) NOT NULL DEFAULT '',
+    hls boolean NOT NULL DEFAULT 0,
+    hls_path varchar(511) NOT NULL DEFAULT '',
+    status varchar(20) NOT NULL DEFAULT 'ready',
+    status_error text NOT NULL DEFAULT '',
+    created_at datetime NULL,
+    updated_at datetime NULL,
+    deleted_at datetime NULL,
+    source_path varchar(511) NOT NULL DEFAULT '',
+    source_size bigint NOT NULL DEFAULT 0,
+    source_mod_time datetime NULL,
+    width integer NOT NULL DEFAULT 0,
+    height integer NOT NULL DEFAULT 0,
+    video_codec varchar(50) NOT NULL DEFAULT '',
+    audio_codec varchar(50) NOT NULL DEFAULT '',
+    bitrate bigint NOT NULL DEFAULT 0,
+    frame_rate real NOT NULL DEFAULT 0,
+    audio_channels integer NOT NULL DEFAULT 0,
+    rotation integer NOT NULL DEFAULT 0
+);
+INSERT INTO videos_new (id, user_id, title, description, duration, views, likes, dislikes, url, thumbnail_url, hls, hls_path, status, status_error, created_at, updated_at, deleted_at, source_path, source_size, source_mod_time, width, height, video_codec, audio_codec, bitrate, frame_rate, audio_channels, rotation)
+    SELECT id, user_id, title, description, duration, views, likes, dislikes, url, thumbnail_url, hls, hls_path, status, status_error, created_at, updated_at, deleted_at, source_path, source_size, source_mod_time, width, height, video_codec, audio_codec, bitrate, frame_rate, audio_channels, rotation FROM videos;
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+CREATE INDEX idx_videos_deleted_at ON videos (deleted_at);
+CREATE INDEX idx_videos_source_path ON videos (source_path);
@@ -0,0 +1 @@
+ALTER TABLE videos ADD COLUMN thumbnail_candidates integer NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS view_records;
+DROP TABLE IF EXISTS view_counts;
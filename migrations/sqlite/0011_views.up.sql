@@ -0,0 +1,11 @@
+CREATE TABLE view_counts (
+    video_id integer NOT NULL PRIMARY KEY,
+    views bigint NOT NULL DEFAULT 0
+);
+CREATE TABLE view_records (
+    viewer varchar(64) NOT NULL,
+    video_id integer NOT NULL,
+    viewed_at datetime NOT NULL,
+    PRIMARY KEY (viewer, video_id)
+);
+CREATE INDEX idx_view_records_viewed_at ON view_records (viewed_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_likes_uid_v_id;
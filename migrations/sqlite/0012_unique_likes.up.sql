@@ -0,0 +1,3 @@
+-- keep the first reaction of users who reacted more than once
+DELETE FROM likes WHERE id NOT IN (SELECT MIN(id) FROM likes GROUP BY uid, v_id);
+CREATE UNIQUE INDEX idx_likes_uid_v_id ON likes (uid, v_id);
@@ -0,0 +1,17 @@
+-- SQLite before 3.35 can't drop columns, so the table is rebuilt without
+-- them.
+CREATE TABLE comments_new (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    video_id integer NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    reply_to integer NULL REFERENCES comments (id) ON DELETE CASCADE,
+    text text NOT NULL,
+    created_at datetime NULL,
+    updated_at datetime NULL,
+    deleted_at datetime NULL
+);
+INSERT INTO comments_new (id, video_id, user_id, reply_to, text, created_at, updated_at, deleted_at)
+    SELECT id, video_id, user_id, reply_to, text, created_at, updated_at, deleted_at FROM comments;
+DROP TABLE comments;
+ALTER TABLE comments_new RENAME TO comments;
+CREATE INDEX idx_comments_deleted_at ON comments (deleted_at);
@@ -0,0 +1,11 @@
+ALTER TABLE comments ADD COLUMN reply_count integer NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN edited_at datetime NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_video_id_reply_to ON comments (video_id, reply_to);
+CREATE INDEX IF NOT EXISTS idx_comments_reply_to ON comments (reply_to);
+-- count the replies that are listed, deleted ones only while they have
+-- replies themselves
+UPDATE comments SET reply_count = (
+    SELECT COUNT(*) FROM comments AS r
+    WHERE r.reply_to = comments.id AND (r.deleted_at IS NULL OR EXISTS
+        (SELECT 1 FROM comments AS rr WHERE rr.reply_to = r.id))
+);
@@ -0,0 +1,22 @@
+DROP TABLE IF EXISTS comment_likes;
+-- SQLite before 3.35 can't drop columns, so the table is rebuilt without
+-- them.
+CREATE TABLE comments_new (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    video_id integer NOT NULL REFERENCES videos (id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    reply_to integer NULL REFERENCES comments (id) ON DELETE CASCADE,
+    text text NOT NULL,
+    created_at datetime NULL,
+    updated_at datetime NULL,
+    deleted_at datetime NULL,
+    reply_count integer NOT NULL DEFAULT 0,
+    edited_at datetime NULL
+);
+INSERT INTO comments_new (id, video_id, user_id, reply_to, text, created_at, updated_at, deleted_at, reply_count, edited_at)
+    SELECT id, video_id, user_id, reply_to, text, created_at, updated_at, deleted_at, reply_count, edited_at FROM comments;
+DROP TABLE comments;
+ALTER TABLE comments_new RENAME TO comments;
+CREATE INDEX idx_comments_deleted_at ON comments (deleted_at);
+CREATE INDEX idx_comments_video_id_reply_to ON comments (video_id, reply_to);
+CREATE INDEX idx_comments_reply_to ON comments (reply_to);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS comment_likes (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    comment_id integer NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at datetime NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_comment_likes_comment_id_user_id ON comment_likes (comment_id, user_id);
+ALTER TABLE comments ADD COLUMN like_count integer NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN score integer NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN hearted boolean NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN pinned boolean NOT NULL DEFAULT 0;
+UPDATE comments SET score = reply_count;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    channel_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at datetime NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_user_id_channel_id ON subscriptions (user_id, channel_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_channel_id ON subscriptions (channel_id);
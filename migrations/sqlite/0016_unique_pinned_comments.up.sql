@@ -0,0 +1,4 @@
+-- keep one pinned comment per video, the newest
+UPDATE comments SET pinned = 0 WHERE pinned AND id NOT IN
+    (SELECT MAX(id) FROM comments WHERE pinned GROUP BY video_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_comments_pinned_video_id ON comments (video_id) WHERE pinned;
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"path"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -8,13 +10,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleViewer    = "viewer"
+	RoleUploader  = "uploader"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 // User model
 type User struct {
 	ID uint						`gorm:"primaryKey" json:"id"`
 	Name string 				`json:"name"`
 	Email string 				`json:"email" gorm:"unique_index"`
 	Password string 			`json:"password"`
-	IsAdmin bool				`gorm:"default:false" json:"isAdmin,string"`
+	Role string					`gorm:"default:uploader" json:"role"`
 
 	CreatedAt time.Time			`json:"createdAt"`
 	UpdatedAt time.Time			`json:"-"`
@@ -28,6 +38,17 @@ type UserStat struct {
 	NumVideos int				`json:"numVideos"`
 }
 
+// Video processing states
+const (
+	VideoPending      = "pending"
+	VideoDownloading  = "downloading"
+	VideoTranscoding  = "transcoding"
+	VideoPackaging    = "packaging"
+	VideoThumbnailing = "thumbnailing"
+	VideoReady        = "ready"
+	VideoFailed       = "failed"
+)
+
 // Video model
 type Video struct {
 	ID uint						`gorm:"primaryKey" json:"id"`
@@ -37,12 +58,40 @@ type Video struct {
 	Title string				`json:"title"`
 	Description string			`json:"description"`
 	Duration int				`json:"duration"`
+	// media information of the video file; Width and Height are the size
+	// of the picture as displayed
+	Width int					`json:"width"`
+	Height int					`json:"height"`
+	VideoCodec string			`json:"videoCodec"`
+	AudioCodec string			`json:"audioCodec"`
+	Bitrate int64				`json:"bitrate"`
+	FrameRate float64			`json:"frameRate"`
+	AudioChannels int			`json:"audioChannels"`
+	Rotation int				`json:"rotation"`
 	Views int					`json:"views"`
 	Likes int					`json:"likes"`
 	Dislikes int				`json:"dislikes"`
+	// storage keys of the video and its thumbnail; the video of a library
+	// file is the file itself
 	URL string					`json:"url"`
-	ThumbnailURL string			`json:"thumbnail"`
+	// size in bytes of the video file, kept for feed enclosures
+	Size int64					`json:"size"`
+	ThumbnailURL string			`json:"-"`
+	// number of thumbnail candidates the owner can choose from
+	ThumbnailCandidates int		`json:"-"`
+	// site relative URLs of the thumbnail, and of its sizes if it has them
+	Thumbnail string			`gorm:"-" json:"thumbnail"`
+	Thumbnails *Thumbnails		`gorm:"-" json:"thumbnails,omitempty"`
+	HLS bool					`json:"hls"`
+	HLSPath string				`json:"-"`
+	Status string				`json:"status"`
+	StatusError string			`json:"statusError,omitempty"`
+	// set for videos imported from a library path
+	SourcePath string			`gorm:"index" json:"-"`
+	SourceSize int64			`json:"-"`
+	SourceModTime *time.Time	`json:"-"`
 
+	Renditions []Rendition		`gorm:"foreignKey:VideoID" json:"renditions"`
 	Categories []VideoCategory 	`gorm:"foreignKey:VID" json:"categories"`
 	// used only when editing video
 	CategoryIds []uint 			`gorm:"-" json:"categoryIds"`
@@ -52,6 +101,78 @@ type Video struct {
 	DeletedAt gorm.DeletedAt 	`gorm:"index" json:"-"`
 }
 
+// UploadsPath is the URL path stored media is served from
+const UploadsPath = "uploads/"
+
+// ThumbnailsPrefix is the storage key prefix of thumbnails stored in
+// several sizes. Each set of sizes is a directory whose medium JPEG is the
+// video's ThumbnailURL; thumbnails stored before have a single size.
+const ThumbnailsPrefix = "thumbnails/"
+
+// ThumbnailSizes are the names of the sizes thumbnails are stored in
+var ThumbnailSizes = []string{"small", "medium", "large"}
+
+// Thumbnails are the site relative URLs of a thumbnail's sizes, as JPEG
+// and WebP
+type Thumbnails struct {
+	Small string		`json:"small"`
+	Medium string		`json:"medium"`
+	Large string		`json:"large"`
+	SmallWebP string	`json:"smallWebp"`
+	MediumWebP string	`json:"mediumWebp"`
+	LargeWebP string	`json:"largeWebp"`
+}
+
+// ThumbnailKey returns the storage key of size ("small", "medium" or
+// "large") of a thumbnail stored in several sizes as dir, in format ext
+func ThumbnailKey(dir, size, ext string) string {
+	return path.Join(dir, size+"."+ext)
+}
+
+// AfterFind sets the fields derived from stored ones
+func (v *Video) AfterFind(tx *gorm.DB) error {
+	v.setThumbnail()
+	return nil
+}
+
+// AfterSave sets the fields derived from stored ones
+func (v *Video) AfterSave(tx *gorm.DB) error {
+	v.setThumbnail()
+	return nil
+}
+
+func (v *Video) setThumbnail() {
+	v.Thumbnail = ""
+	v.Thumbnails = nil
+	if v.ThumbnailURL == "" {
+		return
+	}
+	v.Thumbnail = UploadsPath + v.ThumbnailURL
+	if strings.HasPrefix(v.ThumbnailURL, ThumbnailsPrefix) {
+		dir := path.Dir(v.ThumbnailURL)
+		url := func(size, ext string) string {
+			return UploadsPath + ThumbnailKey(dir, size, ext)
+		}
+		v.Thumbnails = &Thumbnails{
+			Small:      url("small", "jpg"),
+			Medium:     url("medium", "jpg"),
+			Large:      url("large", "jpg"),
+			SmallWebP:  url("small", "webp"),
+			MediumWebP: url("medium", "webp"),
+			LargeWebP:  url("large", "webp"),
+		}
+	}
+}
+
+// Rendition model: lower quality variant of a video
+type Rendition struct {
+	ID uint						`gorm:"primaryKey" json:"-"`
+	VideoID uint				`gorm:"index" json:"-"`
+	Quality string				`json:"quality"`
+	Size string					`json:"size"`
+	URL string					`json:"-"`
+}
+
 // VideoCategory model
 type VideoCategory struct {
 	ID uint						`gorm:"primaryKey" json:"id,string,omitempty"`
@@ -66,28 +187,133 @@ type Category struct {
 	Title string 				`gorm:"unique" json:"title"`
 }
 
-// Like model
+// Like model: the reaction of a user to a video, a like or a dislike. A
+// user has at most one per video.
 type Like struct {
 	ID uint						`gorm:"primaryKey" json:"id,string,omitempty"`
-	UID uint					`json:"userId,string"`
-	VID uint					`json:"videoId,string"`
+	UID uint					`gorm:"uniqueIndex:idx_likes_uid_v_id" json:"userId,string"`
+	VID uint					`gorm:"uniqueIndex:idx_likes_uid_v_id" json:"videoId,string"`
 	IsDislike bool				`gorm:"default:false" json:"isDislike,string"`
 }
 
-// Comment model
+// DeletedCommentText replaces the text of a deleted comment
+const DeletedCommentText = "[deleted]"
+
+// Comment model. Deleted comments are kept (with their text replaced) so
+// the replies to them stay in place.
 type Comment struct {
 	ID uint						`gorm:"primaryKey" json:"id,string,omitempty"`
 	UserID uint					`json:"userId"`
 	User User					`json:"user"`
 	VideoID uint				`json:"videoId"`
 	ReplyTo null.Int			`json:"replyTo,omitempty"`
-	ReplyCount int 				`gorm:"-" json:"replyCount"`
+	// replies listed, kept up to date as replies are made and deleted
+	ReplyCount int 				`json:"replyCount"`
 	Replies []Comment 			`gorm:"foreignKey:ReplyTo" json:"replies"`
 	Text string 				`json:"text"`
+	LikeCount int				`json:"likes"`
+	// likes plus replies, what top comments are sorted by
+	Score int					`json:"score"`
+	// set by the owner of the video
+	Hearted bool				`json:"hearted"`
+	Pinned bool					`json:"pinned"`
+	// whether the user listing the comments liked it
+	Liked bool					`gorm:"-" json:"liked"`
+
+	CreatedAt time.Time			`json:"createdAt"`
+	UpdatedAt time.Time			`json:"-"`
+	EditedAt *time.Time			`json:"editedAt,omitempty"`
+	DeletedAt *time.Time 		`gorm:"index" json:"deletedAt,omitempty"`
+}
+
+// CommentLike model: a user liking a comment
+type CommentLike struct {
+	ID uint						`gorm:"primaryKey" json:"id"`
+	CommentID uint				`gorm:"uniqueIndex:idx_comment_likes_comment_id_user_id" json:"commentId"`
+	UserID uint					`gorm:"uniqueIndex:idx_comment_likes_comment_id_user_id" json:"userId"`
+
+	CreatedAt time.Time			`json:"createdAt"`
+}
+
+// Subscription model: a user following the videos of another, the channel
+type Subscription struct {
+	ID uint						`gorm:"primaryKey" json:"id"`
+	UserID uint					`gorm:"uniqueIndex:idx_subscriptions_user_id_channel_id" json:"userId"`
+	ChannelID uint				`gorm:"uniqueIndex:idx_subscriptions_user_id_channel_id;index" json:"channelId"`
+	Channel User				`gorm:"foreignKey:ChannelID" json:"channel"`
+
+	CreatedAt time.Time			`json:"createdAt"`
+}
+
+// AuditLog model: a record of a moderation action
+type AuditLog struct {
+	ID uint						`gorm:"primaryKey" json:"id"`
+	ActorID uint				`gorm:"index" json:"actorId"`
+	Action string				`json:"action"`
+	TargetType string			`json:"targetType"`
+	TargetID uint				`json:"targetId"`
+	Detail string				`json:"detail"`
+
+	CreatedAt time.Time			`json:"createdAt"`
+}
+
+// Job states
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobFailed  = "failed"
+	JobDone    = "done"
+)
+
+// Job model: a unit of background work persisted in the database
+type Job struct {
+	ID uint						`gorm:"primaryKey" json:"id"`
+	Type string					`json:"type"`
+	// video the job works on, if any
+	VideoID uint				`gorm:"index" json:"videoId,omitempty"`
+	Payload string				`json:"-"`
+	State string				`gorm:"index" json:"state"`
+	Attempts int				`json:"attempts"`
+	MaxAttempts int				`json:"maxAttempts"`
+	LastError string			`json:"error,omitempty"`
+	// percentage of the work done, as reported by the handler
+	Progress int				`json:"progress"`
+	RunAt time.Time				`json:"runAt"`
+
+	CreatedAt time.Time			`json:"createdAt"`
+	UpdatedAt time.Time			`json:"updatedAt"`
+}
+
+// Upload model: a resumable (tus) upload. Data is appended to a file under
+// the upload path until Offset reaches Length, then the video is created.
+type Upload struct {
+	ID string					`gorm:"primaryKey;size:32" json:"id"`
+	UserID uint					`gorm:"index" json:"userId"`
+	Length int64				`json:"length"`
+	Offset int64				`json:"offset"`
+	// Upload-Metadata header the upload was created with
+	Metadata string				`json:"-"`
+	// set once the upload is complete
+	VideoID uint				`json:"videoId,omitempty"`
+	ExpiresAt time.Time			`gorm:"index" json:"expiresAt"`
 
 	CreatedAt time.Time			`json:"createdAt"`
 	UpdatedAt time.Time			`json:"-"`
-	DeletedAt gorm.DeletedAt 	`gorm:"index" json:"-"`
+}
+
+// ViewCount model: views of a video not yet added to Video.Views, kept by
+// the SQL view store
+type ViewCount struct {
+	VideoID uint				`gorm:"primaryKey;autoIncrement:false"`
+	Views int64
+}
+
+// ViewRecord model: when a viewer (a hash of their user or address) was
+// last counted as viewing a video, kept by the SQL view store
+type ViewRecord struct {
+	Viewer string				`gorm:"primaryKey;size:64"`
+	VideoID uint				`gorm:"primaryKey;autoIncrement:false"`
+	ViewedAt time.Time			`gorm:"index"`
 }
 
 // ErrResponse - Error response
@@ -100,7 +326,17 @@ type UserClaims struct {
 	UserID uint
 	Name string
 	Email string
-	Password string
-	IsAdmin bool
+	Role string
 	jwt.StandardClaims
 }
+
+// RefreshToken model: server-side record of an issued refresh token
+type RefreshToken struct {
+	ID uint						`gorm:"primaryKey"`
+	UserID uint					`gorm:"index"`
+	TokenHash string			`gorm:"unique"`
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+
+	CreatedAt time.Time
+}
@@ -0,0 +1,289 @@
+package search
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/prologic/tube/models"
+)
+
+// bleveVersion is the version of the documents indexed; an index of an
+// older version is dropped and built again
+const bleveVersion = "2"
+
+// videoDoc is the document indexed for a video
+type videoDoc struct {
+	Type        string    `json:"type"`
+	ID          float64   `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Uploader    string    `json:"uploader"`
+	UserID      float64   `json:"user_id"`
+	Categories  []string  `json:"categories"`
+	Duration    float64   `json:"duration"`
+	Views       float64   `json:"views"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// userDoc is the document indexed for a user
+type userDoc struct {
+	Type      string    `json:"type"`
+	ID        float64   `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// commentDoc is the document indexed for a comment
+type commentDoc struct {
+	Type      string    `json:"type"`
+	ID        float64   `json:"id"`
+	Text      string    `json:"text"`
+	UserID    float64   `json:"user_id"`
+	VideoID   float64   `json:"video_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// bleveIndex is an embedded index stored on disk, for deployments without
+// a database that can do full-text search (e.g. SQLite)
+type bleveIndex struct {
+	index bleve.Index
+}
+
+func openBleve(path string) (*bleveIndex, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return newBleve(path)
+	}
+
+	index, err := bleve.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	version, err := index.GetInternal([]byte("version"))
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	if string(version) != bleveVersion {
+		// left empty, the index is built from the database
+		index.Close()
+		if err := os.RemoveAll(path); err != nil {
+			return nil, err
+		}
+		return newBleve(path)
+	}
+	return &bleveIndex{index: index}, nil
+}
+
+func newBleve(path string) (*bleveIndex, error) {
+	index, err := bleve.New(path, newMapping())
+	if err != nil {
+		return nil, err
+	}
+	if err := index.SetInternal([]byte("version"), []byte(bleveVersion)); err != nil {
+		index.Close()
+		return nil, err
+	}
+	return &bleveIndex{index: index}, nil
+}
+
+func newMapping() *mapping.IndexMappingImpl {
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = en.AnalyzerName
+
+	keywords := bleve.NewTextFieldMapping()
+	keywords.Analyzer = keyword.Name
+
+	numeric := bleve.NewNumericFieldMapping()
+	date := bleve.NewDateTimeFieldMapping()
+
+	// the fields of all document types, told apart by type
+	doc := bleve.NewDocumentMapping()
+	doc.AddFieldMappingsAt("type", keywords)
+	doc.AddFieldMappingsAt("id", numeric)
+	doc.AddFieldMappingsAt("title", text)
+	doc.AddFieldMappingsAt("description", text)
+	doc.AddFieldMappingsAt("uploader", text)
+	doc.AddFieldMappingsAt("name", text)
+	doc.AddFieldMappingsAt("text", text)
+	doc.AddFieldMappingsAt("user_id", numeric)
+	doc.AddFieldMappingsAt("video_id", numeric)
+	doc.AddFieldMappingsAt("categories", keywords)
+	doc.AddFieldMappingsAt("duration", numeric)
+	doc.AddFieldMappingsAt("views", numeric)
+	doc.AddFieldMappingsAt("created_at", date)
+
+	index := bleve.NewIndexMapping()
+	index.DefaultMapping = doc
+	return index
+}
+
+func (b *bleveIndex) Index(video *models.Video) error {
+	doc := &videoDoc{
+		Type:        TypeVideo,
+		ID:          float64(video.ID),
+		Title:       video.Title,
+		Description: video.Description,
+		Uploader:    video.User.Name,
+		UserID:      float64(video.UserID),
+		Duration:    float64(video.Duration),
+		Views:       float64(video.Views),
+		CreatedAt:   video.CreatedAt,
+	}
+	for _, cat := range video.Categories {
+		doc.Categories = append(doc.Categories, strconv.FormatUint(uint64(cat.CID), 10))
+	}
+	return b.index.Index(docID(TypeVideo, video.ID), doc)
+}
+
+func (b *bleveIndex) IndexUser(user *models.User) error {
+	doc := &userDoc{
+		Type:      TypeUser,
+		ID:        float64(user.ID),
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+	}
+	return b.index.Index(docID(TypeUser, user.ID), doc)
+}
+
+func (b *bleveIndex) IndexComment(comment *models.Comment) error {
+	doc := &commentDoc{
+		Type:      TypeComment,
+		ID:        float64(comment.ID),
+		Text:      comment.Text,
+		UserID:    float64(comment.UserID),
+		VideoID:   float64(comment.VideoID),
+		CreatedAt: comment.CreatedAt,
+	}
+	return b.index.Index(docID(TypeComment, comment.ID), doc)
+}
+
+func (b *bleveIndex) Delete(typ string, id uint) error {
+	return b.index.Delete(docID(typ, id))
+}
+
+func (b *bleveIndex) Search(q *Query) (*Result, error) {
+	typ := q.Type
+	if typ == "" {
+		typ = TypeVideo
+	}
+	docType := bleve.NewTermQuery(typ)
+	docType.SetField("type")
+	filters := []query.Query{docType}
+
+	switch {
+	case q.Text == "":
+	case typ == TypeUser:
+		name := bleve.NewMatchQuery(q.Text)
+		name.SetField("name")
+		filters = append(filters, name)
+	case typ == TypeComment:
+		text := bleve.NewMatchQuery(q.Text)
+		text.SetField("text")
+		filters = append(filters, text)
+	default:
+		title := bleve.NewMatchQuery(q.Text)
+		title.SetField("title")
+		title.SetBoost(3)
+		description := bleve.NewMatchQuery(q.Text)
+		description.SetField("description")
+		uploader := bleve.NewMatchQuery(q.Text)
+		uploader.SetField("uploader")
+		uploader.SetBoost(2)
+		filters = append(filters, bleve.NewDisjunctionQuery(title, description, uploader))
+	}
+	// filters the documents don't have are ignored, as by the mysql index
+	if q.Category > 0 && typ == TypeVideo {
+		category := bleve.NewTermQuery(strconv.FormatUint(uint64(q.Category), 10))
+		category.SetField("categories")
+		filters = append(filters, category)
+	}
+	if q.UserID > 0 && typ != TypeUser {
+		filters = append(filters, numericTerm("user_id", q.UserID))
+	}
+	if q.VideoID > 0 && typ == TypeComment {
+		filters = append(filters, numericTerm("video_id", q.VideoID))
+	}
+	if (q.MinDuration > 0 || q.MaxDuration > 0) && typ == TypeVideo {
+		var min, max *float64
+		if q.MinDuration > 0 {
+			v := float64(q.MinDuration)
+			min = &v
+		}
+		if q.MaxDuration > 0 {
+			v := float64(q.MaxDuration)
+			max = &v
+		}
+		inclusive := true
+		duration := bleve.NewNumericRangeInclusiveQuery(min, max, &inclusive, &inclusive)
+		duration.SetField("duration")
+		filters = append(filters, duration)
+	}
+	if !q.After.IsZero() || !q.Before.IsZero() {
+		created := bleve.NewDateRangeQuery(q.After, q.Before)
+		created.SetField("created_at")
+		filters = append(filters, created)
+	}
+
+	search := bleve.NewConjunctionQuery(filters...)
+	req := bleve.NewSearchRequestOptions(search, q.Limit, q.Offset, false)
+	// ties are broken by the numeric id; _id is a string, which sorts
+	// "10" before "9"
+	switch q.Sort {
+	case SortNewest:
+		req.SortBy([]string{"-created_at", "-id"})
+	case SortOldest:
+		req.SortBy([]string{"created_at", "id"})
+	case SortViews:
+		req.SortBy([]string{"-views", "-id"})
+	case SortLongest:
+		req.SortBy([]string{"-duration", "-id"})
+	case SortShortest:
+		req.SortBy([]string{"duration", "id"})
+	default:
+		req.SortBy([]string{"-_score", "-created_at", "-id"})
+	}
+
+	res, err := b.index.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Total: int(res.Total)}
+	for _, hit := range res.Hits {
+		id, err := strconv.ParseUint(strings.TrimPrefix(hit.ID, typ+":"), 10, 64)
+		if err != nil {
+			continue
+		}
+		result.IDs = append(result.IDs, uint(id))
+	}
+	return result, nil
+}
+
+func (b *bleveIndex) DocCount() (uint64, error) {
+	return b.index.DocCount()
+}
+
+func (b *bleveIndex) Close() error {
+	return b.index.Close()
+}
+
+// docID returns the id of the document of type typ with id
+func docID(typ string, id uint) string {
+	return typ + ":" + strconv.FormatUint(uint64(id), 10)
+}
+
+// numericTerm matches documents whose field is value
+func numericTerm(field string, value uint) query.Query {
+	v := float64(value)
+	inclusive := true
+	term := bleve.NewNumericRangeInclusiveQuery(&v, &v, &inclusive, &inclusive)
+	term.SetField(field)
+	return term
+}
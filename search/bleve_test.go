@@ -0,0 +1,143 @@
+package search
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/prologic/tube/models"
+)
+
+// newTestPath returns where to keep a bleve index in a temp dir
+func newTestPath(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tube-search-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "search.bleve")
+}
+
+// newTestBleve opens a new bleve index in a temp dir
+func newTestBleve(t *testing.T) *bleveIndex {
+	t.Helper()
+	index, err := openBleve(newTestPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { index.Close() })
+	return index
+}
+
+// search fails unless q finds want, in order
+func search(t *testing.T, index Index, q *Query, want string) {
+	t.Helper()
+	if q.Limit == 0 {
+		q.Limit = 10
+	}
+	result, err := index.Search(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(result.IDs); got != want {
+		t.Errorf("search %+v: got %s, want %s", q, got, want)
+	}
+}
+
+func TestBleveSearch(t *testing.T) {
+	index := newTestBleve(t)
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	videos := []*models.Video{
+		{ID: 9, Title: "cooking pasta", UserID: 1, Duration: 60, Views: 5, CreatedAt: created},
+		{ID: 10, Title: "cooking rice", UserID: 2, Duration: 600, Views: 5, CreatedAt: created},
+		{ID: 11, Title: "gardening", UserID: 1, Duration: 300, Views: 50, CreatedAt: created.Add(time.Hour)},
+	}
+	for _, video := range videos {
+		video.User = models.User{Name: fmt.Sprintf("user%d", video.UserID)}
+		video.Categories = []models.VideoCategory{{CID: video.UserID}}
+		if err := index.Index(video); err != nil {
+			t.Fatal(err)
+		}
+	}
+	users := []*models.User{
+		{ID: 1, Name: "chef", CreatedAt: created},
+		{ID: 2, Name: "gardener", CreatedAt: created},
+	}
+	for _, user := range users {
+		if err := index.IndexUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	comments := []*models.Comment{
+		{ID: 1, Text: "tasty pasta", UserID: 2, VideoID: 9, CreatedAt: created},
+		{ID: 2, Text: "more pasta please", UserID: 1, VideoID: 10, CreatedAt: created.Add(time.Minute)},
+	}
+	for _, comment := range comments {
+		if err := index.IndexComment(comment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search(t, index, &Query{Text: "cooking", Sort: SortNewest}, "[10 9]")
+	search(t, index, &Query{Text: "cooking", Sort: SortOldest}, "[9 10]")
+	search(t, index, &Query{Sort: SortViews}, "[11 10 9]")
+	search(t, index, &Query{Sort: SortShortest}, "[9 11 10]")
+	search(t, index, &Query{Text: "pasta"}, "[9]")
+	search(t, index, &Query{Text: "user2"}, "[10]")
+	search(t, index, &Query{Category: 1, Sort: SortOldest}, "[9 11]")
+	search(t, index, &Query{UserID: 1, MinDuration: 100}, "[11]")
+	search(t, index, &Query{After: created.Add(time.Minute)}, "[11]")
+
+	search(t, index, &Query{Type: TypeUser, Text: "gardener"}, "[2]")
+	search(t, index, &Query{Type: TypeUser, Sort: SortNewest}, "[2 1]")
+	// video filters don't apply to users
+	search(t, index, &Query{Type: TypeUser, Text: "chef", Category: 2, UserID: 2}, "[1]")
+
+	search(t, index, &Query{Type: TypeComment, Text: "pasta", Sort: SortNewest}, "[2 1]")
+	search(t, index, &Query{Type: TypeComment, Text: "pasta", VideoID: 9}, "[1]")
+	search(t, index, &Query{Type: TypeComment, UserID: 1}, "[2]")
+
+	if err := index.Delete(TypeComment, 2); err != nil {
+		t.Fatal(err)
+	}
+	search(t, index, &Query{Type: TypeComment, Text: "pasta"}, "[1]")
+	// ids of different types don't collide
+	search(t, index, &Query{Type: TypeVideo, UserID: 1, Sort: SortOldest}, "[9 11]")
+}
+
+func TestBleveVersion(t *testing.T) {
+	path := newTestPath(t)
+	index, err := openBleve(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Index(&models.Video{ID: 1, Title: "video"}); err != nil {
+		t.Fatal(err)
+	}
+	index.Close()
+
+	// an index of before the version was kept is dropped
+	old, err := bleve.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.DeleteInternal([]byte("version")); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	index, err = openBleve(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if count, _ := index.DocCount(); count != 0 {
+		t.Errorf("got %d documents in an index of an older version, want none", count)
+	}
+}
@@ -0,0 +1,181 @@
+package search
+
+import (
+	"github.com/prologic/tube/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// matches title and description against the FULLTEXT index added by the
+// video_search migration
+const mysqlMatch = "MATCH (videos.title, videos.description) AGAINST (? IN NATURAL LANGUAGE MODE)"
+
+// matches comment texts against the FULLTEXT index added by the
+// comment_search migration
+const mysqlCommentMatch = "MATCH (comments.text) AGAINST (? IN NATURAL LANGUAGE MODE)"
+
+// mysqlIndex searches the videos, users and comments tables directly, so
+// there is nothing to keep in sync
+type mysqlIndex struct {
+	db *gorm.DB
+}
+
+func (m *mysqlIndex) Index(video *models.Video) error { return nil }
+
+func (m *mysqlIndex) IndexUser(user *models.User) error { return nil }
+
+func (m *mysqlIndex) IndexComment(comment *models.Comment) error { return nil }
+
+func (m *mysqlIndex) Delete(typ string, id uint) error { return nil }
+
+func (m *mysqlIndex) Search(q *Query) (*Result, error) {
+	var tx *gorm.DB
+	var order clause.Expression
+	var column string
+	switch q.Type {
+	case TypeUser:
+		tx, order = m.users(q)
+		column = "users.id"
+	case TypeComment:
+		tx, order = m.comments(q)
+		column = "comments.id"
+	default:
+		tx, order = m.videos(q)
+		column = "videos.id"
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	ids := []uint{}
+	err := tx.Clauses(order).Offset(q.Offset).Limit(q.Limit).Pluck(column, &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Result{IDs: ids, Total: int(total)}, nil
+}
+
+// videos returns the query of the ready videos matching q and their order
+func (m *mysqlIndex) videos(q *Query) (*gorm.DB, clause.Expression) {
+	tx := m.db.Model(&models.Video{}).Where("videos.status = ?", models.VideoReady)
+
+	if q.Text != "" {
+		tx = tx.Where(
+			"("+mysqlMatch+" OR videos.user_id IN (SELECT id FROM users WHERE name LIKE ?))",
+			q.Text, "%"+q.Text+"%",
+		)
+	}
+	if q.Category > 0 {
+		tx = tx.Where(
+			"EXISTS (SELECT 1 FROM video_categories WHERE v_id = videos.id AND c_id = ?)",
+			q.Category,
+		)
+	}
+	if q.UserID > 0 {
+		tx = tx.Where("videos.user_id = ?", q.UserID)
+	}
+	if q.MinDuration > 0 {
+		tx = tx.Where("videos.duration >= ?", q.MinDuration)
+	}
+	if q.MaxDuration > 0 {
+		tx = tx.Where("videos.duration <= ?", q.MaxDuration)
+	}
+	tx = createdBetween(tx, "videos", q)
+
+	switch q.Sort {
+	case SortNewest:
+		return tx, orderBy("videos.created_at DESC, videos.id DESC")
+	case SortOldest:
+		return tx, orderBy("videos.created_at, videos.id")
+	case SortViews:
+		return tx, orderBy("videos.views DESC, videos.id DESC")
+	case SortLongest:
+		return tx, orderBy("videos.duration DESC, videos.id DESC")
+	case SortShortest:
+		return tx, orderBy("videos.duration, videos.id")
+	}
+	if q.Text != "" {
+		return tx, orderBy(mysqlMatch+" DESC, videos.created_at DESC, videos.id DESC", q.Text)
+	}
+	return tx, orderBy("videos.created_at DESC, videos.id DESC")
+}
+
+// users returns the query of the users matching q and their order. Names
+// are too short for FULLTEXT, so they are matched with LIKE and exact
+// matches come first.
+func (m *mysqlIndex) users(q *Query) (*gorm.DB, clause.Expression) {
+	tx := m.db.Model(&models.User{})
+
+	if q.Text != "" {
+		tx = tx.Where("users.name LIKE ?", "%"+q.Text+"%")
+	}
+	tx = createdBetween(tx, "users", q)
+
+	switch q.Sort {
+	case SortNewest:
+		return tx, orderBy("users.created_at DESC, users.id DESC")
+	case SortOldest:
+		return tx, orderBy("users.created_at, users.id")
+	}
+	if q.Text != "" {
+		return tx, orderBy("users.name = ? DESC, users.created_at DESC, users.id DESC", q.Text)
+	}
+	return tx, orderBy("users.created_at DESC, users.id DESC")
+}
+
+// comments returns the query of the comments on ready videos matching q
+// and their order. Deleted comments are left out.
+func (m *mysqlIndex) comments(q *Query) (*gorm.DB, clause.Expression) {
+	tx := m.db.Model(&models.Comment{}).
+		Where("comments.deleted_at IS NULL").
+		Where("comments.video_id IN (SELECT id FROM videos WHERE status = ?)", models.VideoReady)
+
+	if q.Text != "" {
+		tx = tx.Where(mysqlCommentMatch, q.Text)
+	}
+	if q.UserID > 0 {
+		tx = tx.Where("comments.user_id = ?", q.UserID)
+	}
+	if q.VideoID > 0 {
+		tx = tx.Where("comments.video_id = ?", q.VideoID)
+	}
+	tx = createdBetween(tx, "comments", q)
+
+	switch q.Sort {
+	case SortNewest:
+		return tx, orderBy("comments.created_at DESC, comments.id DESC")
+	case SortOldest:
+		return tx, orderBy("comments.created_at, comments.id")
+	}
+	if q.Text != "" {
+		return tx, orderBy(mysqlCommentMatch+" DESC, comments.created_at DESC, comments.id DESC", q.Text)
+	}
+	return tx, orderBy("comments.created_at DESC, comments.id DESC")
+}
+
+// createdBetween filters rows of table by the date range of q
+func createdBetween(tx *gorm.DB, table string, q *Query) *gorm.DB {
+	if !q.After.IsZero() {
+		tx = tx.Where(table+".created_at >= ?", q.After)
+	}
+	if !q.Before.IsZero() {
+		tx = tx.Where(table+".created_at <= ?", q.Before)
+	}
+	return tx
+}
+
+// orderBy orders by sql, which may take vars. gorm's Order doesn't take
+// vars: it would print a gorm.Expr into the query rather than bind it.
+func orderBy(sql string, vars ...interface{}) clause.Expression {
+	return clause.OrderBy{Expression: clause.Expr{SQL: sql, Vars: vars}}
+}
+
+func (m *mysqlIndex) DocCount() (uint64, error) {
+	var count int64
+	err := m.db.Model(&models.Video{}).Where("status = ?", models.VideoReady).Count(&count).Error
+	return uint64(count), err
+}
+
+func (m *mysqlIndex) Close() error { return nil }
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// newDryRunIndex returns a mysql index that builds queries without a
+// database to run them on
+func newDryRunIndex(t *testing.T) *mysqlIndex {
+	t.Helper()
+	dialector := mysql.New(mysql.Config{
+		DSN:                       "tube@tcp(127.0.0.1:3306)/tube",
+		SkipInitializeWithVersion: true,
+	})
+	db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &mysqlIndex{db: db}
+}
+
+func TestMySQLOrder(t *testing.T) {
+	m := newDryRunIndex(t)
+
+	tests := []struct {
+		query *Query
+		order string
+		vars  []interface{}
+	}{
+		{
+			&Query{Text: "cats"},
+			"ORDER BY " + mysqlMatch + " DESC, videos.created_at DESC, videos.id DESC",
+			[]interface{}{"ready", "cats", "%cats%", "cats"},
+		},
+		{
+			&Query{Sort: SortViews},
+			"ORDER BY videos.views DESC, videos.id DESC",
+			[]interface{}{"ready"},
+		},
+		{
+			&Query{Type: TypeUser, Text: "bob"},
+			"ORDER BY users.name = ? DESC, users.created_at DESC, users.id DESC",
+			[]interface{}{"%bob%", "bob"},
+		},
+		{
+			&Query{Type: TypeComment, Text: "nice", VideoID: 7},
+			"ORDER BY " + mysqlCommentMatch + " DESC, comments.created_at DESC, comments.id DESC",
+			[]interface{}{"ready", "nice", uint(7), "nice"},
+		},
+	}
+	for _, test := range tests {
+		var tx *gorm.DB
+		var order clause.Expression
+		switch test.query.Type {
+		case TypeUser:
+			tx, order = m.users(test.query)
+		case TypeComment:
+			tx, order = m.comments(test.query)
+		default:
+			tx, order = m.videos(test.query)
+		}
+		stmt := tx.Clauses(order).Find(&[]uint{}).Statement
+
+		sql := stmt.SQL.String()
+		if !strings.HasSuffix(sql, test.order) {
+			t.Errorf("got %s, want it to end with %s", sql, test.order)
+		}
+		if got, want := fmt.Sprint(stmt.Vars), fmt.Sprint(test.vars); got != want {
+			t.Errorf("got vars %s of %s, want %s", got, sql, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package search provides full-text search over videos, users and comments.
+package search
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prologic/tube/models"
+	"gorm.io/gorm"
+)
+
+// Search backends
+const (
+	BackendBleve = "bleve"
+	BackendMySQL = "mysql"
+)
+
+// Document types
+const (
+	TypeVideo   = "video"
+	TypeUser    = "user"
+	TypeComment = "comment"
+)
+
+// Sort orders
+const (
+	SortRelevance = "relevance"
+	SortNewest    = "newest"
+	SortOldest    = "oldest"
+	SortViews     = "views"
+	SortLongest   = "longest"
+	SortShortest  = "shortest"
+)
+
+// Query describes a search. Zero values mean "no filter". Category and
+// the durations only filter videos, UserID filters videos by uploader and
+// comments by author, VideoID filters comments.
+type Query struct {
+	// Type is the type of documents searched, videos if empty
+	Type        string
+	Text        string
+	Category    uint
+	UserID      uint
+	VideoID     uint
+	MinDuration int
+	MaxDuration int
+	After       time.Time
+	Before      time.Time
+	Sort        string
+	Offset      int
+	Limit       int
+}
+
+// Result is a page of matching ids in sort order
+type Result struct {
+	IDs   []uint
+	Total int
+}
+
+// Index is a searchable index of ready videos, users and comments
+type Index interface {
+	// Index adds or replaces a video. User and Categories must be loaded.
+	Index(video *models.Video) error
+	// IndexUser adds or replaces a user
+	IndexUser(user *models.User) error
+	// IndexComment adds or replaces a comment
+	IndexComment(comment *models.Comment) error
+	// Delete removes the document of type typ with id from the index
+	Delete(typ string, id uint) error
+	// Search returns the documents of type q.Type matching q
+	Search(q *Query) (*Result, error)
+	// DocCount returns the number of indexed documents
+	DocCount() (uint64, error)
+	Close() error
+}
+
+// Open opens the index for backend. bleve stores its index at path; mysql
+// uses FULLTEXT indexes of the database itself.
+func Open(backend, path string, db *gorm.DB) (Index, error) {
+	switch backend {
+	case BackendBleve:
+		return openBleve(path)
+	case BackendMySQL:
+		return &mysqlIndex{db: db}, nil
+	default:
+		return nil, fmt.Errorf("unsupported search backend: %s", backend)
+	}
+}
+
+// ValidType reports whether typ is a known document type
+func ValidType(typ string) bool {
+	switch typ {
+	case TypeVideo, TypeUser, TypeComment:
+		return true
+	}
+	return false
+}
+
+// ValidSort reports whether sort is a known sort order of documents of
+// type typ. Users and comments have no views or duration to sort by.
+func ValidSort(typ, sort string) bool {
+	switch sort {
+	case SortRelevance, SortNewest, SortOldest:
+		return true
+	case SortViews, SortLongest, SortShortest:
+		return typ == TypeVideo
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLocal(t *testing.T) (*Local, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tube-storage-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	l, err := NewLocal(filepath.Join(dir, "root"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, dir
+}
+
+func readObject(t *testing.T, s Storage, key string, offset, length int64) string {
+	t.Helper()
+	body, err := s.Get(context.Background(), key, offset, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLocal(t)
+
+	if err := l.Put(ctx, "videos/a.mp4", strings.NewReader("0123456789"), 10, "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Put(ctx, "videos/b.mp4", strings.NewReader("short"), 10, "video/mp4"); err == nil {
+		t.Error("stored an object shorter than its size")
+	}
+	if _, err := l.Stat(ctx, "videos/b.mp4"); err != ErrNotFound {
+		t.Errorf("got %v stating a failed put, want ErrNotFound", err)
+	}
+
+	info, err := l.Stat(ctx, "videos/a.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 10 || info.ContentType != "video/mp4" {
+		t.Errorf("got %+v, want 10 bytes of video/mp4", info)
+	}
+	if _, err := l.Stat(ctx, "videos"); err != ErrNotFound {
+		t.Errorf("got %v stating a directory, want ErrNotFound", err)
+	}
+
+	for _, test := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, -1, "0123456789"},
+		{3, -1, "3456789"},
+		{3, 4, "3456"},
+		{8, 10, "89"},
+	} {
+		if got := readObject(t, l, "videos/a.mp4", test.offset, test.length); got != test.want {
+			t.Errorf("Get(%d, %d) = %q, want %q", test.offset, test.length, got, test.want)
+		}
+	}
+
+	if err := l.Delete(ctx, "videos/a.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Delete(ctx, "videos/a.mp4"); err != nil {
+		t.Errorf("deleting a missing object: %v", err)
+	}
+	if _, err := l.Get(ctx, "videos/a.mp4", 0, -1); err != ErrNotFound {
+		t.Errorf("got %v getting a deleted object, want ErrNotFound", err)
+	}
+}
+
+func TestLocalKeysStayInRoot(t *testing.T) {
+	ctx := context.Background()
+	l, dir := newTestLocal(t)
+
+	if err := l.Put(ctx, "../../outside", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside")); !os.IsNotExist(err) {
+		t.Error("stored an object outside of the root")
+	}
+	if got := readObject(t, l, "outside", 0, -1); got != "x" {
+		t.Errorf("got %q, want the object stored below the root", got)
+	}
+}
+
+func TestLocalDeletePrefix(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLocal(t)
+	for _, key := range []string{"hls/a/index.m3u8", "hls/a/0.ts", "hls/ab/index.m3u8", "a.mp4", "a#720p.mp4", "b.mp4"} {
+		if err := l.Put(ctx, key, strings.NewReader(""), 0, ContentType(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.DeletePrefix(ctx, "hls/a/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.DeletePrefix(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.DeletePrefix(ctx, "missing/"); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{
+		"hls/a/index.m3u8":  false,
+		"hls/a/0.ts":        false,
+		"hls/ab/index.m3u8": true,
+		"a.mp4":             false,
+		"a#720p.mp4":        false,
+		"b.mp4":             true,
+	} {
+		_, err := l.Stat(ctx, key)
+		if got := err == nil; got != want {
+			t.Errorf("%s exists: %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestPutFile(t *testing.T) {
+	l, dir := newTestLocal(t)
+	filename := filepath.Join(dir, "upload.mp4")
+	if err := ioutil.WriteFile(filename, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PutFile(context.Background(), l, "a.mp4", filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Error("file left behind")
+	}
+	if got := readObject(t, l, "a.mp4", 0, -1); got != "video" {
+		t.Errorf("got %q, want video", got)
+	}
+}
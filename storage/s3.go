@@ -0,0 +1,547 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// objects larger than a part are uploaded in parts
+	s3PartSize = 64 << 20
+	// S3 caps presigned URLs at a week
+	s3MaxExpiry = 7 * 24 * time.Hour
+
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	emptyPayload    = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Options configure an S3 storage
+type S3Options struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.amazonaws.com
+	// or http://localhost:9000 for MinIO
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket as a path (endpoint/bucket/key) rather
+	// than a host name (bucket.endpoint/key), as most S3 compatible servers
+	// require
+	PathStyle bool
+	// Client used for requests, one with connection timeouts if nil
+	Client *http.Client
+}
+
+// S3 stores objects in a bucket of an S3 compatible object storage.
+// Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	endpoint *url.URL
+	opts     S3Options
+	client   *http.Client
+	partSize int64
+}
+
+// newS3Client returns the default client of S3 storages. Requests are
+// bounded by their context rather than a timeout, as uploads may take long,
+// but a server that doesn't respond can't hold them forever.
+func newS3Client() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: time.Minute,
+			ExpectContinueTimeout: time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   16,
+		},
+	}
+}
+
+// NewS3 returns an S3 storage
+func NewS3(opts S3Options) (*S3, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(opts.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %q", opts.Endpoint)
+	}
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("no s3 bucket configured")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = newS3Client()
+	}
+	return &S3{endpoint: endpoint, opts: opts, client: client, partSize: s3PartSize}, nil
+}
+
+// s3Error is an error response of the service
+type s3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: unexpected response status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+// returns the error of an unsuccessful response
+func responseError(res *http.Response) error {
+	e := &s3Error{StatusCode: res.StatusCode}
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64<<10))
+	xml.Unmarshal(body, e)
+	// HEAD responses have no body to tell a missing key from a missing bucket
+	if e.Code == "NoSuchKey" || (e.Code == "" && res.StatusCode == http.StatusNotFound) {
+		return ErrNotFound
+	}
+	return e
+}
+
+// returns the URL of key, the bucket itself if key is empty
+func (s *S3) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	p := strings.TrimSuffix(u.Path, "/")
+	if s.opts.PathStyle {
+		p += "/" + s.opts.Bucket
+	} else {
+		u.Host = s.opts.Bucket + "." + u.Host
+	}
+	p += "/" + key
+
+	u.Path = p
+	u.RawPath = uriEncode(p, false)
+	if query != nil {
+		u.RawQuery = canonicalQuery(query)
+	}
+	return &u
+}
+
+// sends a request signed with the given payload hash
+func (s *S3) do(ctx context.Context, method string, u *url.URL, body io.Reader, payloadHash string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if cl := header.Get("Content-Length"); cl != "" {
+		req.ContentLength, _ = strconv.ParseInt(cl, 10, 64)
+		req.Header.Del("Content-Length")
+		if req.ContentLength == 0 {
+			// an empty body would otherwise be sent chunked
+			req.Body = http.NoBody
+		}
+	}
+	s.sign(req, payloadHash, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if size < 0 || size > s.partSize {
+		return s.putMultipart(ctx, key, r, size, contentType)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+	res, err := s.do(ctx, http.MethodPut, s.objectURL(key, nil), io.LimitReader(r, size), unsignedPayload, header)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+	return nil
+}
+
+// multipart upload API documents
+type (
+	initiateMultipartUploadResult struct {
+		UploadID string `xml:"UploadId"`
+	}
+	completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	completeMultipartUpload struct {
+		XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+		Parts   []*completedPart `xml:"Part"`
+	}
+)
+
+// uploads r in parts. Parts of files, or any io.ReaderAt of known size, are
+// streamed from it, read from its start; other readers are buffered in
+// memory a part at a time.
+func (s *S3) putMultipart(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	res, err := s.do(ctx, http.MethodPost, s.objectURL(key, url.Values{"uploads": {""}}), nil, emptyPayload, header)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return responseError(res)
+	}
+	initiated := &initiateMultipartUploadResult{}
+	err = xml.NewDecoder(res.Body).Decode(initiated)
+	res.Body.Close()
+	if err != nil {
+		return fmt.Errorf("s3: error decoding multipart upload: %w", err)
+	}
+
+	complete := &completeMultipartUpload{}
+	upload := func(number int, part io.Reader, n int64) error {
+		etag, err := s.uploadPart(ctx, key, initiated.UploadID, number, part, n)
+		if err != nil {
+			return err
+		}
+		complete.Parts = append(complete.Parts, &completedPart{PartNumber: number, ETag: etag})
+		return nil
+	}
+	err = func() error {
+		if ra, ok := r.(io.ReaderAt); ok && size >= 0 {
+			var offset int64
+			for number := 1; ; number++ {
+				n := size - offset
+				if n > s.partSize {
+					n = s.partSize
+				}
+				if err := upload(number, io.NewSectionReader(ra, offset, n), n); err != nil {
+					return err
+				}
+				offset += n
+				if offset >= size {
+					return nil
+				}
+			}
+		}
+
+		buf := make([]byte, s.partSize)
+		for number := 1; ; number++ {
+			n, rerr := io.ReadFull(r, buf)
+			if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+				return rerr
+			}
+			if n == 0 && number > 1 {
+				return nil
+			}
+			if err := upload(number, bytes.NewReader(buf[:n]), int64(n)); err != nil {
+				return err
+			}
+			if n < len(buf) {
+				return nil
+			}
+		}
+	}()
+	if err == nil {
+		err = s.completeMultipart(ctx, key, initiated.UploadID, complete)
+	}
+	if err != nil {
+		// don't leave the uploaded parts behind, they are billed
+		abort := s.objectURL(key, url.Values{"uploadId": {initiated.UploadID}})
+		if res, aerr := s.do(context.Background(), http.MethodDelete, abort, nil, emptyPayload, nil); aerr == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// uploads size bytes of r as a part, unsigned like single requests so that
+// it is read once
+func (s *S3) uploadPart(ctx context.Context, key, uploadID string, number int, r io.Reader, size int64) (string, error) {
+	u := s.objectURL(key, url.Values{
+		"partNumber": {strconv.Itoa(number)},
+		"uploadId":   {uploadID},
+	})
+	header := http.Header{}
+	header.Set("Content-Length", strconv.FormatInt(size, 10))
+	res, err := s.do(ctx, http.MethodPut, u, r, unsignedPayload, header)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", responseError(res)
+	}
+	return res.Header.Get("ETag"), nil
+}
+
+func (s *S3) completeMultipart(ctx context.Context, key, uploadID string, complete *completeMultipartUpload) error {
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	u := s.objectURL(key, url.Values{"uploadId": {uploadID}})
+	res, err := s.do(ctx, http.MethodPost, u, bytes.NewReader(body), hex.EncodeToString(sum[:]), header)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+
+	// errors can also come with a 200 once the upload was accepted
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	e := &s3Error{StatusCode: res.StatusCode}
+	if xml.Unmarshal(data, e) == nil && e.Code != "" {
+		return e
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	switch {
+	case length >= 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := s.do(ctx, http.MethodGet, s.objectURL(key, nil), nil, emptyPayload, header)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		defer res.Body.Close()
+		return nil, responseError(res)
+	}
+	return res.Body, nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	res, err := s.do(ctx, http.MethodHead, s.objectURL(key, nil), nil, emptyPayload, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, responseError(res)
+	}
+
+	info := &ObjectInfo{
+		Key:         key,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+	}
+	info.ModTime, _ = http.ParseTime(res.Header.Get("Last-Modified"))
+	if info.ContentType == "" {
+		info.ContentType = ContentType(key)
+	}
+	return info, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, s.objectURL(key, nil), nil, emptyPayload, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		if err := responseError(res); err != ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// listBucketResult is the part of a ListObjectsV2 response we use
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) DeletePrefix(ctx context.Context, prefix string) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		res, err := s.do(ctx, http.MethodGet, s.objectURL("", query), nil, emptyPayload, nil)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK {
+			defer res.Body.Close()
+			return responseError(res)
+		}
+		list := &listBucketResult{}
+		err = xml.NewDecoder(res.Body).Decode(list)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("s3: error decoding object list: %w", err)
+		}
+
+		for _, object := range list.Contents {
+			if err := s.Delete(ctx, object.Key); err != nil {
+				return err
+			}
+		}
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			return nil
+		}
+		token = list.NextContinuationToken
+	}
+}
+
+// SignedURL returns a presigned GET URL of key
+func (s *S3) SignedURL(key string, expiry time.Duration) (string, error) {
+	return s.signedURL(key, expiry, time.Now().UTC()), nil
+}
+
+func (s *S3) signedURL(key string, expiry time.Duration, now time.Time) string {
+	if expiry > s3MaxExpiry {
+		expiry = s3MaxExpiry
+	}
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.opts.AccessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(expiry.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	u := s.objectURL(key, query)
+
+	header := http.Header{}
+	header.Set("Host", u.Host)
+	canonical := s.canonicalRequest(http.MethodGet, u, header, []string{"host"}, unsignedPayload)
+	query.Set("X-Amz-Signature", s.signature(now, canonical))
+	u.RawQuery = canonicalQuery(query)
+	return u.String()
+}
+
+// sign adds the Authorization header of a request
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	header := req.Header.Clone()
+	header.Set("Host", req.URL.Host)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonical := s.canonicalRequest(req.Method, req.URL, header, signed, payloadHash)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKey, s.scope(now), strings.Join(signed, ";"), s.signature(now, canonical),
+	))
+}
+
+func (s *S3) scope(now time.Time) string {
+	return fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), s.opts.Region)
+}
+
+func (s *S3) canonicalRequest(method string, u *url.URL, header http.Header, signed []string, payloadHash string) string {
+	var b strings.Builder
+	b.WriteString(method + "\n")
+	b.WriteString(u.EscapedPath() + "\n")
+	b.WriteString(canonicalQuery(u.Query()) + "\n")
+	for _, name := range signed {
+		b.WriteString(name + ":" + strings.TrimSpace(header.Get(name)) + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.Join(signed, ";") + "\n")
+	b.WriteString(payloadHash)
+	return b.String()
+}
+
+func (s *S3) signature(now time.Time, canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		s.scope(now),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.opts.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by key, as SigV4 requires
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and /
+// unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
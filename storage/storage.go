@@ -0,0 +1,162 @@
+// Package storage stores the media files of videos (videos, renditions,
+// thumbnails and HLS segments) as objects identified by slash separated keys.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when an object doesn't exist
+	ErrNotFound = errors.New("object not found")
+	// ErrNotSupported is returned by backends lacking an optional feature
+	ErrNotSupported = errors.New("not supported by storage backend")
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// Storage is a store of media files
+type Storage interface {
+	// Put stores size bytes read from r as key, replacing any existing
+	// object. size is -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get reads length bytes of an object from offset, up to its end if
+	// length is -1.
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Stat returns the size and type of an object.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes all objects whose key starts with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+	// SignedURL returns an URL the object can be downloaded from without
+	// credentials until expiry passes, ErrNotSupported if the backend
+	// can't serve objects itself.
+	SignedURL(key string, expiry time.Duration) (string, error)
+}
+
+// types missing from (or wrong in) common mime.types files
+var contentTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".jpg":  "image/jpeg",
+	".webp": "image/webp",
+}
+
+// ContentType guesses the content type of an object from its key
+func ContentType(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// fileMover is implemented by backends that can take over a local file
+// without copying it
+type fileMover interface {
+	moveFile(key, filename string) error
+}
+
+// PutFile stores the local file filename as key and removes the file.
+func PutFile(ctx context.Context, s Storage, key, filename string) error {
+	if m, ok := s.(fileMover); ok {
+		if err := m.moveFile(key, filename); err == nil {
+			return nil
+		}
+		// e.g. on another file system, copy it instead
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, key, f, info.Size(), ContentType(key)); err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(filename)
+}
+
+// Reader reads an object of known size as an io.ReadSeeker, as needed by
+// http.ServeContent. Data is requested from the backend from the current
+// offset on the first read after a seek.
+type Reader struct {
+	ctx    context.Context
+	s      Storage
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewReader returns a Reader for the size bytes of object key
+func NewReader(ctx context.Context, s Storage, key string, size int64) *Reader {
+	return &Reader{ctx: ctx, s: s, key: key, size: size}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.s.Get(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of object")
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close releases the pending request, if any
+func (r *Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
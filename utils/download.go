@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrTooLarge is returned when a download exceeds its maximum size
+	ErrTooLarge = errors.New("download exceeds maximum size")
+)
+
+// DownloadOptions tune Download. The zero value downloads without size
+// limit or progress reporting, using DefaultDownloadClient.
+type DownloadOptions struct {
+	// Client used for requests, DefaultDownloadClient if nil
+	Client *http.Client
+	// MaxSize in bytes, 0 for no limit
+	MaxSize int64
+	// Retries is the no. of times an interrupted transfer is resumed
+	Retries int
+	// IdleTimeout aborts a transfer that received nothing for this long,
+	// 1 minute if 0
+	IdleTimeout time.Duration
+	// Progress is called as data arrives, at most twice a second, with the
+	// no. of bytes received so far and the total size (-1 if unknown)
+	Progress func(done, total int64)
+}
+
+// DefaultDownloadClient has connection timeouts but no overall timeout, as
+// downloads can take long; stalled transfers are caught by IdleTimeout.
+var DefaultDownloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// Download streams url to filename. Data is written to filename.part,
+// which is renamed to filename once complete; a .part file left by an
+// interrupted download is resumed with a HTTP Range request if the server
+// supports it.
+func Download(ctx context.Context, url, filename string, opts *DownloadOptions) error {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	part := filename + ".part"
+
+	var err error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if err = download(ctx, url, part, opts); err == nil {
+			return os.Rename(part, filename)
+		}
+		if ctx.Err() != nil || errors.Is(err, ErrTooLarge) || isPermanent(err) {
+			break
+		}
+		if attempt < opts.Retries {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt+1) * time.Second):
+			}
+		}
+	}
+	return err
+}
+
+// httpError is an unexpected response status
+type httpError struct {
+	Status     string
+	StatusCode int
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("unexpected response: %s", e.Status)
+}
+
+// isPermanent reports whether err won't go away by retrying
+func isPermanent(err error) bool {
+	var herr *httpError
+	return errors.As(err, &herr) && herr.StatusCode >= 400 && herr.StatusCode < 500
+}
+
+func download(ctx context.Context, url, part string, opts *DownloadOptions) error {
+	client := opts.Client
+	if client == nil {
+		client = DefaultDownloadClient
+	}
+	idle := opts.IdleTimeout
+	if idle <= 0 {
+		idle = time.Minute
+	}
+
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		start, _, err := parseContentRange(res.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			return fmt.Errorf("unexpected Content-Range: %q", res.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the part file may already hold everything
+		_, total, err := parseContentRange(res.Header.Get("Content-Range"))
+		if err == nil && total == offset {
+			return nil
+		}
+		os.Remove(part)
+		return fmt.Errorf("unable to resume download: %s", res.Status)
+	case res.StatusCode == http.StatusOK:
+		// no resume support, start over
+		offset = 0
+		flags |= os.O_TRUNC
+	default:
+		return &httpError{Status: res.Status, StatusCode: res.StatusCode}
+	}
+
+	total := int64(-1)
+	if res.ContentLength >= 0 {
+		total = offset + res.ContentLength
+	}
+	if opts.MaxSize > 0 && total > opts.MaxSize {
+		return ErrTooLarge
+	}
+
+	f, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// cancel the request when no data arrives for too long
+	var stalled int32
+	timer := time.AfterFunc(idle, func() {
+		atomic.StoreInt32(&stalled, 1)
+		cancel()
+	})
+	defer timer.Stop()
+
+	var body io.Reader = res.Body
+	if opts.MaxSize > 0 {
+		// one byte over the limit tells a too large body apart
+		body = io.LimitReader(body, opts.MaxSize-offset+1)
+	}
+
+	done := offset
+	var reported time.Time
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := body.Read(buf)
+		if n > 0 {
+			timer.Reset(idle)
+			if _, err := f.Write(buf[:n]); err != nil {
+				return err
+			}
+			done += int64(n)
+			if opts.MaxSize > 0 && done > opts.MaxSize {
+				os.Remove(part)
+				return ErrTooLarge
+			}
+			if opts.Progress != nil && time.Since(reported) >= 500*time.Millisecond {
+				opts.Progress(done, total)
+				reported = time.Now()
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			if atomic.LoadInt32(&stalled) == 1 {
+				return fmt.Errorf("download stalled for %s", idle)
+			}
+			return rerr
+		}
+	}
+
+	if total >= 0 && done != total {
+		return fmt.Errorf("download incomplete: got %d of %d bytes", done, total)
+	}
+	if opts.Progress != nil {
+		opts.Progress(done, total)
+	}
+	return f.Close()
+}
+
+// parseContentRange parses a "bytes start-end/total" or "bytes */total"
+// Content-Range header. total is -1 if unknown.
+func parseContentRange(value string) (start, total int64, err error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %q", value)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %q", value)
+	}
+
+	total = -1
+	if parts[1] != "*" {
+		if total, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range: %q", value)
+		}
+	}
+	if parts[0] == "*" {
+		return 0, total, nil
+	}
+	bounds := strings.SplitN(parts[0], "-", 2)
+	if start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %q", value)
+	}
+	return start, total, nil
+}
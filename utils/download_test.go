@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// video is the file served by the test servers
+var video = bytes.Repeat([]byte("0123456789abcdef"), 10000)
+
+// newDownload returns where to download to in a temp dir, with part bytes
+// left by an interrupted download
+func newDownload(t *testing.T, part []byte) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "tube-download-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	filename := filepath.Join(dir, "video.mp4")
+	if part != nil {
+		if err := ioutil.WriteFile(filename+".part", part, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filename
+}
+
+// checkDownload fails unless filename holds the video
+func checkDownload(t *testing.T, filename string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, video) {
+		t.Errorf("downloaded %d bytes that aren't the video's %d", len(data), len(video))
+	}
+	if FileExists(filename + ".part") {
+		t.Error("part file left after the download")
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(video))
+	}))
+	defer server.Close()
+
+	filename := newDownload(t, video[:1000])
+	var done, total int64
+	err := Download(context.Background(), server.URL, filename, &DownloadOptions{
+		Progress: func(d, t int64) { done, total = d, t },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, filename)
+	if len(ranges) != 1 || ranges[0] != "bytes=1000-" {
+		t.Errorf("got Range headers %q, want [bytes=1000-]", ranges)
+	}
+	if done != int64(len(video)) || total != int64(len(video)) {
+		t.Errorf("got progress %d/%d, want %d/%d", done, total, len(video), len(video))
+	}
+}
+
+func TestDownloadResumeComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(video))
+	}))
+	defer server.Close()
+
+	// the range past the end is answered with 416
+	filename := newDownload(t, video)
+	if err := Download(context.Background(), server.URL, filename, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, filename)
+}
+
+func TestDownloadRangeIgnored(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(video)
+	}))
+	defer server.Close()
+
+	// starts over rather than appending the whole video to the part
+	filename := newDownload(t, []byte("garbage"))
+	if err := Download(context.Background(), server.URL, filename, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, filename)
+}
+
+func TestDownloadMaxSize(t *testing.T) {
+	tests := []struct {
+		name string
+		// the server tells the size up front
+		length bool
+	}{
+		{"Content-Length", true},
+		{"chunked", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if !test.length {
+					// flushing before writing leaves the length unknown
+					w.(http.Flusher).Flush()
+				}
+				w.Write(video)
+			}))
+			defer server.Close()
+
+			filename := newDownload(t, nil)
+			err := Download(context.Background(), server.URL, filename, &DownloadOptions{
+				MaxSize: int64(len(video)) - 1,
+				Retries: 2,
+			})
+			if !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("got error %v, want %v", err, ErrTooLarge)
+			}
+			if requests != 1 {
+				t.Errorf("got %d requests, too large downloads mustn't be retried", requests)
+			}
+			if FileExists(filename) || FileExists(filename+".part") {
+				t.Error("too large download left on disk")
+			}
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(video)
+	}))
+	defer server.Close()
+
+	filename := newDownload(t, nil)
+	err := Download(context.Background(), server.URL, filename, &DownloadOptions{
+		MaxSize: int64(len(video)),
+	})
+	if err != nil {
+		t.Fatalf("download of exactly MaxSize failed: %v", err)
+	}
+	checkDownload(t, filename)
+}
+
+func TestDownloadIdleTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100000")
+		w.Write(video[:1000])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	filename := newDownload(t, nil)
+	start := time.Now()
+	err := Download(context.Background(), server.URL, filename, &DownloadOptions{
+		IdleTimeout: 100 * time.Millisecond,
+	})
+	if err == nil || !strings.Contains(err.Error(), "stalled") {
+		t.Fatalf("got error %v, want the download to stall", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("stalled download aborted after %s", elapsed)
+	}
+
+	// what arrived is kept to resume from
+	data, err := ioutil.ReadFile(filename + ".part")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, video[:1000]) {
+		t.Errorf("kept %d bytes, want the 1000 received", len(data))
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value        string
+		start, total int64
+		err          bool
+	}{
+		{"bytes 1000-1999/2000", 1000, 2000, false},
+		{"bytes 0-99/*", 0, -1, false},
+		{"bytes */2000", 0, 2000, false},
+		{"items 0-99/100", 0, 0, true},
+		{"bytes 0-99", 0, 0, true},
+		{"bytes x-99/100", 0, 0, true},
+	}
+	for _, test := range tests {
+		start, total, err := parseContentRange(test.value)
+		if (err != nil) != test.err || start != test.start || total != test.total {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v", test.value, start, total, err)
+		}
+	}
+}
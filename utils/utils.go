@@ -1,10 +1,9 @@
 package utils
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
 	"strconv"
@@ -20,25 +19,6 @@ func SafeParseInt64(s string, d int64) int64 {
 	return n
 }
 
-func Download(url, filename string) error {
-	res, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	data, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return err
-	}
-
-	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // FileExists ...
 func FileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -57,16 +37,12 @@ func CmdExists(cmd string) bool {
 
 // RunCmd ...
 func RunCmd(timeout int, command string, args ...string) error {
-	var (
-		ctx    context.Context
-		cancel context.CancelFunc
-	)
+	return RunCmdContext(context.Background(), timeout, command, args...)
+}
 
-	if timeout > 0 {
-		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	} else {
-		ctx, cancel = context.WithCancel(context.Background())
-	}
+// RunCmdContext runs a command like RunCmd, killing it when ctx is done
+func RunCmdContext(ctx context.Context, timeout int, command string, args ...string) error {
+	ctx, cancel := cmdContext(ctx, timeout)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, command, args...)
@@ -78,3 +54,29 @@ func RunCmd(timeout int, command string, args ...string) error {
 
 	return nil
 }
+
+// RunCmdOutput runs a command like RunCmd and returns its standard output
+func RunCmdOutput(timeout int, command string, args ...string) ([]byte, error) {
+	ctx, cancel := cmdContext(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cmd.Output error: %w\n%s", err, stderr.Bytes())
+	}
+
+	return out, nil
+}
+
+// cmdContext returns the context of a command with the given timeout in
+// seconds, none if timeout <= 0
+func cmdContext(parent context.Context, timeout int) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(parent, time.Duration(timeout)*time.Second)
+	}
+	return context.WithCancel(parent)
+}